@@ -0,0 +1,115 @@
+package attendance
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/MartinZitterkopf/gocurse_web/pkg/auth"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/meta"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// forbidden es la respuesta a quien no es administrador ni instructor del curso
+const forbidden = "only admins and instructors of the curse can manage attendance"
+
+type (
+	Controller func(w http.ResponseWriter, r *http.Request)
+
+	Endpoints struct {
+		GetMatrix     Controller
+		Mark          Controller
+		GetEnrollment Controller
+	}
+
+	// MarkReq marca a todos con Status, si viene, y a los de Records con su propio estado
+	MarkReq struct {
+		Status  string `json:"status"`
+		Records []Mark `json:"records"`
+	}
+
+	Response struct {
+		Status int         `json:"status"`
+		Data   interface{} `json:"data,omitempty"`
+		Err    string      `json:"error,omitempty"`
+		Meta   *meta.Meta  `json:"meta,omitempty"`
+	}
+)
+
+func MakeEndpoints(s Service) Endpoints {
+	return Endpoints{
+		GetMatrix:     auth.StaffOnly(s.CanManage, forbidden, makeGetMatrixEndpoint(s)),
+		Mark:          auth.StaffOnly(s.CanManage, forbidden, makeMarkEndpoint(s)),
+		GetEnrollment: makeGetEnrollmentEndpoint(s),
+	}
+}
+
+func makeGetMatrixEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		matrix, err := s.Matrix(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(404)
+			json.NewEncoder(w).Encode(&Response{Status: 404, Err: "curse doesn't exist"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: matrix})
+	}
+}
+
+func makeMarkEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req MarkReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "invalid request format"})
+			return
+		}
+
+		if req.Status == "" && len(req.Records) == 0 {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "status or records is required"})
+			return
+		}
+
+		vars := mux.Vars(r)
+		records, err := s.Mark(r.Context(), vars["id"], vars["session"], req.Status, req.Records)
+		if err != nil {
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				w.WriteHeader(404)
+				json.NewEncoder(w).Encode(&Response{Status: 404, Err: "session doesn't exist"})
+			case errors.Is(err, ErrSessionCancelled):
+				w.WriteHeader(409)
+				json.NewEncoder(w).Encode(&Response{Status: 409, Err: err.Error()})
+			default:
+				w.WriteHeader(400)
+				json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
+			}
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: records})
+	}
+}
+
+// el propio alumno puede ver su asistencia, ademas de los administradores e instructores
+func makeGetEnrollmentEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report, err := s.EnrollmentReport(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(404)
+			json.NewEncoder(w).Encode(&Response{Status: 404, Err: "enrollment doesn't exist"})
+			return
+		}
+
+		if auth.UserID(r) != report.UserID && !auth.CanManage(r, report.CurseID, s.CanManage) {
+			w.WriteHeader(403)
+			json.NewEncoder(w).Encode(&Response{Status: 403, Err: "you can only see your own attendance"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: report})
+	}
+}
@@ -0,0 +1,103 @@
+package attendance
+
+import (
+	"log"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type (
+	Repository interface {
+		// Transaction corre fn con un Repository que usa tx, la transaccion que tambien recibe fn
+		Transaction(fn func(repo Repository, tx *gorm.DB) error) error
+		// GetRoster devuelve las inscripciones del curso que no estan canceladas
+		GetRoster(curseID string) ([]domain.Enrollment, error)
+		GetEnrollment(id string) (*domain.Enrollment, error)
+		Save(records []domain.Attendance) error
+		GetByCurse(curseID string) ([]domain.Attendance, error)
+		GetByEnrollment(enrollmentID string) ([]domain.Attendance, error)
+	}
+
+	repo struct {
+		log *log.Logger
+		db  *gorm.DB
+	}
+)
+
+func NewRepo(l *log.Logger, db *gorm.DB) Repository {
+	return &repo{
+		log: l,
+		db:  db,
+	}
+}
+
+func (r *repo) Transaction(fn func(repo Repository, tx *gorm.DB) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		txRepo := *r
+		txRepo.db = tx
+		return fn(&txRepo, tx)
+	})
+}
+
+func (r *repo) GetRoster(curseID string) ([]domain.Enrollment, error) {
+	var enrollments []domain.Enrollment
+
+	err := r.db.Preload("User").
+		Where("curse_id = ? AND status <> ?", curseID, domain.EnrollmentCancelled).
+		Find(&enrollments).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return enrollments, nil
+}
+
+func (r *repo) GetEnrollment(id string) (*domain.Enrollment, error) {
+	enrollment := domain.Enrollment{ID: id}
+
+	if err := r.db.First(&enrollment).Error; err != nil {
+		return nil, err
+	}
+
+	return &enrollment, nil
+}
+
+// Save guarda la asistencia, si el usuario ya tenia una marca en esa clase la reemplaza
+func (r *repo) Save(records []domain.Attendance) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	err := r.db.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"status", "note", "marked_by", "session_start"}),
+	}).Create(&records).Error
+	if err != nil {
+		r.log.Printf("error: %v", err)
+		return err
+	}
+
+	r.log.Printf("%d attendance records saved for session %s", len(records), records[0].SessionID)
+	return nil
+}
+
+func (r *repo) GetByCurse(curseID string) ([]domain.Attendance, error) {
+	var records []domain.Attendance
+
+	if err := r.db.Where("curse_id = ?", curseID).Order("session_start, user_id").Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func (r *repo) GetByEnrollment(enrollmentID string) ([]domain.Attendance, error) {
+	var records []domain.Attendance
+
+	if err := r.db.Where("enrollment_id = ?", enrollmentID).Order("session_start").Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
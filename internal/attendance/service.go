@@ -0,0 +1,375 @@
+package attendance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/audit"
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"github.com/MartinZitterkopf/gocurse_web/internal/instructor"
+	"github.com/MartinZitterkopf/gocurse_web/internal/session"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/auth"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidStatus = errors.New("invalid status, must be present, absent, late or excused")
+	// ErrNotEnrolled se devuelve al marcar a un usuario que no esta inscripto en el curso
+	ErrNotEnrolled = errors.New("user is not enrolled in this curse")
+	// ErrSessionCancelled se devuelve al marcar asistencia en una clase cancelada
+	ErrSessionCancelled = errors.New("session is cancelled")
+)
+
+const (
+	RuleFlag = "flag"
+	RuleFail = "fail"
+)
+
+type (
+	Service interface {
+		// Mark guarda la asistencia de una clase; status, si no es vacio, se aplica a todo el
+		// curso y marks lo reemplaza para los usuarios que incluya
+		Mark(ctx context.Context, curseID, sessionID, status string, marks []Mark) ([]domain.Attendance, error)
+		Matrix(curseID string) (*Matrix, error)
+		EnrollmentReport(enrollmentID string) (*Report, error)
+		// CanManage indica si el usuario puede tomar asistencia, es decir si es instructor del curso
+		CanManage(curseID, userID string) (bool, error)
+		// BelowThreshold devuelve por inscripcion si desaprueba por asistencia, solo con la regla fail
+		BelowThreshold(curseID string) (map[string]bool, error)
+	}
+
+	// Rule es la regla de asistencia minima; con Mode vacio no se aplica
+	Rule struct {
+		Mode    string
+		MinRate float64
+		// MinSessions evita evaluar a alguien que falto a la primera clase
+		MinSessions int
+	}
+
+	Mark struct {
+		UserID string `json:"user_id"`
+		Status string `json:"status"`
+		Note   string `json:"note"`
+	}
+
+	Summary struct {
+		Present int `json:"present"`
+		Late    int `json:"late"`
+		Absent  int `json:"absent"`
+		Excused int `json:"excused"`
+		// Rate es (presentes + tarde) / (marcadas - justificadas), nil si todavia no hay marcas
+		Rate           *float64 `json:"rate"`
+		BelowThreshold bool     `json:"below_threshold"`
+	}
+
+	MatrixSession struct {
+		ID       string    `json:"id"`
+		StartsAt time.Time `json:"starts_at"`
+		EndsAt   time.Time `json:"ends_at"`
+	}
+
+	MatrixRow struct {
+		EnrollmentID string `json:"enrollment_id"`
+		UserID       string `json:"user_id"`
+		FirstName    string `json:"first_name"`
+		LastName     string `json:"last_name"`
+		Status       string `json:"enrollment_status"`
+		// Sessions tiene el estado de cada clase por ID, las que no se marcaron no aparecen
+		Sessions map[string]string `json:"sessions"`
+		Summary  Summary           `json:"summary"`
+	}
+
+	Matrix struct {
+		Sessions []MatrixSession `json:"sessions"`
+		Rows     []MatrixRow     `json:"rows"`
+	}
+
+	Report struct {
+		EnrollmentID string              `json:"enrollment_id"`
+		CurseID      string              `json:"curse_id"`
+		UserID       string              `json:"user_id"`
+		Summary      Summary             `json:"summary"`
+		Records      []domain.Attendance `json:"records"`
+	}
+
+	service struct {
+		log         *log.Logger
+		repo        Repository
+		sessions    session.Service
+		instructors instructor.Service
+		rule        Rule
+	}
+)
+
+func NewService(l *log.Logger, r Repository, sessionSvc session.Service, instructorSvc instructor.Service, rule Rule) Service {
+	return &service{
+		log:         l,
+		repo:        r,
+		sessions:    sessionSvc,
+		instructors: instructorSvc,
+		rule:        rule,
+	}
+}
+
+// RuleFromEnv lee ATTENDANCE_RULE (flag o fail, vacio desactiva), ATTENDANCE_MIN_RATE (entre 0 y 1)
+// y ATTENDANCE_MIN_SESSIONS, por defecto 3
+func RuleFromEnv() (Rule, error) {
+	rule := Rule{Mode: os.Getenv("ATTENDANCE_RULE"), MinSessions: 3}
+
+	switch rule.Mode {
+	case "":
+		return rule, nil
+	case RuleFlag, RuleFail:
+	default:
+		return rule, fmt.Errorf("invalid ATTENDANCE_RULE %q, must be flag or fail", rule.Mode)
+	}
+
+	rate, err := strconv.ParseFloat(os.Getenv("ATTENDANCE_MIN_RATE"), 64)
+	if err != nil || rate <= 0 || rate > 1 {
+		return rule, fmt.Errorf("invalid ATTENDANCE_MIN_RATE %q, must be between 0 and 1", os.Getenv("ATTENDANCE_MIN_RATE"))
+	}
+	rule.MinRate = rate
+
+	if v := os.Getenv("ATTENDANCE_MIN_SESSIONS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return rule, fmt.Errorf("invalid ATTENDANCE_MIN_SESSIONS %q", v)
+		}
+		rule.MinSessions = n
+	}
+
+	return rule, nil
+}
+
+func (s service) Mark(ctx context.Context, curseID, sessionID, status string, marks []Mark) ([]domain.Attendance, error) {
+	occurrence, err := s.findSession(curseID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	roster, err := s.repo.GetRoster(curseID)
+	if err != nil {
+		return nil, err
+	}
+
+	byUser := make(map[string]domain.Enrollment, len(roster))
+	for _, e := range roster {
+		byUser[e.UserID] = e
+	}
+
+	statuses := map[string]Mark{}
+	if status != "" {
+		for _, e := range roster {
+			statuses[e.UserID] = Mark{UserID: e.UserID, Status: status}
+		}
+	}
+
+	for _, m := range marks {
+		if _, ok := byUser[m.UserID]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrNotEnrolled, m.UserID)
+		}
+		statuses[m.UserID] = m
+	}
+
+	actor := auth.Actor(ctx)
+	records := make([]domain.Attendance, 0, len(statuses))
+	for _, e := range roster {
+		m, ok := statuses[e.UserID]
+		if !ok {
+			continue
+		}
+
+		if !validStatus(m.Status) {
+			return nil, ErrInvalidStatus
+		}
+
+		records = append(records, domain.Attendance{
+			CurseID:      curseID,
+			SessionID:    occurrence.ID,
+			SessionStart: occurrence.StartsAt,
+			EnrollmentID: e.ID,
+			UserID:       e.UserID,
+			Status:       m.Status,
+			Note:         m.Note,
+			MarkedBy:     actor,
+		})
+	}
+
+	err = s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		if err := repo.Save(records); err != nil {
+			return err
+		}
+
+		return audit.Add(ctx, tx, audit.ActionUpdate, audit.EntityAttendance, occurrence.ID, nil, records)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func (s service) Matrix(curseID string) (*Matrix, error) {
+	occurrences, err := s.sessions.GetOccurrences(curseID, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	roster, err := s.repo.GetRoster(curseID)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := s.repo.GetByCurse(curseID)
+	if err != nil {
+		return nil, err
+	}
+
+	matrix := &Matrix{Sessions: []MatrixSession{}, Rows: []MatrixRow{}}
+	for _, o := range occurrences {
+		if o.Status == domain.OccurrenceCancelled {
+			continue
+		}
+		matrix.Sessions = append(matrix.Sessions, MatrixSession{ID: o.ID, StartsAt: o.StartsAt, EndsAt: o.EndsAt})
+	}
+
+	byEnrollment := map[string][]domain.Attendance{}
+	for _, r := range records {
+		byEnrollment[r.EnrollmentID] = append(byEnrollment[r.EnrollmentID], r)
+	}
+
+	for _, e := range roster {
+		row := MatrixRow{
+			EnrollmentID: e.ID,
+			UserID:       e.UserID,
+			Status:       e.Status,
+			Sessions:     map[string]string{},
+			Summary:      s.summarize(byEnrollment[e.ID]),
+		}
+
+		if e.User != nil {
+			row.FirstName = e.User.FirstName
+			row.LastName = e.User.LastName
+		}
+
+		for _, r := range byEnrollment[e.ID] {
+			row.Sessions[r.SessionID] = r.Status
+		}
+
+		matrix.Rows = append(matrix.Rows, row)
+	}
+
+	return matrix, nil
+}
+
+func (s service) EnrollmentReport(enrollmentID string) (*Report, error) {
+	enroll, err := s.repo.GetEnrollment(enrollmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := s.repo.GetByEnrollment(enrollmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Report{
+		EnrollmentID: enrollmentID,
+		CurseID:      enroll.CurseID,
+		UserID:       enroll.UserID,
+		Summary:      s.summarize(records),
+		Records:      records,
+	}, nil
+}
+
+func (s service) CanManage(curseID, userID string) (bool, error) {
+	return s.instructors.IsInstructor(curseID, userID)
+}
+
+func (s service) findSession(curseID, sessionID string) (*domain.Occurrence, error) {
+	occurrences, err := s.sessions.GetOccurrences(curseID, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, o := range occurrences {
+		if o.ID != sessionID {
+			continue
+		}
+
+		if o.Status == domain.OccurrenceCancelled {
+			return nil, ErrSessionCancelled
+		}
+		return &o, nil
+	}
+
+	return nil, gorm.ErrRecordNotFound
+}
+
+// BelowThreshold devuelve las inscripciones del curso que no llegan al minimo con la regla fail.
+// Se usa al cerrar las notas y no en cada Mark: una falta en las primeras clases o una marca
+// que despues se corrige no tiene que dejar a nadie desaprobado en medio del curso
+func (s service) BelowThreshold(curseID string) (map[string]bool, error) {
+	below := map[string]bool{}
+	if s.rule.Mode != RuleFail {
+		return below, nil
+	}
+
+	records, err := s.repo.GetByCurse(curseID)
+	if err != nil {
+		return nil, err
+	}
+
+	byEnrollment := map[string][]domain.Attendance{}
+	for _, r := range records {
+		byEnrollment[r.EnrollmentID] = append(byEnrollment[r.EnrollmentID], r)
+	}
+
+	for id, records := range byEnrollment {
+		if s.summarize(records).BelowThreshold {
+			below[id] = true
+		}
+	}
+
+	return below, nil
+}
+
+func (s service) summarize(records []domain.Attendance) Summary {
+	var summary Summary
+	for _, r := range records {
+		switch r.Status {
+		case domain.AttendancePresent:
+			summary.Present++
+		case domain.AttendanceLate:
+			summary.Late++
+		case domain.AttendanceAbsent:
+			summary.Absent++
+		case domain.AttendanceExcused:
+			summary.Excused++
+		}
+	}
+
+	counted := summary.Present + summary.Late + summary.Absent
+	if counted == 0 {
+		return summary
+	}
+
+	rate := float64(summary.Present+summary.Late) / float64(counted)
+	summary.Rate = &rate
+	summary.BelowThreshold = s.rule.Mode != "" && counted >= s.rule.MinSessions && rate < s.rule.MinRate
+
+	return summary
+}
+
+func validStatus(status string) bool {
+	switch status {
+	case domain.AttendancePresent, domain.AttendanceAbsent, domain.AttendanceLate, domain.AttendanceExcused:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/MartinZitterkopf/gocurse_web/pkg/auth"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/meta"
+)
+
+type (
+	Controller func(w http.ResponseWriter, r *http.Request)
+
+	Endpoints struct {
+		GetAll Controller
+	}
+
+	Response struct {
+		Status int         `json:"status"`
+		Data   interface{} `json:"data,omitempty"`
+		Err    string      `json:"error,omitempty"`
+		Meta   *meta.Meta  `json:"meta,omitempty"`
+	}
+)
+
+func MakeEndpoints(s Service) Endpoints {
+	return Endpoints{
+		GetAll: makeGetAllEndpoint(s),
+	}
+}
+
+func makeGetAllEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !auth.IsAdmin(r) {
+			w.WriteHeader(403)
+			json.NewEncoder(w).Encode(&Response{Status: 403, Err: "only admins can read the audit log"})
+			return
+		}
+
+		v := r.URL.Query()
+		filters := Fillters{
+			EntityType: v.Get("entity"),
+			EntityID:   v.Get("id"),
+			Actor:      v.Get("actor"),
+			Action:     v.Get("action"),
+		}
+
+		page, limit, err := meta.Params(v)
+		if err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
+			return
+		}
+
+		count, err := s.Count(filters)
+		if err != nil {
+			w.WriteHeader(500)
+			json.NewEncoder(w).Encode(&Response{Status: 500, Err: err.Error()})
+			return
+		}
+
+		meta, err := meta.New(page, limit, count)
+		if err != nil {
+			w.WriteHeader(500)
+			json.NewEncoder(w).Encode(&Response{Status: 500, Err: err.Error()})
+			return
+		}
+
+		entries, err := s.GetAll(filters, meta.Offset(), meta.Limit())
+		if err != nil {
+			w.WriteHeader(500)
+			json.NewEncoder(w).Encode(&Response{Status: 500, Err: err.Error()})
+			return
+		}
+
+		meta.SetLinkHeader(w, r)
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: entries, Meta: meta})
+	}
+}
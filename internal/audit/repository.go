@@ -0,0 +1,73 @@
+package audit
+
+import (
+	"log"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"gorm.io/gorm"
+)
+
+type (
+	Repository interface {
+		GetAll(filters Fillters, offset, limit int) ([]domain.AuditLog, error)
+		Count(filters Fillters) (int, error)
+	}
+
+	repo struct {
+		log *log.Logger
+		db  *gorm.DB
+	}
+)
+
+func NewRepo(l *log.Logger, db *gorm.DB) Repository {
+	return &repo{
+		log: l,
+		db:  db,
+	}
+}
+
+func (r *repo) GetAll(filters Fillters, offset, limit int) ([]domain.AuditLog, error) {
+	var entries []domain.AuditLog
+
+	tx := r.db.Model(&entries)
+	tx = applyFilters(tx, filters)
+	tx = tx.Limit(limit).Offset(offset)
+
+	if err := tx.Order("created_at desc, id desc").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (r *repo) Count(filters Fillters) (int, error) {
+	var count int64
+	tx := r.db.Model(domain.AuditLog{})
+	tx = applyFilters(tx, filters)
+
+	if err := tx.Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	return int(count), nil
+}
+
+func applyFilters(tx *gorm.DB, filters Fillters) *gorm.DB {
+	if filters.EntityType != "" {
+		tx = tx.Where("entity_type = ?", filters.EntityType)
+	}
+
+	if filters.EntityID != "" {
+		tx = tx.Where("entity_id = ?", filters.EntityID)
+	}
+
+	if filters.Actor != "" {
+		tx = tx.Where("actor = ?", filters.Actor)
+	}
+
+	if filters.Action != "" {
+		tx = tx.Where("action = ?", filters.Action)
+	}
+
+	return tx
+}
@@ -0,0 +1,136 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"reflect"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/auth"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/requestid"
+	"gorm.io/gorm"
+)
+
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	ActionPurge   = "purge"
+
+	EntityUser          = "user"
+	EntityCurse         = "curse"
+	EntityEnrollment    = "enrollment"
+	EntityInstructor    = "curse_instructor"
+	EntitySchedule      = "curse_schedule"
+	EntitySession       = "curse_session"
+	EntityAttendance    = "attendance"
+	EntityAssessment    = "assessment"
+	EntityScore         = "score"
+	EntityGradingPolicy = "grading_policy"
+	EntityFinalGrade    = "final_grade"
+	EntityPrerequisite  = "curse_prerequisite"
+	EntityCategory      = "category"
+)
+
+// maxActor es el largo de la columna actor, uno mas largo haria fallar el insert
+const maxActor = 64
+
+type (
+	Service interface {
+		GetAll(filters Fillters, offset, limit int) ([]domain.AuditLog, error)
+		Count(filters Fillters) (int, error)
+	}
+
+	service struct {
+		log  *log.Logger
+		repo Repository
+	}
+
+	Fillters struct {
+		EntityType string
+		EntityID   string
+		Actor      string
+		Action     string
+	}
+
+	Change struct {
+		Before interface{} `json:"before"`
+		After  interface{} `json:"after"`
+	}
+)
+
+func NewService(l *log.Logger, r Repository) Service {
+	return &service{
+		log:  l,
+		repo: r,
+	}
+}
+
+func (s service) GetAll(filters Fillters, offset, limit int) ([]domain.AuditLog, error) {
+	return s.repo.GetAll(filters, offset, limit)
+}
+
+func (s service) Count(filters Fillters) (int, error) {
+	return s.repo.Count(filters)
+}
+
+// Add guarda quien hizo la accion y que campos cambiaron entre before y after usando tx, que
+// tiene que ser la misma transaccion del cambio: si la auditoria falla el cambio se deshace
+func Add(ctx context.Context, tx *gorm.DB, action, entityType, entityID string, before, after interface{}) error {
+	changes, err := json.Marshal(Diff(before, after))
+	if err != nil {
+		return err
+	}
+
+	actor := auth.Actor(ctx)
+	if len(actor) > maxActor {
+		actor = actor[:maxActor]
+	}
+
+	return tx.Create(&domain.AuditLog{
+		Actor:      actor,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Changes:    changes,
+		RequestID:  requestid.FromContext(ctx),
+	}).Error
+}
+
+// Diff compara los campos json de before y after y devuelve solo los que cambiaron.
+// Si before es nil (alta) o after es nil (baja) se devuelven todos los campos.
+func Diff(before, after interface{}) map[string]Change {
+	b, a := toMap(before), toMap(after)
+
+	diff := make(map[string]Change)
+	for k, v := range b {
+		if !reflect.DeepEqual(v, a[k]) {
+			diff[k] = Change{Before: v, After: a[k]}
+		}
+	}
+
+	for k, v := range a {
+		if _, ok := b[k]; !ok {
+			diff[k] = Change{After: v}
+		}
+	}
+
+	return diff
+}
+
+func toMap(v interface{}) map[string]interface{} {
+	m := make(map[string]interface{})
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return m
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return m
+	}
+
+	json.Unmarshal(data, &m)
+	return m
+}
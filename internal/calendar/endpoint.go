@@ -0,0 +1,124 @@
+package calendar
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/MartinZitterkopf/gocurse_web/pkg/auth"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/ical"
+	"github.com/gorilla/mux"
+)
+
+type (
+	Controller func(w http.ResponseWriter, r *http.Request)
+
+	Endpoints struct {
+		CurseFeed   Controller
+		UserFeed    Controller
+		RotateToken Controller
+	}
+
+	TokenResponse struct {
+		Token string `json:"token"`
+		URL   string `json:"url"`
+	}
+
+	Response struct {
+		Status int         `json:"status"`
+		Data   interface{} `json:"data,omitempty"`
+		Err    string      `json:"error,omitempty"`
+	}
+)
+
+func MakeEndpoints(s Service) Endpoints {
+	return Endpoints{
+		CurseFeed:   makeCurseFeedEndpoint(s),
+		UserFeed:    makeUserFeedEndpoint(s),
+		RotateToken: makeRotateTokenEndpoint(s),
+	}
+}
+
+func makeCurseFeedEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		calendar, err := s.CurseFeed(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(404)
+			json.NewEncoder(w).Encode(&Response{Status: 404, Err: "curse doesn't exist"})
+			return
+		}
+
+		write(w, calendar)
+	}
+}
+
+// el calendario de un usuario lo ve el mismo usuario autenticado con su api key, un administrador
+// o quien tenga el token privado en ?token=, que es lo que usan las aplicaciones de calendario
+func makeUserFeedEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+
+		if !auth.IsAdmin(r) && auth.UserID(r) != id {
+			ok, err := s.CheckToken(id, r.URL.Query().Get("token"))
+			if err != nil {
+				w.WriteHeader(500)
+				json.NewEncoder(w).Encode(&Response{Status: 500, Err: err.Error()})
+				return
+			}
+
+			if !ok {
+				w.WriteHeader(403)
+				json.NewEncoder(w).Encode(&Response{Status: 403, Err: "invalid calendar token"})
+				return
+			}
+		}
+
+		calendar, err := s.UserFeed(id)
+		if err != nil {
+			w.WriteHeader(404)
+			json.NewEncoder(w).Encode(&Response{Status: 404, Err: "user doesn't exist"})
+			return
+		}
+
+		write(w, calendar)
+	}
+}
+
+func makeRotateTokenEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+
+		if !auth.IsAdmin(r) && auth.UserID(r) != id {
+			w.WriteHeader(403)
+			json.NewEncoder(w).Encode(&Response{Status: 403, Err: "you can only manage your own calendar token"})
+			return
+		}
+
+		token, err := s.RotateToken(r.Context(), id)
+		if err != nil {
+			w.WriteHeader(404)
+			json.NewEncoder(w).Encode(&Response{Status: 404, Err: "user doesn't exist"})
+			return
+		}
+
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+
+		feed := url.URL{
+			Scheme:   scheme,
+			Host:     r.Host,
+			Path:     "/users/" + id + "/calendar.ics",
+			RawQuery: url.Values{"token": {token}}.Encode(),
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: TokenResponse{Token: token, URL: feed.String()}})
+	}
+}
+
+func write(w http.ResponseWriter, calendar *ical.Calendar) {
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Header().Set("Content-Disposition", `inline; filename="calendar.ics"`)
+	calendar.Encode(w)
+}
@@ -0,0 +1,64 @@
+package calendar
+
+import (
+	"errors"
+	"log"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type (
+	Repository interface {
+		// GetEnrolledCurses devuelve los cursos con inscripcion activa del usuario
+		GetEnrolledCurses(userID string) ([]domain.Curse, error)
+		SaveToken(token *domain.CalendarToken) error
+		GetTokenHash(userID string) (string, error)
+	}
+
+	repo struct {
+		log *log.Logger
+		db  *gorm.DB
+	}
+)
+
+func NewRepo(l *log.Logger, db *gorm.DB) Repository {
+	return &repo{
+		log: l,
+		db:  db,
+	}
+}
+
+func (r *repo) GetEnrolledCurses(userID string) ([]domain.Curse, error) {
+	var curses []domain.Curse
+
+	err := r.db.Joins("JOIN enrollments ON enrollments.curse_id = curses.id").
+		Where("enrollments.user_id = ? AND enrollments.status IN ?", userID, domain.EnrollmentActiveStatuses).
+		Order("curses.start_date, curses.id").Find(&curses).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return curses, nil
+}
+
+// SaveToken reemplaza el token anterior, asi la URL vieja deja de funcionar
+func (r *repo) SaveToken(token *domain.CalendarToken) error {
+	return r.db.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"token_hash", "created_at"}),
+	}).Create(token).Error
+}
+
+func (r *repo) GetTokenHash(userID string) (string, error) {
+	var token domain.CalendarToken
+
+	if err := r.db.Where("user_id = ?", userID).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return token.TokenHash, nil
+}
@@ -0,0 +1,166 @@
+package calendar
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/curse"
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"github.com/MartinZitterkopf/gocurse_web/internal/session"
+	"github.com/MartinZitterkopf/gocurse_web/internal/user"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/ical"
+)
+
+const (
+	prodID = "-//gocurse_web//Curses//EN"
+	// uidDomain hace que los UID sean unicos fuera de esta aplicacion, como pide la RFC 5545
+	uidDomain = "gocurse_web"
+)
+
+type (
+	Service interface {
+		CurseFeed(curseID string) (*ical.Calendar, error)
+		UserFeed(userID string) (*ical.Calendar, error)
+		// RotateToken genera un token nuevo para la URL privada e invalida el anterior
+		RotateToken(ctx context.Context, userID string) (string, error)
+		CheckToken(userID, token string) (bool, error)
+	}
+
+	service struct {
+		log            *log.Logger
+		repo           Repository
+		userService    user.Service
+		curseService   curse.Service
+		sessionService session.Service
+	}
+)
+
+func NewService(l *log.Logger, r Repository, userSvc user.Service, curseSvc curse.Service, sessionSvc session.Service) Service {
+	return &service{
+		log:            l,
+		repo:           r,
+		userService:    userSvc,
+		curseService:   curseSvc,
+		sessionService: sessionSvc,
+	}
+}
+
+func (s service) CurseFeed(curseID string) (*ical.Calendar, error) {
+	c, err := s.curseService.GetByID(curseID)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := s.events(*c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ical.Calendar{ProdID: prodID, Name: c.Name, Events: events}, nil
+}
+
+func (s service) UserFeed(userID string) (*ical.Calendar, error) {
+	u, err := s.userService.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	curses, err := s.repo.GetEnrolledCurses(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	calendar := &ical.Calendar{ProdID: prodID, Name: u.FirstName + " " + u.LastName}
+	for _, c := range curses {
+		events, err := s.events(c)
+		if err != nil {
+			return nil, err
+		}
+		calendar.Events = append(calendar.Events, events...)
+	}
+
+	return calendar, nil
+}
+
+func (s service) RotateToken(ctx context.Context, userID string) (string, error) {
+	if _, err := s.userService.Get(userID); err != nil {
+		return "", err
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	token := hex.EncodeToString(b)
+	if err := s.repo.SaveToken(&domain.CalendarToken{UserID: userID, TokenHash: hash(token)}); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (s service) CheckToken(userID, token string) (bool, error) {
+	if token == "" {
+		return false, nil
+	}
+
+	stored, err := s.repo.GetTokenHash(userID)
+	if err != nil || stored == "" {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(hash(token))) == 1, nil
+}
+
+// events arma un evento por clase; un curso sin clases cargadas se muestra como un
+// evento de dia completo entre sus fechas
+func (s service) events(c domain.Curse) ([]ical.Event, error) {
+	occurrences, err := s.sessionService.GetOccurrences(c.ID, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(occurrences) == 0 {
+		return []ical.Event{{
+			UID:      c.ID + "@" + uidDomain,
+			Summary:  c.Name,
+			Start:    c.StartDate,
+			End:      c.EndDate.AddDate(0, 0, 1),
+			AllDay:   true,
+			Sequence: c.Version - 1,
+			Modified: c.UpdateAt,
+		}}, nil
+	}
+
+	events := make([]ical.Event, 0, len(occurrences))
+	for _, o := range occurrences {
+		event := ical.Event{
+			UID:         o.ID + "@" + uidDomain,
+			Summary:     c.Name,
+			Description: o.Note,
+			Start:       o.StartsAt,
+			End:         o.EndsAt,
+			Status:      ical.StatusConfirmed,
+			// la revision sube con cada cambio para que el cliente reemplace su copia
+			Sequence: o.Revision,
+		}
+
+		if o.Status == domain.OccurrenceCancelled {
+			event.Status = ical.StatusCancelled
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
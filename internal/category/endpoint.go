@@ -0,0 +1,155 @@
+package category
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/MartinZitterkopf/gocurse_web/pkg/auth"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type (
+	Controller func(w http.ResponseWriter, r *http.Request)
+
+	Endpoints struct {
+		Create Controller
+		GetAll Controller
+		Get    Controller
+		Update Controller
+		Delete Controller
+	}
+
+	CreateReq struct {
+		Name     string  `json:"name"`
+		Slug     string  `json:"slug"`
+		ParentID *string `json:"parent_id"`
+	}
+
+	// UpdateReq con parent_id vacio mueve la categoria a la raiz
+	UpdateReq struct {
+		Name     *string `json:"name"`
+		Slug     *string `json:"slug"`
+		ParentID *string `json:"parent_id"`
+	}
+
+	Response struct {
+		Status int         `json:"status"`
+		Data   interface{} `json:"data,omitempty"`
+		Err    string      `json:"error,omitempty"`
+	}
+)
+
+func MakeEndpoints(s Service) Endpoints {
+	return Endpoints{
+		Create: adminOnly(makeCreateEndpoint(s)),
+		GetAll: makeGetAllEndpoint(s),
+		Get:    makeGetEndpoint(s),
+		Update: adminOnly(makeUpdateEndpoint(s)),
+		Delete: adminOnly(makeDeleteEndpoint(s)),
+	}
+}
+
+// el arbol de categorias es publico, solo un administrador lo modifica
+func adminOnly(next Controller) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !auth.IsAdmin(r) {
+			w.WriteHeader(403)
+			json.NewEncoder(w).Encode(&Response{Status: 403, Err: "only admins can manage categories"})
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func makeCreateEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req CreateReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "invalid request format"})
+			return
+		}
+
+		category, err := s.Create(r.Context(), req.Name, req.Slug, req.ParentID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		w.WriteHeader(201)
+		json.NewEncoder(w).Encode(&Response{Status: 201, Data: category})
+	}
+}
+
+func makeGetAllEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		categories, err := s.GetTree()
+		if err != nil {
+			w.WriteHeader(500)
+			json.NewEncoder(w).Encode(&Response{Status: 500, Err: err.Error()})
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: categories})
+	}
+}
+
+func makeGetEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		category, err := s.Get(mux.Vars(r)["id"])
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: category})
+	}
+}
+
+func makeUpdateEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req UpdateReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "invalid request format"})
+			return
+		}
+
+		category, err := s.Update(r.Context(), mux.Vars(r)["id"], req.Name, req.Slug, req.ParentID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: category})
+	}
+}
+
+func makeDeleteEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.Delete(r.Context(), mux.Vars(r)["id"]); err != nil {
+			writeError(w, err)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: "success"})
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := 500
+	switch {
+	case errors.Is(err, ErrInvalidCategory):
+		status = 400
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		status = 404
+	case errors.Is(err, ErrDuplicateSlug), errors.Is(err, ErrCategoryCycle), errors.Is(err, ErrCategoryInUse):
+		status = 409
+	}
+
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&Response{Status: status, Err: err.Error()})
+}
@@ -0,0 +1,128 @@
+package category
+
+import (
+	"log"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"gorm.io/gorm"
+)
+
+type (
+	Repository interface {
+		// Transaction corre fn con un Repository que usa tx, la transaccion que tambien recibe fn
+		Transaction(fn func(repo Repository, tx *gorm.DB) error) error
+		Create(category *domain.Category) error
+		GetAll() ([]domain.Category, error)
+		Get(id string) (*domain.Category, error)
+		GetBySlug(slug string) (*domain.Category, error)
+		Update(id string, values map[string]interface{}) error
+		Delete(id string) error
+		CountChildren(id string) (int, error)
+		// CountCurses cuenta tambien los cursos borrados, que se pueden restaurar con su categoria
+		CountCurses(id string) (int, error)
+	}
+
+	repo struct {
+		log *log.Logger
+		db  *gorm.DB
+	}
+)
+
+func NewRepo(l *log.Logger, db *gorm.DB) Repository {
+	return &repo{
+		log: l,
+		db:  db,
+	}
+}
+
+func (r *repo) Transaction(fn func(repo Repository, tx *gorm.DB) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		txRepo := *r
+		txRepo.db = tx
+		return fn(&txRepo, tx)
+	})
+}
+
+func (r *repo) Create(category *domain.Category) error {
+	if err := r.db.Create(category).Error; err != nil {
+		r.log.Printf("error: %v", err)
+		return err
+	}
+
+	r.log.Println("category created with id: ", category.ID)
+	return nil
+}
+
+func (r *repo) GetAll() ([]domain.Category, error) {
+	var categories []domain.Category
+
+	if err := r.db.Order("name").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	return categories, nil
+}
+
+func (r *repo) Get(id string) (*domain.Category, error) {
+	category := domain.Category{ID: id}
+
+	if err := r.db.First(&category).Error; err != nil {
+		return nil, err
+	}
+
+	return &category, nil
+}
+
+func (r *repo) GetBySlug(slug string) (*domain.Category, error) {
+	var category domain.Category
+
+	if err := r.db.Where("slug = ?", slug).First(&category).Error; err != nil {
+		return nil, err
+	}
+
+	return &category, nil
+}
+
+func (r *repo) Update(id string, values map[string]interface{}) error {
+	result := r.db.Model(&domain.Category{}).Where("id = ?", id).Updates(values)
+	if result.Error != nil {
+		r.log.Printf("error: %v", result.Error)
+		return result.Error
+	}
+
+	return nil
+}
+
+func (r *repo) Delete(id string) error {
+	result := r.db.Delete(&domain.Category{ID: id})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	r.log.Println("category deleted with id: ", id)
+	return nil
+}
+
+func (r *repo) CountChildren(id string) (int, error) {
+	var count int64
+
+	if err := r.db.Model(&domain.Category{}).Where("parent_id = ?", id).Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	return int(count), nil
+}
+
+func (r *repo) CountCurses(id string) (int, error) {
+	var count int64
+
+	if err := r.db.Unscoped().Model(&domain.Curse{}).Where("category_id = ?", id).Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	return int(count), nil
+}
@@ -0,0 +1,279 @@
+package category
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/audit"
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidCategory = errors.New("invalid category")
+	// ErrDuplicateSlug se devuelve cuando otra categoria ya usa el slug
+	ErrDuplicateSlug = errors.New("slug is already in use")
+	// ErrCategoryCycle se devuelve al mover una categoria dentro de si misma o de una de sus subcategorias
+	ErrCategoryCycle = errors.New("a category can't be moved under itself")
+	// ErrCategoryInUse se devuelve al borrar una categoria con subcategorias o cursos
+	ErrCategoryInUse = errors.New("category has subcategories or curses")
+)
+
+var (
+	slugValid  = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	slugSpaces = regexp.MustCompile(`[^a-z0-9]+`)
+	unaccent   = strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u", "ñ", "n", "ç", "c",
+		"à", "a", "è", "e", "ì", "i", "ò", "o", "ù", "u", "â", "a", "ê", "e", "î", "i", "ô", "o", "û", "u", "ã", "a", "õ", "o")
+)
+
+type (
+	Service interface {
+		Create(ctx context.Context, name, slug string, parentID *string) (*domain.Category, error)
+		// GetTree devuelve las categorias raiz con sus subcategorias en Children
+		GetTree() ([]domain.Category, error)
+		Get(id string) (*domain.Category, error)
+		// Update mueve la categoria a la raiz si parentID es vacio
+		Update(ctx context.Context, id string, name, slug, parentID *string) (*domain.Category, error)
+		Delete(ctx context.Context, id string) error
+	}
+
+	service struct {
+		log  *log.Logger
+		repo Repository
+	}
+)
+
+func NewService(l *log.Logger, r Repository) Service {
+	return &service{
+		log:  l,
+		repo: r,
+	}
+}
+
+func (s service) Create(ctx context.Context, name, slug string, parentID *string) (*domain.Category, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 60 {
+		return nil, fmt.Errorf("%w: name is required and can't be longer than 60 characters", ErrInvalidCategory)
+	}
+
+	if slug == "" {
+		slug = Slugify(name)
+	}
+
+	if err := s.checkSlug("", slug); err != nil {
+		return nil, err
+	}
+
+	category := &domain.Category{Name: name, Slug: slug}
+	if parentID != nil && *parentID != "" {
+		if _, err := s.repo.Get(*parentID); err != nil {
+			return nil, fmt.Errorf("parent category: %w", err)
+		}
+		category.ParentID = parentID
+	}
+
+	err := s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		if err := repo.Create(category); err != nil {
+			return err
+		}
+
+		return audit.Add(ctx, tx, audit.ActionCreate, audit.EntityCategory, category.ID, nil, category)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return category, nil
+}
+
+func (s service) GetTree() ([]domain.Category, error) {
+	categories, err := s.repo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[string][]domain.Category)
+	for _, c := range categories {
+		if c.ParentID != nil {
+			children[*c.ParentID] = append(children[*c.ParentID], c)
+		}
+	}
+
+	var build func(c domain.Category) domain.Category
+	build = func(c domain.Category) domain.Category {
+		for _, child := range children[c.ID] {
+			c.Children = append(c.Children, build(child))
+		}
+		return c
+	}
+
+	tree := []domain.Category{}
+	for _, c := range categories {
+		if c.ParentID == nil {
+			tree = append(tree, build(c))
+		}
+	}
+
+	return tree, nil
+}
+
+func (s service) Get(id string) (*domain.Category, error) {
+	tree, err := s.GetTree()
+	if err != nil {
+		return nil, err
+	}
+
+	if c := find(tree, id); c != nil {
+		return c, nil
+	}
+
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (s service) Update(ctx context.Context, id string, name, slug, parentID *string) (*domain.Category, error) {
+	before, err := s.repo.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]interface{})
+
+	if name != nil {
+		n := strings.TrimSpace(*name)
+		if n == "" || len(n) > 60 {
+			return nil, fmt.Errorf("%w: name is required and can't be longer than 60 characters", ErrInvalidCategory)
+		}
+		values["name"] = n
+	}
+
+	if slug != nil {
+		if err := s.checkSlug(id, *slug); err != nil {
+			return nil, err
+		}
+		values["slug"] = *slug
+	}
+
+	if parentID != nil {
+		if *parentID == "" {
+			values["parent_id"] = nil
+		} else {
+			if err := s.checkParent(id, *parentID); err != nil {
+				return nil, err
+			}
+			values["parent_id"] = *parentID
+		}
+	}
+
+	var after *domain.Category
+	err = s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		if len(values) > 0 {
+			if err := repo.Update(id, values); err != nil {
+				return err
+			}
+		}
+
+		after, err = repo.Get(id)
+		if err != nil {
+			return err
+		}
+
+		return audit.Add(ctx, tx, audit.ActionUpdate, audit.EntityCategory, id, before, after)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return after, nil
+}
+
+func (s service) Delete(ctx context.Context, id string) error {
+	before, err := s.repo.Get(id)
+	if err != nil {
+		return err
+	}
+
+	children, err := s.repo.CountChildren(id)
+	if err != nil {
+		return err
+	}
+
+	curses, err := s.repo.CountCurses(id)
+	if err != nil {
+		return err
+	}
+
+	if children > 0 || curses > 0 {
+		return fmt.Errorf("%w: %d subcategories, %d curses", ErrCategoryInUse, children, curses)
+	}
+
+	return s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		if err := repo.Delete(id); err != nil {
+			return err
+		}
+
+		return audit.Add(ctx, tx, audit.ActionDelete, audit.EntityCategory, id, before, nil)
+	})
+}
+
+func (s service) checkSlug(id, slug string) error {
+	if !slugValid.MatchString(slug) || len(slug) > 80 {
+		return fmt.Errorf("%w: slug can only have lowercase letters, numbers and dashes", ErrInvalidCategory)
+	}
+
+	existing, err := s.repo.GetBySlug(slug)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return nil
+	case err != nil:
+		return err
+	case existing.ID != id:
+		return ErrDuplicateSlug
+	}
+
+	return nil
+}
+
+// checkParent sube desde el nuevo padre hasta la raiz, si pasa por la categoria es un ciclo
+func (s service) checkParent(id, parentID string) error {
+	for current := parentID; current != ""; {
+		if current == id {
+			return ErrCategoryCycle
+		}
+
+		parent, err := s.repo.Get(current)
+		if err != nil {
+			return fmt.Errorf("parent category: %w", err)
+		}
+
+		current = ""
+		if parent.ParentID != nil {
+			current = *parent.ParentID
+		}
+	}
+
+	return nil
+}
+
+// Slugify arma el slug a partir del nombre: "Diseño Web" queda "diseno-web"
+func Slugify(name string) string {
+	slug := unaccent.Replace(strings.ToLower(name))
+	slug = slugSpaces.ReplaceAllString(slug, "-")
+	return strings.Trim(slug, "-")
+}
+
+func find(categories []domain.Category, id string) *domain.Category {
+	for i := range categories {
+		if categories[i].ID == id {
+			return &categories[i]
+		}
+
+		if c := find(categories[i].Children, id); c != nil {
+			return c
+		}
+	}
+	return nil
+}
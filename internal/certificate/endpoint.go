@@ -0,0 +1,124 @@
+package certificate
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/MartinZitterkopf/gocurse_web/pkg/auth"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/meta"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/pdf"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type (
+	Controller func(w http.ResponseWriter, r *http.Request)
+
+	Endpoints struct {
+		Download Controller
+		Verify   Controller
+	}
+
+	// VerifyResponse es lo que se muestra publicamente, sin los IDs internos del usuario y el curso
+	VerifyResponse struct {
+		Valid         bool       `json:"valid"`
+		CertificateID string     `json:"certificate_id,omitempty"`
+		HolderName    string     `json:"holder_name,omitempty"`
+		CurseName     string     `json:"curse_name,omitempty"`
+		StartDate     *time.Time `json:"start_date,omitempty"`
+		EndDate       *time.Time `json:"end_date,omitempty"`
+		IssuedAt      *time.Time `json:"issued_at,omitempty"`
+	}
+
+	Response struct {
+		Status int         `json:"status"`
+		Data   interface{} `json:"data,omitempty"`
+		Err    string      `json:"error,omitempty"`
+		Meta   *meta.Meta  `json:"meta,omitempty"`
+	}
+)
+
+func MakeEndpoints(s Service) Endpoints {
+	return Endpoints{
+		Download: makeDownloadEndpoint(s),
+		Verify:   makeVerifyEndpoint(s),
+	}
+}
+
+// solo el propio alumno o un administrador pueden descargar el certificado. Se autoriza antes
+// de emitirlo y a los demas siempre se les responde 403, exista o no la inscripcion
+func makeDownloadEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+
+		owner, err := s.Owner(id)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(500)
+			json.NewEncoder(w).Encode(&Response{Status: 500, Err: err.Error()})
+			return
+		}
+
+		if !auth.IsAdmin(r) && (err != nil || auth.UserID(r) == "" || auth.UserID(r) != owner) {
+			w.WriteHeader(403)
+			json.NewEncoder(w).Encode(&Response{Status: 403, Err: "you can only download your own certificates"})
+			return
+		}
+
+		c, err := s.Issue(r.Context(), id)
+		if err != nil {
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				w.WriteHeader(404)
+				json.NewEncoder(w).Encode(&Response{Status: 404, Err: "enrollment doesn't exist"})
+			case errors.Is(err, ErrNotCompleted):
+				w.WriteHeader(409)
+				json.NewEncoder(w).Encode(&Response{Status: 409, Err: err.Error()})
+			default:
+				w.WriteHeader(500)
+				json.NewEncoder(w).Encode(&Response{Status: 500, Err: err.Error()})
+			}
+			return
+		}
+
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		verify := url.URL{Scheme: scheme, Host: r.Host, Path: "/certificates/" + c.Code + "/verify"}
+
+		w.Header().Set("Content-Type", pdf.ContentType)
+		w.Header().Set("Content-Disposition", `inline; filename="certificate-`+c.Code+`.pdf"`)
+		Render(c, verify.String()).Write(w)
+	}
+}
+
+// es publico, cualquiera con el codigo puede validar el certificado
+func makeVerifyEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, err := s.Verify(mux.Vars(r)["code"])
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, ErrInvalidCode) {
+				w.WriteHeader(404)
+				json.NewEncoder(w).Encode(&Response{Status: 404, Data: VerifyResponse{Valid: false}, Err: "certificate not found or invalid"})
+				return
+			}
+
+			w.WriteHeader(500)
+			json.NewEncoder(w).Encode(&Response{Status: 500, Err: err.Error()})
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: VerifyResponse{
+			Valid:         true,
+			CertificateID: c.ID,
+			HolderName:    c.HolderName,
+			CurseName:     c.CurseName,
+			StartDate:     &c.StartDate,
+			EndDate:       &c.EndDate,
+			IssuedAt:      &c.IssuedAt,
+		}})
+	}
+}
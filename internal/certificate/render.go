@@ -0,0 +1,41 @@
+package certificate
+
+import (
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/pdf"
+)
+
+var (
+	black  = pdf.Color{}
+	gray   = pdf.Color{R: 0.4, G: 0.4, B: 0.4}
+	accent = pdf.Color{R: 0.12, G: 0.29, B: 0.49}
+)
+
+// Render arma el certificado en una hoja A4 apaisada; verifyURL es la direccion publica para validarlo
+func Render(c *domain.Certificate, verifyURL string) *pdf.Document {
+	doc := pdf.New(pdf.A4Height, pdf.A4Width)
+	doc.Title = "Certificate of Completion - " + c.CurseName
+
+	page := doc.AddPage()
+	w, h := doc.Width, doc.Height
+
+	page.Rect(24, 24, w-48, h-48, 3, accent)
+	page.Rect(32, 32, w-64, h-64, 0.75, accent)
+
+	page.TextCenter(h-120, pdf.HelveticaBold, 34, accent, "Certificate of Completion")
+	page.TextCenter(h-175, pdf.Helvetica, 14, gray, "This is to certify that")
+	page.TextCenter(h-225, pdf.HelveticaBold, 30, black, c.HolderName)
+	page.Line(w/2-180, h-237, w/2+180, h-237, 0.75, gray)
+	page.TextCenter(h-275, pdf.Helvetica, 14, gray, "has successfully completed the curse")
+	page.TextCenter(h-315, pdf.HelveticaBold, 22, black, c.CurseName)
+	page.TextCenter(h-345, pdf.Helvetica, 12, gray,
+		"held from "+c.StartDate.Format("January 2, 2006")+" to "+c.EndDate.Format("January 2, 2006"))
+
+	page.Text(70, 110, pdf.Helvetica, 11, black, "Issued on "+c.IssuedAt.Format("January 2, 2006"))
+	page.Text(70, 92, pdf.Helvetica, 9, gray, "Certificate ID: "+c.ID)
+
+	page.Text(w-70-pdf.TextWidth(pdf.HelveticaBold, 11, "Verification code: "+c.Code), 110, pdf.HelveticaBold, 11, black, "Verification code: "+c.Code)
+	page.Text(w-70-pdf.TextWidth(pdf.HelveticaOblique, 9, verifyURL), 92, pdf.HelveticaOblique, 9, gray, verifyURL)
+
+	return doc
+}
@@ -0,0 +1,78 @@
+package certificate
+
+import (
+	"log"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type (
+	Repository interface {
+		// GetEnrollment trae la inscripcion con el usuario y el curso, aunque el curso este borrado
+		GetEnrollment(id string) (*domain.Enrollment, error)
+		// Create no hace nada si la inscripcion ya tenia certificado
+		Create(certificate *domain.Certificate) error
+		GetByEnrollment(enrollmentID string) (*domain.Certificate, error)
+		GetByCode(code string) (*domain.Certificate, error)
+	}
+
+	repo struct {
+		log *log.Logger
+		db  *gorm.DB
+	}
+)
+
+func NewRepo(l *log.Logger, db *gorm.DB) Repository {
+	return &repo{
+		log: l,
+		db:  db,
+	}
+}
+
+func (r *repo) GetEnrollment(id string) (*domain.Enrollment, error) {
+	enrollment := domain.Enrollment{ID: id}
+
+	err := r.db.Preload("User").
+		Preload("Curse", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		First(&enrollment).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &enrollment, nil
+}
+
+func (r *repo) Create(certificate *domain.Certificate) error {
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(certificate)
+	if result.Error != nil {
+		r.log.Printf("error: %v", result.Error)
+		return result.Error
+	}
+
+	if result.RowsAffected > 0 {
+		r.log.Println("certificate issued with id: ", certificate.ID)
+	}
+	return nil
+}
+
+func (r *repo) GetByEnrollment(enrollmentID string) (*domain.Certificate, error) {
+	var certificate domain.Certificate
+
+	if err := r.db.Where("enrollment_id = ?", enrollmentID).First(&certificate).Error; err != nil {
+		return nil, err
+	}
+
+	return &certificate, nil
+}
+
+func (r *repo) GetByCode(code string) (*domain.Certificate, error) {
+	var certificate domain.Certificate
+
+	if err := r.db.Where("code = ?", code).First(&certificate).Error; err != nil {
+		return nil, err
+	}
+
+	return &certificate, nil
+}
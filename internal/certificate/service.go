@@ -0,0 +1,174 @@
+package certificate
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrNotCompleted se devuelve al pedir el certificado de una inscripcion que no se aprobo
+	ErrNotCompleted = errors.New("enrollment is not completed")
+	// ErrInvalidCode se devuelve cuando la firma del codigo no coincide con los datos del certificado
+	ErrInvalidCode = errors.New("invalid certificate code")
+)
+
+// encoding es base32 sin padding, asi el codigo se puede dictar o copiar de un papel
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type (
+	Service interface {
+		// Issue emite el certificado de una inscripcion aprobada, si ya existia devuelve el mismo
+		Issue(ctx context.Context, enrollmentID string) (*domain.Certificate, error)
+		// Owner devuelve el usuario de la inscripcion, para autorizar antes de emitir
+		Owner(enrollmentID string) (string, error)
+		Verify(code string) (*domain.Certificate, error)
+		// OnStatusChanged emite el certificado cuando una inscripcion pasa a aprobada
+		OnStatusChanged(ctx context.Context, change domain.EnrollmentStatusChange) error
+	}
+
+	service struct {
+		log    *log.Logger
+		repo   Repository
+		secret []byte
+		now    func() time.Time
+	}
+)
+
+func NewService(l *log.Logger, r Repository, secret []byte) Service {
+	return &service{
+		log:    l,
+		repo:   r,
+		secret: secret,
+		now:    time.Now,
+	}
+}
+
+// SecretFromEnv lee CERTIFICATE_SECRET, la clave con la que se firman los codigos de verificacion.
+// Si cambia, los certificados emitidos antes dejan de verificarse. Vacia devuelve nil y los
+// certificados quedan desactivados
+func SecretFromEnv() ([]byte, error) {
+	secret := os.Getenv("CERTIFICATE_SECRET")
+	if secret == "" {
+		return nil, nil
+	}
+
+	if len(secret) < 16 {
+		return nil, errors.New("CERTIFICATE_SECRET must have at least 16 characters")
+	}
+
+	return []byte(secret), nil
+}
+
+func (s service) Issue(ctx context.Context, enrollmentID string) (*domain.Certificate, error) {
+	certificate, err := s.repo.GetByEnrollment(enrollmentID)
+	if err == nil {
+		return certificate, nil
+	}
+
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	enroll, err := s.repo.GetEnrollment(enrollmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if enroll.Status != domain.EnrollmentCompleted || enroll.User == nil || enroll.Curse == nil {
+		return nil, ErrNotCompleted
+	}
+
+	serial := make([]byte, 5)
+	if _, err := rand.Read(serial); err != nil {
+		return nil, err
+	}
+
+	certificate = &domain.Certificate{
+		ID:           uuid.New().String(),
+		EnrollmentID: enroll.ID,
+		UserID:       enroll.UserID,
+		CurseID:      enroll.CurseID,
+		HolderName:   strings.TrimSpace(enroll.User.FirstName + " " + enroll.User.LastName),
+		CurseName:    strings.TrimSpace(enroll.Curse.Name),
+		StartDate:    enroll.Curse.StartDate,
+		EndDate:      enroll.Curse.EndDate,
+		// la base guarda segundos, se trunca para que la firma coincida al leerlo
+		IssuedAt: s.now().UTC().Truncate(time.Second),
+	}
+	certificate.Code = encoding.EncodeToString(serial) + "-" + s.sign(encoding.EncodeToString(serial), certificate)
+
+	if err := s.repo.Create(certificate); err != nil {
+		return nil, err
+	}
+
+	// si otra peticion lo emitio al mismo tiempo se devuelve el que quedo guardado
+	return s.repo.GetByEnrollment(enrollmentID)
+}
+
+func (s service) Owner(enrollmentID string) (string, error) {
+	enroll, err := s.repo.GetEnrollment(enrollmentID)
+	if err != nil {
+		return "", err
+	}
+
+	return enroll.UserID, nil
+}
+
+func (s service) Verify(code string) (*domain.Certificate, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	serial, signature, ok := strings.Cut(code, "-")
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	certificate, err := s.repo.GetByCode(code)
+	if err != nil {
+		return nil, err
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(s.sign(serial, certificate))) {
+		s.log.Printf("certificate %s signature mismatch", certificate.ID)
+		return nil, ErrInvalidCode
+	}
+
+	return certificate, nil
+}
+
+func (s service) OnStatusChanged(ctx context.Context, change domain.EnrollmentStatusChange) error {
+	if change.To != domain.EnrollmentCompleted {
+		return nil
+	}
+
+	_, err := s.Issue(ctx, change.ID)
+	return err
+}
+
+// sign firma el serial junto con los datos que se muestran, asi tampoco se pueden cambiar en la base
+func (s service) sign(serial string, c *domain.Certificate) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintln(mac, serial)
+	fmt.Fprintln(mac, c.ID)
+	fmt.Fprintln(mac, c.EnrollmentID)
+	fmt.Fprintln(mac, c.HolderName)
+	fmt.Fprintln(mac, c.CurseName)
+	fmt.Fprintln(mac, c.StartDate.Format("2006-01-02"))
+	fmt.Fprintln(mac, c.EndDate.Format("2006-01-02"))
+	fmt.Fprintln(mac, strconv.FormatInt(c.IssuedAt.Unix(), 10))
+
+	return encoding.EncodeToString(mac.Sum(nil))[:16]
+}
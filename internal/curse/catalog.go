@@ -0,0 +1,93 @@
+package curse
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+)
+
+// ErrInvalidCatalog se devuelve cuando los datos de la ficha del curso no son validos
+var ErrInvalidCatalog = errors.New("invalid catalog data")
+
+const (
+	maxTags      = 20
+	maxTagLength = 30
+)
+
+// language acepta codigos como es, en o pt-BR
+var language = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+
+// Catalog son los datos de la ficha del curso; en Update lo que queda en nil no se modifica,
+// CategoryID vacio quita la categoria y Tags vacio (no nil) quita todas las etiquetas
+type Catalog struct {
+	Description   *string
+	CategoryID    *string
+	Tags          []string
+	Level         *string
+	Language      *string
+	DurationHours *int
+	CoverImageURL *string
+}
+
+// normalize valida los datos y deja las etiquetas en minusculas y sin repetir
+func (c Catalog) normalize() (Catalog, error) {
+	if c.Level != nil {
+		switch *c.Level {
+		case "", domain.LevelBeginner, domain.LevelIntermediate, domain.LevelAdvanced:
+		default:
+			return c, fmt.Errorf("%w: level must be %s, %s or %s", ErrInvalidCatalog, domain.LevelBeginner, domain.LevelIntermediate, domain.LevelAdvanced)
+		}
+	}
+
+	if c.Language != nil && *c.Language != "" && !language.MatchString(*c.Language) {
+		return c, fmt.Errorf("%w: language must be a code like es, en or pt-BR", ErrInvalidCatalog)
+	}
+
+	if c.DurationHours != nil && *c.DurationHours < 1 {
+		return c, fmt.Errorf("%w: duration hours must be greater than 0", ErrInvalidCatalog)
+	}
+
+	if c.CoverImageURL != nil && *c.CoverImageURL != "" {
+		u, err := url.Parse(*c.CoverImageURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(*c.CoverImageURL) > 500 {
+			return c, fmt.Errorf("%w: cover image url must be an http or https url", ErrInvalidCatalog)
+		}
+	}
+
+	if c.Tags != nil {
+		tags := make([]string, 0, len(c.Tags))
+		seen := make(map[string]bool, len(c.Tags))
+		for _, tag := range c.Tags {
+			tag = strings.ToLower(strings.TrimSpace(tag))
+			if tag == "" || seen[tag] {
+				continue
+			}
+
+			if len([]rune(tag)) > maxTagLength {
+				return c, fmt.Errorf("%w: tags can't be longer than %d characters", ErrInvalidCatalog, maxTagLength)
+			}
+
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+
+		if len(tags) > maxTags {
+			return c, fmt.Errorf("%w: a curse can't have more than %d tags", ErrInvalidCatalog, maxTags)
+		}
+		c.Tags = tags
+	}
+
+	return c, nil
+}
+
+func curseTags(curseID string, tags []string) []domain.CurseTag {
+	rows := make([]domain.CurseTag, 0, len(tags))
+	for _, tag := range tags {
+		rows = append(rows, domain.CurseTag{CurseID: curseID, Tag: tag})
+	}
+	return rows
+}
@@ -2,12 +2,21 @@ package curse
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/auth"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/etag"
 	"github.com/MartinZitterkopf/gocurse_web/pkg/meta"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/sorting"
 	"github.com/gorilla/mux"
+	"gorm.io/gorm"
 )
 
 type (
@@ -19,18 +28,43 @@ type (
 		GetByID Controller
 		Update  Controller
 		Delete  Controller
+		Restore Controller
+		Purge   Controller
+		History Controller
+		Version Controller
+		Revert  Controller
+		// cambios del ciclo de vida, solo para administradores e instructores del curso
+		Publish          Controller
+		CloseEnrollment  Controller
+		ReopenEnrollment Controller
+		Archive          Controller
 	}
 
 	CreateReq struct {
 		Name      string `json:"name"`
 		StartDate string `json:"start_date"`
 		EndDate   string `json:"end_date"`
+		Capacity  *int   `json:"capacity"`
+		CatalogReq
 	}
 
 	UpdateReq struct {
 		Name      *string `json:"name"`
 		StartDate *string `json:"start_date"`
 		EndDate   *string `json:"end_date"`
+		Capacity  *int    `json:"capacity"`
+		CatalogReq
+	}
+
+	// CatalogReq son los datos de la ficha, en el PATCH tags: [] quita todas las etiquetas
+	CatalogReq struct {
+		Description   *string  `json:"description"`
+		CategoryID    *string  `json:"category_id"`
+		Tags          []string `json:"tags"`
+		Level         *string  `json:"level"`
+		Language      *string  `json:"language"`
+		DurationHours *int     `json:"duration_hours"`
+		CoverImageURL *string  `json:"cover_image_url"`
 	}
 
 	Response struct {
@@ -39,8 +73,18 @@ type (
 		Err    string      `json:"error,omitempty"`
 		Meta   *meta.Meta  `json:"meta,omitempty"`
 	}
+
+	// DeletedCurse es como se muestra en los listados con include_deleted u only_deleted,
+	// el unico lugar donde se expone la fecha de borrado
+	DeletedCurse struct {
+		domain.Curse
+		DeletedAt *time.Time `json:"deleted_at"`
+	}
 )
 
+// columnas por las que se puede ordenar con ?sort=
+var sortableFields = []string{"name", "start_date", "end_date", "duration_hours"}
+
 func MakeEndpoints(s Service) Endpoints {
 	return Endpoints{
 		Create:  makeCreateEndpoint(s),
@@ -48,6 +92,16 @@ func MakeEndpoints(s Service) Endpoints {
 		GetByID: makeGetByIDEnpoint(s),
 		Update:  makeUpdateEnpoint(s),
 		Delete:  makeDeleteEnpoint(s),
+		Restore: makeRestoreEndpoint(s),
+		Purge:   makePurgeEndpoint(s),
+		History: makeHistoryEndpoint(s),
+		Version: makeVersionEndpoint(s),
+		Revert:  makeRevertEndpoint(s),
+
+		Publish:          makeTransitionEndpoint(s, ActionPublish),
+		CloseEnrollment:  makeTransitionEndpoint(s, ActionCloseEnrollment),
+		ReopenEnrollment: makeTransitionEndpoint(s, ActionReopenEnrollment),
+		Archive:          makeTransitionEndpoint(s, ActionArchive),
 	}
 }
 
@@ -75,7 +129,7 @@ func makeCreateEndpoint(s Service) Controller {
 			json.NewEncoder(w).Encode(&Response{Status: 400, Err: fmt.Sprintf("end date is required")})
 		}
 
-		curse, err := s.Create(req.Name, req.StartDate, req.EndDate)
+		curse, err := s.Create(r.Context(), req.Name, req.StartDate, req.EndDate, req.Capacity, req.catalog())
 		if err != nil {
 			w.WriteHeader(400)
 			json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
@@ -90,12 +144,52 @@ func makeGetAllEnpoint(s Service) Controller {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		v := r.URL.Query()
-		filters := Fillters{
-			Name: v.Get("name"),
+		filters, err := parseFilters(v)
+		if err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
+			return
 		}
 
-		limit, _ := strconv.Atoi(v.Get("limit"))
-		page, _ := strconv.Atoi(v.Get("page"))
+		page, limit, err := meta.Params(v)
+		if err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
+			return
+		}
+
+		filters.IncludeDeleted = v.Get("include_deleted") == "true"
+		filters.OnlyDeleted = v.Get("only_deleted") == "true"
+		if (filters.IncludeDeleted || filters.OnlyDeleted) && !auth.IsAdmin(r) {
+			w.WriteHeader(403)
+			json.NewEncoder(w).Encode(&Response{Status: 403, Err: "only admins can list deleted curses"})
+			return
+		}
+
+		// los borradores solo los ven los administradores y los instructores de cada curso
+		if !auth.IsAdmin(r) {
+			filters.HideDrafts = true
+			filters.Viewer = auth.UserID(r)
+		}
+
+		sort, err := sorting.Parse(v.Get("sort"), sortableFields)
+		if err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
+			return
+		}
+
+		if meta.IsCursor(v) {
+			// el cursor solo codifica created_at e id, por eso no se puede combinar con otro orden
+			if sort != nil {
+				w.WriteHeader(400)
+				json.NewEncoder(w).Encode(&Response{Status: 400, Err: "sort is not supported with cursor pagination"})
+				return
+			}
+
+			getAllByCursor(s, w, r, filters, limit)
+			return
+		}
 
 		count, err := s.Count(filters)
 		if err != nil {
@@ -111,14 +205,159 @@ func makeGetAllEnpoint(s Service) Controller {
 			return
 		}
 
-		curses, err := s.GetAll(filters, meta.Offset(), meta.Limit())
+		curses, err := s.GetAll(filters, sort, meta.Offset(), meta.Limit())
 		if err != nil {
 			w.WriteHeader(400)
 			json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
+			return
+		}
+
+		meta.SetLinkHeader(w, r)
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: listData(curses, filters), Meta: meta})
+	}
+}
+
+func parseFilters(v url.Values) (Fillters, error) {
+	filters := Fillters{
+		Name:         v.Get("name"),
+		State:        v.Get("state"),
+		InstructorID: v.Get("instructor_id"),
+		Status:       v.Get("status"),
+		CategoryID:   v.Get("category_id"),
+		Level:        v.Get("level"),
+		Language:     v.Get("language"),
+		Search:       v.Get("q"),
+	}
+
+	// ?tag=go&tag=web o ?tag=go,web
+	for _, tag := range v["tag"] {
+		for _, t := range strings.Split(tag, ",") {
+			if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+				filters.Tags = append(filters.Tags, t)
+			}
 		}
+	}
+
+	switch filters.Level {
+	case "", domain.LevelBeginner, domain.LevelIntermediate, domain.LevelAdvanced:
+	default:
+		return filters, fmt.Errorf("invalid level %q, must be %s, %s or %s", filters.Level,
+			domain.LevelBeginner, domain.LevelIntermediate, domain.LevelAdvanced)
+	}
+
+	durations := []struct {
+		param string
+		dst   **int
+	}{
+		{"min_duration", &filters.MinDuration},
+		{"max_duration", &filters.MaxDuration},
+	}
+	for _, d := range durations {
+		if v.Get(d.param) == "" {
+			continue
+		}
+
+		hours, err := strconv.Atoi(v.Get(d.param))
+		if err != nil || hours < 0 {
+			return filters, fmt.Errorf("invalid %s, must be a number of hours", d.param)
+		}
+		*d.dst = &hours
+	}
+
+	if c := v.Get("has_cover"); c != "" {
+		hasCover, err := strconv.ParseBool(c)
+		if err != nil {
+			return filters, fmt.Errorf("invalid has_cover, must be true or false")
+		}
+		filters.HasCover = &hasCover
+	}
 
-		json.NewEncoder(w).Encode(&Response{Status: 200, Data: curses, Meta: meta})
+	switch filters.Status {
+	case "", domain.CurseDraft, domain.CursePublished, domain.CurseEnrollmentClosed, domain.CurseArchived:
+	default:
+		return filters, fmt.Errorf("invalid status %q, must be %s, %s, %s or %s", filters.Status,
+			domain.CurseDraft, domain.CursePublished, domain.CurseEnrollmentClosed, domain.CurseArchived)
 	}
+
+	switch filters.State {
+	case "", StateUpcoming, StateRunning, StateFinished:
+	default:
+		return filters, fmt.Errorf("invalid state %q, must be %s, %s or %s", filters.State, StateUpcoming, StateRunning, StateFinished)
+	}
+
+	dates := []struct {
+		param string
+		dst   **time.Time
+	}{
+		{"start_from", &filters.StartFrom},
+		{"start_to", &filters.StartTo},
+		{"end_from", &filters.EndFrom},
+		{"end_to", &filters.EndTo},
+	}
+	for _, d := range dates {
+		if v.Get(d.param) == "" {
+			continue
+		}
+
+		date, err := time.Parse("2006-01-02", v.Get(d.param))
+		if err != nil {
+			return filters, fmt.Errorf("invalid %s, must have the format YYYY-MM-DD", d.param)
+		}
+		*d.dst = &date
+	}
+
+	if s := v.Get("seats_available"); s != "" {
+		available, err := strconv.ParseBool(s)
+		if err != nil {
+			return filters, fmt.Errorf("invalid seats_available, must be true or false")
+		}
+		filters.SeatsAvailable = &available
+	}
+
+	return filters, nil
+}
+
+func getAllByCursor(s Service, w http.ResponseWriter, r *http.Request, filters Fillters, limit int) {
+	v := r.URL.Query()
+
+	cursor, err := meta.DecodeCursor(v.Get("cursor"))
+	if err != nil {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
+		return
+	}
+
+	// en modo cursor el conteo es opcional porque tiene que recorrer toda la tabla
+	count := -1
+	if v.Get("count") == "true" {
+		count, err = s.Count(filters)
+		if err != nil {
+			w.WriteHeader(500)
+			json.NewEncoder(w).Encode(&Response{Status: 500, Err: err.Error()})
+			return
+		}
+	}
+
+	meta, err := meta.NewCursor(v.Get("cursor"), limit, count)
+	if err != nil {
+		w.WriteHeader(500)
+		json.NewEncoder(w).Encode(&Response{Status: 500, Err: err.Error()})
+		return
+	}
+
+	curses, next, err := s.GetAllAfter(filters, cursor, meta.Limit())
+	if err != nil {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
+		return
+	}
+
+	if next != nil {
+		meta.NextCursor = next.Encode()
+	}
+
+	meta.SetLinkHeader(w, r)
+	json.NewEncoder(w).Encode(&Response{Status: 200, Data: listData(curses, filters), Meta: meta})
 }
 
 func makeGetByIDEnpoint(s Service) Controller {
@@ -127,9 +366,15 @@ func makeGetByIDEnpoint(s Service) Controller {
 		id := path["id"]
 
 		user, err := s.GetByID(id)
-		if err != nil {
-			w.WriteHeader(400)
-			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "user doesn't exist"})
+		if err != nil || (user.Status == domain.CurseDraft && !auth.CanManage(r, id, s.CanManage)) {
+			w.WriteHeader(404)
+			json.NewEncoder(w).Encode(&Response{Status: 404, Err: "curse doesn't exist"})
+			return
+		}
+
+		etag.Set(w, user.Version)
+		if etag.NotModified(r, user.Version) {
+			w.WriteHeader(304)
 			return
 		}
 
@@ -147,12 +392,6 @@ func makeUpdateEnpoint(s Service) Controller {
 			return
 		}
 
-		if req.Name != nil && *req.Name == "" {
-			w.WriteHeader(400)
-			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "Name is required"})
-			return
-		}
-
 		if req.StartDate != nil && *req.StartDate == "" {
 			w.WriteHeader(400)
 			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "Start Date is required"})
@@ -168,7 +407,31 @@ func makeUpdateEnpoint(s Service) Controller {
 		path := mux.Vars(r)
 		id := path["id"]
 
-		if err := s.Update(id, req.Name, req.StartDate, req.EndDate); err != nil {
+		version, err := etag.IfMatch(r)
+		if errors.Is(err, etag.ErrMissing) {
+			w.WriteHeader(428)
+			json.NewEncoder(w).Encode(&Response{Status: 428, Err: err.Error()})
+			return
+		}
+		if err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
+			return
+		}
+
+		if err := s.Update(r.Context(), id, version, req.Name, req.StartDate, req.EndDate, req.Capacity, req.catalog()); err != nil {
+			if errors.Is(err, ErrVersionConflict) {
+				w.WriteHeader(412)
+				json.NewEncoder(w).Encode(&Response{Status: 412, Err: err.Error()})
+				return
+			}
+
+			if errors.Is(err, ErrInvalidCatalog) || errors.Is(err, ErrInvalidCurse) {
+				w.WriteHeader(400)
+				json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
+				return
+			}
+
 			w.WriteHeader(404)
 			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "Curse doesn't exist"})
 			return
@@ -183,7 +446,31 @@ func makeDeleteEnpoint(s Service) Controller {
 		path := mux.Vars(r)
 		id := path["id"]
 
-		if err := s.Delete(id); err != nil {
+		version, err := etag.IfMatch(r)
+		if errors.Is(err, etag.ErrMissing) {
+			w.WriteHeader(428)
+			json.NewEncoder(w).Encode(&Response{Status: 428, Err: err.Error()})
+			return
+		}
+		if err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
+			return
+		}
+
+		if err := s.Delete(r.Context(), id, version); err != nil {
+			if errors.Is(err, ErrVersionConflict) {
+				w.WriteHeader(412)
+				json.NewEncoder(w).Encode(&Response{Status: 412, Err: err.Error()})
+				return
+			}
+
+			if errors.Is(err, ErrActiveEnrollments) {
+				w.WriteHeader(409)
+				json.NewEncoder(w).Encode(&Response{Status: 409, Err: err.Error()})
+				return
+			}
+
 			w.WriteHeader(404)
 			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "user doesn't exist"})
 			return
@@ -192,3 +479,244 @@ func makeDeleteEnpoint(s Service) Controller {
 		json.NewEncoder(w).Encode(&Response{Status: 200, Data: "success"})
 	}
 }
+
+func makeRestoreEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !auth.IsAdmin(r) {
+			w.WriteHeader(403)
+			json.NewEncoder(w).Encode(&Response{Status: 403, Err: "only admins can restore curses"})
+			return
+		}
+
+		path := mux.Vars(r)
+		id := path["id"]
+
+		if err := s.Restore(r.Context(), id); err != nil {
+			w.WriteHeader(404)
+			json.NewEncoder(w).Encode(&Response{Status: 404, Err: "deleted curse doesn't exist"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: "success"})
+	}
+}
+
+func makePurgeEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !auth.IsAdmin(r) {
+			w.WriteHeader(403)
+			json.NewEncoder(w).Encode(&Response{Status: 403, Err: "only admins can purge curses"})
+			return
+		}
+
+		path := mux.Vars(r)
+		id := path["id"]
+
+		if err := s.Purge(r.Context(), id); err != nil {
+			w.WriteHeader(404)
+			json.NewEncoder(w).Encode(&Response{Status: 404, Err: "curse doesn't exist"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: "success"})
+	}
+}
+
+func makeHistoryEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := mux.Vars(r)
+		id := path["id"]
+
+		if _, err := s.GetByID(id); err != nil {
+			w.WriteHeader(404)
+			json.NewEncoder(w).Encode(&Response{Status: 404, Err: "curse doesn't exist"})
+			return
+		}
+
+		page, limit, err := meta.Params(r.URL.Query())
+		if err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
+			return
+		}
+
+		count, err := s.CountHistory(id)
+		if err != nil {
+			w.WriteHeader(500)
+			json.NewEncoder(w).Encode(&Response{Status: 500, Err: err.Error()})
+			return
+		}
+
+		meta, err := meta.New(page, limit, count)
+		if err != nil {
+			w.WriteHeader(500)
+			json.NewEncoder(w).Encode(&Response{Status: 500, Err: err.Error()})
+			return
+		}
+
+		versions, err := s.GetHistory(id, meta.Offset(), meta.Limit())
+		if err != nil {
+			w.WriteHeader(500)
+			json.NewEncoder(w).Encode(&Response{Status: 500, Err: err.Error()})
+			return
+		}
+
+		meta.SetLinkHeader(w, r)
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: versions, Meta: meta})
+	}
+}
+
+func makeVersionEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := mux.Vars(r)
+		id := path["id"]
+
+		if _, err := s.GetByID(id); err != nil {
+			w.WriteHeader(404)
+			json.NewEncoder(w).Encode(&Response{Status: 404, Err: "curse doesn't exist"})
+			return
+		}
+
+		version, err := strconv.Atoi(path["version"])
+		if err != nil || version < 1 {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "invalid version"})
+			return
+		}
+
+		v, err := s.GetVersion(id, version)
+		if err != nil {
+			w.WriteHeader(404)
+			json.NewEncoder(w).Encode(&Response{Status: 404, Err: "version doesn't exist"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: v})
+	}
+}
+
+func makeRevertEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := mux.Vars(r)
+		id := path["id"]
+
+		version, err := strconv.Atoi(path["version"])
+		if err != nil || version < 1 {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "invalid version"})
+			return
+		}
+
+		if _, err := s.GetVersion(id, version); err != nil {
+			w.WriteHeader(404)
+			json.NewEncoder(w).Encode(&Response{Status: 404, Err: "version doesn't exist"})
+			return
+		}
+
+		// en revert el If-Match es opcional, pero si viene tiene que ser valido
+		ifMatch, err := etag.IfMatch(r)
+		if err != nil && !errors.Is(err, etag.ErrMissing) {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
+			return
+		}
+		if err := s.Revert(r.Context(), id, version, ifMatch); err != nil {
+			if errors.Is(err, ErrVersionConflict) {
+				w.WriteHeader(412)
+				json.NewEncoder(w).Encode(&Response{Status: 412, Err: err.Error()})
+				return
+			}
+
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
+			return
+		}
+
+		curse, err := s.GetByID(id)
+		if err != nil {
+			w.WriteHeader(500)
+			json.NewEncoder(w).Encode(&Response{Status: 500, Err: err.Error()})
+			return
+		}
+
+		etag.Set(w, curse.Version)
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: curse})
+	}
+}
+
+func makeTransitionEndpoint(s Service, action string) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+
+		// los asistentes no pueden publicar, cerrar ni archivar el curso
+		if !auth.CanManage(r, id, s.CanTransition) {
+			w.WriteHeader(403)
+			json.NewEncoder(w).Encode(&Response{Status: 403, Err: "only admins and lead instructors of the curse can change its status"})
+			return
+		}
+
+		curse, err := s.Transition(r.Context(), id, action)
+		if err != nil {
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				w.WriteHeader(404)
+				json.NewEncoder(w).Encode(&Response{Status: 404, Err: "curse doesn't exist"})
+			case errors.Is(err, ErrInvalidTransition), errors.Is(err, ErrActiveEnrollments), errors.Is(err, ErrVersionConflict):
+				w.WriteHeader(409)
+				json.NewEncoder(w).Encode(&Response{Status: 409, Err: err.Error()})
+			default:
+				w.WriteHeader(500)
+				json.NewEncoder(w).Encode(&Response{Status: 500, Err: err.Error()})
+			}
+			return
+		}
+
+		etag.Set(w, curse.Version)
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: curse})
+	}
+}
+
+// HideDrafts envuelve las lecturas de /curses/{id}/... para que un borrador
+// no se pueda ver por ahi; para quien no lo maneja el curso no existe
+func HideDrafts(s Service, next func(http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+
+		curse, err := s.GetByID(id)
+		if err == nil && curse.Status == domain.CurseDraft && !auth.CanManage(r, id, s.CanManage) {
+			w.WriteHeader(404)
+			json.NewEncoder(w).Encode(&Response{Status: 404, Err: "curse doesn't exist"})
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (req CatalogReq) catalog() Catalog {
+	return Catalog{
+		Description:   req.Description,
+		CategoryID:    req.CategoryID,
+		Tags:          req.Tags,
+		Level:         req.Level,
+		Language:      req.Language,
+		DurationHours: req.DurationHours,
+		CoverImageURL: req.CoverImageURL,
+	}
+}
+
+func listData(curses []domain.Curse, filters Fillters) interface{} {
+	if !filters.IncludeDeleted && !filters.OnlyDeleted {
+		return curses
+	}
+
+	data := make([]DeletedCurse, 0, len(curses))
+	for _, item := range curses {
+		d := DeletedCurse{Curse: item}
+		if item.Deleted.Valid {
+			d.DeletedAt = &item.Deleted.Time
+		}
+		data = append(data, d)
+	}
+	return data
+}
@@ -1,41 +1,84 @@
 package curse
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"github.com/MartinZitterkopf/gocurse_web/internal/outbox"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/meta"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/sorting"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type (
 	Repository interface {
-		Create(curse *domain.Curse) error
-		GetAll(filters Fillters, limit, offset int) ([]domain.Curse, error)
+		// Transaction corre fn con un Repository que usa tx, la transaccion que tambien recibe fn
+		Transaction(fn func(repo Repository, tx *gorm.DB) error) error
+		// Create guarda el curso y su primera version del historial, actor es quien hizo el cambio
+		Create(curse *domain.Curse, actor string) error
+		GetAll(filters Fillters, sort sorting.Sort, limit, offset int) ([]domain.Curse, error)
+		GetAllAfter(filters Fillters, cursor *meta.Cursor, limit int) ([]domain.Curse, error)
 		GetByID(id string) (*domain.Curse, error)
-		Update(id string, name *string, startDate, endDate *time.Time) error
-		Delete(id string) error
+		// Update guarda la version del historial en la misma transaccion, con el numero de version del curso.
+		// Si no cambia nada no sube la version
+		Update(id string, version int, name *string, startDate, endDate *time.Time, capacity *int, catalog Catalog, actor string) error
+		Delete(id string, version int) ([]domain.EnrollmentStatusChange, error)
+		Restore(id string) error
+		Purge(id string) error
+		// SetStatus cambia el estado solo si sigue siendo from; al archivar controla que no queden inscripciones activas.
+		// Como sube la version, tambien guarda la foto en el historial
+		SetStatus(id, from, to, actor string) error
+		IsInstructor(curseID, userID string) (bool, error)
+		// IsLead indica si el usuario es instructor lider del curso
+		IsLead(curseID, userID string) (bool, error)
+		CategoryExists(id string) (bool, error)
+		// CategoryDescendants devuelve los IDs de todas las subcategorias, en cualquier nivel
+		CategoryDescendants(id string) ([]string, error)
 		Count(filters Fillters) (int, error)
+		GetVersions(curseID string, offset, limit int) ([]domain.CurseVersion, error)
+		GetVersion(curseID string, version int) (*domain.CurseVersion, error)
+		CountVersions(curseID string) (int, error)
 	}
 
 	repo struct {
-		log *log.Logger
-		db  *gorm.DB
+		log          *log.Logger
+		db           *gorm.DB
+		deletePolicy domain.DeletePolicy
 	}
 )
 
 func NewRepo(l *log.Logger, db *gorm.DB) Repository {
 	return &repo{
-		log: l,
-		db:  db,
+		log:          l,
+		db:           db,
+		deletePolicy: deletePolicyFromEnv(),
 	}
 }
 
-func (r *repo) Create(curse *domain.Curse) error {
+func (repo *repo) Transaction(fn func(repo Repository, tx *gorm.DB) error) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		txRepo := *repo
+		txRepo.db = tx
+		return fn(&txRepo, tx)
+	})
+}
+
+func (r *repo) Create(curse *domain.Curse, actor string) error {
 
-	if err := r.db.Create(curse).Error; err != nil {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(curse).Error; err != nil {
+			return err
+		}
+
+		return createVersion(tx, curse, actor)
+	})
+	if err != nil {
 		r.log.Printf("error; %v", err)
 		return err
 	}
@@ -43,15 +86,32 @@ func (r *repo) Create(curse *domain.Curse) error {
 	return nil
 }
 
-func (repo *repo) GetAll(filters Fillters, offset, limit int) ([]domain.Curse, error) {
+func (repo *repo) GetAll(filters Fillters, sort sorting.Sort, offset, limit int) ([]domain.Curse, error) {
 	var c []domain.Curse
 
 	// Model hace referencia al modelo de usuario y Find lo que hace es poblar la informacion que saca de la estructura
-	tx := repo.db.Model(&c)
+	tx := repo.db.Model(&c).Preload("Tags")
 	tx = applyFilters(tx, filters)
 	tx = tx.Limit(limit).Offset(offset)
 
-	result := tx.Order("created_at desc").Find(&c)
+	result := tx.Order(sort.OrderBy("created_at desc, id desc")).Find(&c)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return c, nil
+}
+
+// GetAllAfter pagina por keyset: trae los registros que estan despues del cursor
+// segun el orden created_at desc, id desc, sin usar offset
+func (repo *repo) GetAllAfter(filters Fillters, cursor *meta.Cursor, limit int) ([]domain.Curse, error) {
+	var c []domain.Curse
+
+	tx := repo.db.Model(&c).Preload("Tags")
+	tx = applyFilters(tx, filters)
+	tx = applyCursor(tx, cursor)
+
+	result := tx.Order("created_at desc, id desc").Limit(limit).Find(&c)
 	if result.Error != nil {
 		return nil, result.Error
 	}
@@ -62,14 +122,17 @@ func (repo *repo) GetAll(filters Fillters, offset, limit int) ([]domain.Curse, e
 func (repo *repo) GetByID(id string) (*domain.Curse, error) {
 	curse := domain.Curse{ID: id}
 
-	if err := repo.db.First(&curse).Error; err != nil {
+	if err := repo.db.Preload("Tags").First(&curse).Error; err != nil {
 		return nil, err
 	}
 
 	return &curse, nil
 }
 
-func (repo *repo) Update(id string, name *string, startDate, endDate *time.Time) error {
+// errUnchanged deshace la transaccion de Update cuando los valores ya eran esos
+var errUnchanged = errors.New("curse unchanged")
+
+func (repo *repo) Update(id string, version int, name *string, startDate, endDate *time.Time, capacity *int, catalog Catalog, actor string) error {
 	values := make(map[string]interface{})
 
 	if name != nil {
@@ -84,23 +147,327 @@ func (repo *repo) Update(id string, name *string, startDate, endDate *time.Time)
 		values["end_date"] = *endDate
 	}
 
-	if err := repo.db.Model(&domain.Curse{}).Where("id = ?", id).Updates(values).Error; err != nil {
-		return err
+	if capacity != nil {
+		values["capacity"] = *capacity
 	}
 
-	return nil
+	if catalog.Description != nil {
+		values["description"] = *catalog.Description
+	}
+
+	if catalog.CategoryID != nil {
+		// vacio quita la categoria
+		if *catalog.CategoryID == "" {
+			values["category_id"] = nil
+		} else {
+			values["category_id"] = *catalog.CategoryID
+		}
+	}
+
+	if catalog.Level != nil {
+		values["level"] = *catalog.Level
+	}
+
+	if catalog.Language != nil {
+		values["language"] = *catalog.Language
+	}
+
+	if catalog.DurationHours != nil {
+		values["duration_hours"] = *catalog.DurationHours
+	}
+
+	if catalog.CoverImageURL != nil {
+		values["cover_image_url"] = *catalog.CoverImageURL
+	}
+
+	// version 0 actualiza sin controlar la version, si no solo se actualiza si nadie lo modifico antes
+	values["version"] = gorm.Expr("version + 1")
+
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		// el lock sobre la fila hace que los cambios concurrentes del mismo curso esperen,
+		// asi cada uno guarda en el historial su propia version
+		var before domain.Curse
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Tags").Where("id = ?", id).First(&before).Error; err != nil {
+			return err
+		}
+
+		update := tx.Model(&domain.Curse{}).Where("id = ?", id)
+		if version > 0 {
+			update = update.Where("version = ?", version)
+		}
+
+		result := update.Updates(values)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return repo.notUpdated(id)
+		}
+
+		if catalog.Tags != nil {
+			if err := tx.Where("curse_id = ?", id).Delete(&domain.CurseTag{}).Error; err != nil {
+				return err
+			}
+
+			if len(catalog.Tags) > 0 {
+				if err := tx.Create(curseTags(id, catalog.Tags)).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		curse := domain.Curse{ID: id}
+		if err := tx.Preload("Tags").First(&curse).Error; err != nil {
+			return err
+		}
+
+		// si no cambio nada se deshace la transaccion, asi la version no sube sin una foto en el historial
+		if !changed(&before, &curse) {
+			return errUnchanged
+		}
+
+		if err := saveVersion(tx, &before, &curse, actor); err != nil {
+			return err
+		}
+
+		return outbox.Add(tx, outbox.CurseUpdated, id, curse)
+	})
+	if errors.Is(err, errUnchanged) {
+		return nil
+	}
+
+	return err
 }
 
-func (repo *repo) Delete(id string) error {
-	curse := domain.Curse{ID: id}
+// Delete devuelve las inscripciones que cambiaron de estado por la politica de borrado
+func (repo *repo) Delete(id string, version int) ([]domain.EnrollmentStatusChange, error) {
+	var changes []domain.EnrollmentStatusChange
+
+	// las inscripciones se actualizan en la misma transaccion que el borrado
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		changes, err = applyDeletePolicy(tx, repo.deletePolicy, id)
+		if err != nil {
+			return err
+		}
+
+		curse := domain.Curse{ID: id}
+		del := tx
+		if version > 0 {
+			del = del.Where("version = ?", version)
+		}
+
+		result := del.Delete(&curse)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return repo.notUpdated(id)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+func (repo *repo) SetStatus(id, from, to, actor string) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		if to == domain.CurseArchived {
+			var count int64
+			if err := tx.Model(&domain.Enrollment{}).Where("curse_id = ? AND status IN ?", id, domain.EnrollmentActiveStatuses).Count(&count).Error; err != nil {
+				return err
+			}
+
+			if count > 0 {
+				return ErrActiveEnrollments
+			}
+		}
+
+		var before domain.Curse
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Tags").Where("id = ?", id).First(&before).Error; err != nil {
+			return err
+		}
+
+		result := tx.Model(&domain.Curse{}).Where("id = ? AND status = ?", id, from).
+			Updates(map[string]interface{}{"status": to, "version": gorm.Expr("version + 1")})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		// otra peticion cambio el estado entre la lectura y la actualizacion
+		if result.RowsAffected == 0 {
+			return ErrVersionConflict
+		}
+
+		curse := domain.Curse{ID: id}
+		if err := tx.Preload("Tags").First(&curse).Error; err != nil {
+			return err
+		}
+
+		if err := saveVersion(tx, &before, &curse, actor); err != nil {
+			return err
+		}
+
+		repo.log.Printf("curse %s status changed from %s to %s", id, from, to)
+		return outbox.Add(tx, outbox.CurseUpdated, id, curse)
+	})
+}
+
+func (repo *repo) CategoryExists(id string) (bool, error) {
+	var count int64
+
+	if err := repo.db.Model(&domain.Category{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (repo *repo) CategoryDescendants(id string) ([]string, error) {
+	var categories []domain.Category
+
+	// las categorias son pocas, se recorre el arbol en memoria en lugar de una consulta recursiva
+	if err := repo.db.Select("id", "parent_id").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	children := make(map[string][]string)
+	for _, c := range categories {
+		if c.ParentID != nil {
+			children[*c.ParentID] = append(children[*c.ParentID], c.ID)
+		}
+	}
+
+	var ids []string
+	pending := children[id]
+	for len(pending) > 0 {
+		next := pending[0]
+		pending = pending[1:]
+
+		ids = append(ids, next)
+		pending = append(pending, children[next]...)
+	}
 
-	if err := repo.db.Delete(&curse).Error; err != nil {
+	return ids, nil
+}
+
+func (repo *repo) IsInstructor(curseID, userID string) (bool, error) {
+	var count int64
+
+	if err := repo.db.Model(&domain.CurseInstructor{}).Where("curse_id = ? AND user_id = ?", curseID, userID).Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (repo *repo) IsLead(curseID, userID string) (bool, error) {
+	var count int64
+
+	if err := repo.db.Model(&domain.CurseInstructor{}).Where("curse_id = ? AND user_id = ? AND role = ?", curseID, userID, domain.InstructorLead).Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// notUpdated distingue si no se modifico nada porque el registro no existe o porque cambio su version
+func (repo *repo) notUpdated(id string) error {
+	if _, err := repo.GetByID(id); err != nil {
 		return err
 	}
 
+	return ErrVersionConflict
+}
+
+func (repo *repo) Restore(id string) error {
+	result := repo.db.Unscoped().Model(&domain.Curse{}).Where("id = ? AND deleted IS NOT NULL", id).Update("deleted", nil)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
 	return nil
 }
 
+// Purge borra definitivamente el registro junto con sus inscripciones, instructores, prerrequisitos, clases, asistencias, notas, certificados e historial
+func (repo *repo) Purge(id string) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("curse_id = ?", id).Delete(&domain.Enrollment{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("curse_id = ?", id).Delete(&domain.CurseInstructor{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("curse_id = ? OR prerequisite_id = ?", id, id).Delete(&domain.CursePrerequisite{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("curse_id = ?", id).Delete(&domain.CurseTag{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("curse_id = ?", id).Delete(&domain.Attendance{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("curse_id = ?", id).Delete(&domain.Score{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("curse_id = ?", id).Delete(&domain.FinalGrade{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("curse_id = ?", id).Delete(&domain.Certificate{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("curse_id = ?", id).Delete(&domain.Assessment{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("curse_id = ?", id).Delete(&domain.GradingPolicy{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("curse_id = ?", id).Delete(&domain.CurseSession{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("curse_id = ?", id).Delete(&domain.CurseSchedule{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("curse_id = ?", id).Delete(&domain.CurseVersion{}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().Delete(&domain.Curse{ID: id})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		repo.log.Println("Curse purged with id: ", id)
+		return nil
+	})
+}
+
 func (repo *repo) Count(filters Fillters) (int, error) {
 	var count int64
 	tx := repo.db.Model(domain.Curse{})
@@ -113,11 +480,226 @@ func (repo *repo) Count(filters Fillters) (int, error) {
 	return int(count), nil
 }
 
+// saveVersion guarda la foto de after en cada cambio que sube la version. Los cursos creados
+// antes de guardar el historial no tienen version inicial, para esos se guarda tambien before
+func saveVersion(tx *gorm.DB, before, after *domain.Curse, actor string) error {
+	var count int64
+	if err := tx.Model(&domain.CurseVersion{}).Where("curse_id = ?", after.ID).Count(&count).Error; err != nil {
+		return err
+	}
+
+	if count == 0 {
+		if err := createVersion(tx, before, actor); err != nil {
+			return err
+		}
+	}
+
+	return createVersion(tx, after, actor)
+}
+
+// createVersion usa el numero de version del curso, que ya sube de forma atomica en cada cambio
+func createVersion(tx *gorm.DB, curse *domain.Curse, actor string) error {
+	return tx.Create(&domain.CurseVersion{
+		CurseID:   curse.ID,
+		Version:   curse.Version,
+		Name:      curse.Name,
+		StartDate: curse.StartDate,
+		EndDate:   curse.EndDate,
+		Capacity:  curse.Capacity,
+		Status:    curse.Status,
+		Actor:     actor,
+
+		Description:   curse.Description,
+		CategoryID:    curse.CategoryID,
+		Tags:          tagNames(curse.Tags),
+		Level:         curse.Level,
+		Language:      curse.Language,
+		DurationHours: curse.DurationHours,
+		CoverImageURL: curse.CoverImageURL,
+	}).Error
+}
+
+func tagNames(tags []domain.CurseTag) []string {
+	names := make([]string, 0, len(tags))
+	for _, t := range tags {
+		names = append(names, t.Tag)
+	}
+	return names
+}
+
+func (repo *repo) GetVersions(curseID string, offset, limit int) ([]domain.CurseVersion, error) {
+	var versions []domain.CurseVersion
+
+	result := repo.db.Where("curse_id = ?", curseID).Order("version desc").
+		Limit(limit).Offset(offset).Find(&versions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return versions, nil
+}
+
+func (repo *repo) GetVersion(curseID string, version int) (*domain.CurseVersion, error) {
+	var v domain.CurseVersion
+
+	if err := repo.db.Where("curse_id = ? AND version = ?", curseID, version).First(&v).Error; err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+func (repo *repo) CountVersions(curseID string) (int, error) {
+	var count int64
+
+	if err := repo.db.Model(&domain.CurseVersion{}).Where("curse_id = ?", curseID).Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	return int(count), nil
+}
+
 func applyFilters(tx *gorm.DB, filters Fillters) *gorm.DB {
+	// los registros borrados solo se ven si se piden explicitamente
+	if filters.IncludeDeleted || filters.OnlyDeleted {
+		tx = tx.Unscoped()
+	}
+
+	if filters.OnlyDeleted {
+		tx = tx.Where("deleted IS NOT NULL")
+	}
+
 	if filters.Name != "" {
 		filters.Name = fmt.Sprintf("%%%s%%", strings.ToLower(filters.Name))
 		tx = tx.Where("lower(name) like ?", filters.Name)
 	}
 
+	if filters.StartFrom != nil {
+		tx = tx.Where("start_date >= ?", *filters.StartFrom)
+	}
+
+	if filters.StartTo != nil {
+		tx = tx.Where("start_date <= ?", *filters.StartTo)
+	}
+
+	if filters.EndFrom != nil {
+		tx = tx.Where("end_date >= ?", *filters.EndFrom)
+	}
+
+	if filters.EndTo != nil {
+		tx = tx.Where("end_date <= ?", *filters.EndTo)
+	}
+
+	// las fechas se guardan sin hora, por eso un curso sigue en curso durante todo el dia de end_date
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch filters.State {
+	case StateUpcoming:
+		tx = tx.Where("start_date > ?", now)
+	case StateRunning:
+		tx = tx.Where("start_date <= ? AND end_date >= ?", now, today)
+	case StateFinished:
+		tx = tx.Where("end_date < ?", today)
+	}
+
+	if filters.SeatsAvailable != nil {
+		enrolled := "(SELECT COUNT(*) FROM enrollments WHERE enrollments.curse_id = curses.id AND enrollments.status IN ?)"
+		if *filters.SeatsAvailable {
+			tx = tx.Where("(capacity IS NULL OR capacity > "+enrolled+")", domain.EnrollmentActiveStatuses)
+		} else {
+			tx = tx.Where("capacity IS NOT NULL AND capacity <= "+enrolled, domain.EnrollmentActiveStatuses)
+		}
+	}
+
+	if filters.InstructorID != "" {
+		tx = tx.Where("id IN (SELECT curse_id FROM curse_instructors WHERE user_id = ?)", filters.InstructorID)
+	}
+
+	if filters.Status != "" {
+		tx = tx.Where("status = ?", filters.Status)
+	}
+
+	if filters.CategoryID != "" {
+		tx = tx.Where("category_id IN ?", filters.CategoryIDs)
+	}
+
+	if len(filters.Tags) > 0 {
+		tx = tx.Where("id IN (SELECT curse_id FROM curse_tags WHERE tag IN ? GROUP BY curse_id HAVING COUNT(DISTINCT tag) = ?)",
+			filters.Tags, len(filters.Tags))
+	}
+
+	if filters.Level != "" {
+		tx = tx.Where("level = ?", filters.Level)
+	}
+
+	// es incluye tambien es-AR, es-MX, etc.
+	if filters.Language != "" {
+		tx = tx.Where("(language = ? OR language LIKE ?)", filters.Language, filters.Language+"-%")
+	}
+
+	if filters.MinDuration != nil {
+		tx = tx.Where("duration_hours >= ?", *filters.MinDuration)
+	}
+
+	if filters.MaxDuration != nil {
+		tx = tx.Where("duration_hours <= ?", *filters.MaxDuration)
+	}
+
+	if filters.Search != "" {
+		search := fmt.Sprintf("%%%s%%", strings.ToLower(filters.Search))
+		tx = tx.Where("(lower(name) like ? OR lower(description) like ?)", search, search)
+	}
+
+	if filters.HasCover != nil {
+		if *filters.HasCover {
+			tx = tx.Where("cover_image_url <> ''")
+		} else {
+			tx = tx.Where("(cover_image_url = '' OR cover_image_url IS NULL)")
+		}
+	}
+
+	if filters.HideDrafts {
+		if filters.Viewer != "" {
+			tx = tx.Where("(status <> ? OR id IN (SELECT curse_id FROM curse_instructors WHERE user_id = ?))", domain.CurseDraft, filters.Viewer)
+		} else {
+			tx = tx.Where("status <> ?", domain.CurseDraft)
+		}
+	}
+
 	return tx
 }
+
+func applyCursor(tx *gorm.DB, cursor *meta.Cursor) *gorm.DB {
+	if cursor == nil {
+		return tx
+	}
+
+	return tx.Where("(created_at < ? OR (created_at = ? AND id < ?))", cursor.CreatedAt, cursor.CreatedAt, cursor.ID)
+}
+
+func applyDeletePolicy(tx *gorm.DB, policy domain.DeletePolicy, id string) ([]domain.EnrollmentStatusChange, error) {
+	switch policy {
+	case domain.DeleteBlock:
+		var count int64
+		if err := tx.Model(&domain.Enrollment{}).Where("curse_id = ? AND status IN ?", id, domain.EnrollmentActiveStatuses).Count(&count).Error; err != nil {
+			return nil, err
+		}
+
+		if count > 0 {
+			return nil, ErrActiveEnrollments
+		}
+
+	case domain.DeleteCancel:
+		return outbox.StatusChanged(tx, domain.EnrollmentCancelled, "curse_id = ? AND status IN ?", id, domain.EnrollmentActiveStatuses)
+	}
+
+	return nil, nil
+}
+
+func deletePolicyFromEnv() domain.DeletePolicy {
+	switch policy := domain.DeletePolicy(os.Getenv("ENROLLMENT_DELETE_POLICY")); policy {
+	case domain.DeleteCancel, domain.DeleteBlock:
+		return policy
+	}
+	return domain.DeleteKeep
+}
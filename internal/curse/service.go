@@ -1,40 +1,146 @@
 package curse
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"strings"
 	"time"
 
+	"github.com/MartinZitterkopf/gocurse_web/internal/audit"
 	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/auth"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/events"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/meta"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/sorting"
+	"gorm.io/gorm"
 )
 
+// ErrActiveEnrollments se devuelve al borrar con la politica block o al archivar si hay inscripciones activas
+var ErrActiveEnrollments = errors.New("curse has active enrollments")
+
+// ErrInvalidCurse se devuelve cuando el nombre o el cupo no son validos
+var ErrInvalidCurse = errors.New("invalid curse")
+
+// ErrVersionConflict se devuelve cuando la version que manda el cliente ya no es la actual
+var ErrVersionConflict = errors.New("curse was modified by another request")
+
+// ErrInvalidTransition se devuelve cuando el curso no puede pasar del estado actual al pedido
+var ErrInvalidTransition = errors.New("invalid curse status transition")
+
+const (
+	ActionPublish          = "publish"
+	ActionCloseEnrollment  = "close_enrollment"
+	ActionReopenEnrollment = "reopen_enrollment"
+	ActionArchive          = "archive"
+)
+
+// transition es un cambio del ciclo de vida: desde que estados se puede hacer y a cual pasa
+type transition struct {
+	From []string
+	To   string
+}
+
+// transitions son los cambios permitidos, archivado es un estado final
+var transitions = map[string]transition{
+	ActionPublish:          {From: []string{domain.CurseDraft}, To: domain.CursePublished},
+	ActionCloseEnrollment:  {From: []string{domain.CursePublished}, To: domain.CurseEnrollmentClosed},
+	ActionReopenEnrollment: {From: []string{domain.CurseEnrollmentClosed}, To: domain.CursePublished},
+	ActionArchive:          {From: []string{domain.CursePublished, domain.CurseEnrollmentClosed}, To: domain.CurseArchived},
+}
+
 type (
 	Service interface {
-		Create(name, startDate, endDate string) (*domain.Curse, error)
-		GetAll(filters Fillters, offset, limit int) ([]domain.Curse, error)
+		Create(ctx context.Context, name, startDate, endDate string, capacity *int, catalog Catalog) (*domain.Curse, error)
+		GetAll(filters Fillters, sort sorting.Sort, offset, limit int) ([]domain.Curse, error)
+		GetAllAfter(filters Fillters, cursor *meta.Cursor, limit int) ([]domain.Curse, *meta.Cursor, error)
 		GetByID(id string) (*domain.Curse, error)
-		Update(id string, name, startDate, endDate *string) error
-		Delete(id string) error
+		Update(ctx context.Context, id string, version int, name, startDate, endDate *string, capacity *int, catalog Catalog) error
+		Delete(ctx context.Context, id string, version int) error
+		Restore(ctx context.Context, id string) error
+		Purge(ctx context.Context, id string) error
 		Count(filters Fillters) (int, error)
+		GetHistory(id string, offset, limit int) ([]domain.CurseVersion, error)
+		CountHistory(id string) (int, error)
+		GetVersion(id string, version int) (*domain.CurseVersion, error)
+		Revert(ctx context.Context, id string, version, ifMatch int) error
+		// Transition aplica una de las acciones del ciclo de vida del curso
+		Transition(ctx context.Context, id, action string) (*domain.Curse, error)
+		// CanManage indica si el usuario es instructor del curso y puede ver sus borradores
+		CanManage(curseID, userID string) (bool, error)
+		// CanTransition indica si el usuario es instructor lider del curso y puede cambiar su estado
+		CanTransition(curseID, userID string) (bool, error)
 	}
 
 	service struct {
 		log  *log.Logger
 		repo Repository
+		bus  events.Publisher
+	}
+
+	// UpdatedEvent se publica despues de modificar un curso
+	UpdatedEvent struct {
+		Before domain.Curse
+		After  domain.Curse
 	}
 
 	Fillters struct {
-		Name string
+		Name      string
+		StartFrom *time.Time
+		StartTo   *time.Time
+		EndFrom   *time.Time
+		EndTo     *time.Time
+		// State se calcula respecto a la fecha actual: upcoming, running o finished
+		State          string
+		SeatsAvailable *bool
+		// InstructorID deja los cursos donde ese usuario es instructor, con cualquier rol
+		InstructorID string
+		Status       string
+		// CategoryID incluye las subcategorias, el servicio las carga en CategoryIDs
+		CategoryID  string
+		CategoryIDs []string
+		// Tags deja los cursos que tienen todas las etiquetas
+		Tags        []string
+		Level       string
+		Language    string
+		MinDuration *int
+		MaxDuration *int
+		// Search busca en el nombre y la descripcion
+		Search   string
+		HasCover *bool
+		// HideDrafts oculta los borradores salvo los de los cursos donde Viewer es instructor
+		HideDrafts bool
+		Viewer     string
+		// solo los administradores pueden pedir los registros borrados
+		IncludeDeleted bool
+		OnlyDeleted    bool
 	}
 )
 
-func NewService(l *log.Logger, r Repository) Service {
+const (
+	StateUpcoming = "upcoming"
+	StateRunning  = "running"
+	StateFinished = "finished"
+)
+
+func NewService(l *log.Logger, r Repository, bus events.Publisher) Service {
 	return &service{
 		log:  l,
 		repo: r,
+		bus:  bus,
 	}
 }
 
-func (s service) Create(name, startDate, endDate string) (*domain.Curse, error) {
+func (s service) Create(ctx context.Context, name, startDate, endDate string, capacity *int, catalog Catalog) (*domain.Curse, error) {
+	if capacity != nil && *capacity < 1 {
+		return nil, fmt.Errorf("%w: capacity must be greater than 0", ErrInvalidCurse)
+	}
+
+	catalog, err := s.checkCatalog(catalog)
+	if err != nil {
+		return nil, err
+	}
 
 	startDateParsed, err := time.Parse("2006-01-02", startDate)
 	if err != nil {
@@ -48,13 +154,24 @@ func (s service) Create(name, startDate, endDate string) (*domain.Curse, error)
 		return nil, err
 	}
 
+	// los cursos nuevos empiezan como borrador hasta que se publican
 	curse := &domain.Curse{
 		Name:      name,
 		StartDate: startDateParsed,
 		EndDate:   endDateParsed,
+		Capacity:  capacity,
+		Status:    domain.CurseDraft,
 	}
+	setCatalog(curse, catalog)
 
-	if err := s.repo.Create(curse); err != nil {
+	err = s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		if err := repo.Create(curse, auth.Actor(ctx)); err != nil {
+			return err
+		}
+
+		return audit.Add(ctx, tx, audit.ActionCreate, audit.EntityCurse, curse.ID, nil, curse)
+	})
+	if err != nil {
 		s.log.Println(err)
 		return nil, err
 	}
@@ -62,8 +179,13 @@ func (s service) Create(name, startDate, endDate string) (*domain.Curse, error)
 	return curse, nil
 }
 
-func (s service) GetAll(filters Fillters, offset, limit int) ([]domain.Curse, error) {
-	curses, err := s.repo.GetAll(filters, offset, limit)
+func (s service) GetAll(filters Fillters, sort sorting.Sort, offset, limit int) ([]domain.Curse, error) {
+	filters, err := s.expandCategory(filters)
+	if err != nil {
+		return nil, err
+	}
+
+	curses, err := s.repo.GetAll(filters, sort, offset, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -71,6 +193,34 @@ func (s service) GetAll(filters Fillters, offset, limit int) ([]domain.Curse, er
 	return curses, nil
 }
 
+// GetAllAfter devuelve la pagina siguiente al cursor y el cursor de la proxima pagina,
+// que es nil cuando no hay mas registros
+func (s service) GetAllAfter(filters Fillters, cursor *meta.Cursor, limit int) ([]domain.Curse, *meta.Cursor, error) {
+	// pido un registro de mas para saber si existe una pagina siguiente
+	filters, err := s.expandCategory(filters)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	curses, err := s.repo.GetAllAfter(filters, cursor, limit+1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(curses) <= limit {
+		return curses, nil, nil
+	}
+
+	curses = curses[:limit]
+	last := curses[limit-1]
+	next := &meta.Cursor{ID: last.ID}
+	if last.CreatedAt != nil {
+		next.CreatedAt = *last.CreatedAt
+	}
+
+	return curses, next, nil
+}
+
 func (s service) GetByID(id string) (*domain.Curse, error) {
 	curse, err := s.repo.GetByID(id)
 	if err != nil {
@@ -80,7 +230,21 @@ func (s service) GetByID(id string) (*domain.Curse, error) {
 	return curse, nil
 }
 
-func (s service) Update(id string, name, startDate, endDate *string) error {
+func (s service) Update(ctx context.Context, id string, version int, name, startDate, endDate *string, capacity *int, catalog Catalog) error {
+	// se valida aca y no solo en el endpoint porque Revert tambien pasa por Update
+	if name != nil && strings.TrimSpace(*name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidCurse)
+	}
+
+	if capacity != nil && *capacity < 1 {
+		return fmt.Errorf("%w: capacity must be greater than 0", ErrInvalidCurse)
+	}
+
+	catalog, err := s.checkCatalog(catalog)
+	if err != nil {
+		return err
+	}
+
 	var startDateParsed, endDateParsed *time.Time
 
 	if startDate != nil {
@@ -101,13 +265,329 @@ func (s service) Update(id string, name, startDate, endDate *string) error {
 		endDateParsed = &date
 	}
 
-	return s.repo.Update(id, name, startDateParsed, endDateParsed)
+	before, err := s.repo.GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	if version > 0 && before.Version != version {
+		return ErrVersionConflict
+	}
+
+	var after *domain.Curse
+	err = s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		if err := repo.Update(id, version, name, startDateParsed, endDateParsed, capacity, catalog, auth.Actor(ctx)); err != nil {
+			return err
+		}
+
+		after, err = repo.GetByID(id)
+		if err != nil {
+			return err
+		}
+
+		// un cambio que deja todo igual no sube la version y no se audita ni se publica
+		if after.Version == before.Version {
+			return nil
+		}
+
+		return audit.Add(ctx, tx, audit.ActionUpdate, audit.EntityCurse, id, before, after)
+	})
+	if err != nil {
+		return err
+	}
+
+	if after.Version == before.Version {
+		return nil
+	}
+
+	if err := s.bus.Publish(ctx, UpdatedEvent{Before: *before, After: *after}); err != nil {
+		s.log.Println(err)
+	}
+
+	return nil
+}
+
+func (s service) Delete(ctx context.Context, id string, version int) error {
+	before, err := s.repo.GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	if version > 0 && before.Version != version {
+		return ErrVersionConflict
+	}
+
+	var changes []domain.EnrollmentStatusChange
+	err = s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		changes, err = repo.Delete(id, version)
+		if err != nil {
+			return err
+		}
+
+		// cada inscripcion cancelada por la politica de borrado queda auditada por separado
+		for _, change := range changes {
+			if err := audit.Add(ctx, tx, audit.ActionUpdate, audit.EntityEnrollment, change.ID,
+				map[string]string{"status": change.From}, map[string]string{"status": change.To}); err != nil {
+				return err
+			}
+		}
+
+		return audit.Add(ctx, tx, audit.ActionDelete, audit.EntityCurse, id, before, nil)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		if err := s.bus.Publish(ctx, change); err != nil {
+			s.log.Println(err)
+		}
+	}
+
+	return nil
 }
 
-func (s service) Delete(id string) error {
-	return s.repo.Delete(id)
+func (s service) Restore(ctx context.Context, id string) error {
+	return s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		if err := repo.Restore(id); err != nil {
+			return err
+		}
+
+		after, err := repo.GetByID(id)
+		if err != nil {
+			return err
+		}
+
+		return audit.Add(ctx, tx, audit.ActionRestore, audit.EntityCurse, id, nil, after)
+	})
+}
+
+func (s service) Purge(ctx context.Context, id string) error {
+	return s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		if err := repo.Purge(id); err != nil {
+			return err
+		}
+
+		return audit.Add(ctx, tx, audit.ActionPurge, audit.EntityCurse, id, nil, nil)
+	})
 }
 
 func (s service) Count(filters Fillters) (int, error) {
+	filters, err := s.expandCategory(filters)
+	if err != nil {
+		return 0, err
+	}
+
 	return s.repo.Count(filters)
 }
+
+func (s service) GetHistory(id string, offset, limit int) ([]domain.CurseVersion, error) {
+	return s.repo.GetVersions(id, offset, limit)
+}
+
+func (s service) CountHistory(id string) (int, error) {
+	return s.repo.CountVersions(id)
+}
+
+func (s service) GetVersion(id string, version int) (*domain.CurseVersion, error) {
+	return s.repo.GetVersion(id, version)
+}
+
+// Revert vuelve el curso a una version anterior pasando por las mismas validaciones que Update,
+// por eso genera una version nueva en lugar de borrar las posteriores.
+// ifMatch es la version actual que espera el cliente, 0 para no controlarla.
+func (s service) Revert(ctx context.Context, id string, version, ifMatch int) error {
+	v, err := s.repo.GetVersion(id, version)
+	if err != nil {
+		return err
+	}
+
+	name := v.Name
+	startDate := v.StartDate.Format("2006-01-02")
+	endDate := v.EndDate.Format("2006-01-02")
+
+	// la ficha se restaura completa: lo que la version no tenia se vacia
+	categoryID := ""
+	if v.CategoryID != nil {
+		categoryID = *v.CategoryID
+	}
+	tags := v.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	// si la version no tenia cupo o duracion se mantienen los actuales, Update no permite quitarlos
+	catalog := Catalog{
+		Description:   &v.Description,
+		CategoryID:    &categoryID,
+		Tags:          tags,
+		Level:         &v.Level,
+		Language:      &v.Language,
+		DurationHours: v.DurationHours,
+		CoverImageURL: &v.CoverImageURL,
+	}
+
+	return s.Update(ctx, id, ifMatch, &name, &startDate, &endDate, v.Capacity, catalog)
+}
+
+func (s service) Transition(ctx context.Context, id, action string) (*domain.Curse, error) {
+	t, ok := transitions[action]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown action %s", ErrInvalidTransition, action)
+	}
+
+	before, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !t.allows(before.Status) {
+		return nil, fmt.Errorf("%w: can't %s a curse with status %s", ErrInvalidTransition, strings.ReplaceAll(action, "_", " "), before.Status)
+	}
+
+	var after *domain.Curse
+	err = s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		if err := repo.SetStatus(id, before.Status, t.To, auth.Actor(ctx)); err != nil {
+			return err
+		}
+
+		after, err = repo.GetByID(id)
+		if err != nil {
+			return err
+		}
+
+		return audit.Add(ctx, tx, audit.ActionUpdate, audit.EntityCurse, id, before, after)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.bus.Publish(ctx, UpdatedEvent{Before: *before, After: *after}); err != nil {
+		s.log.Println(err)
+	}
+
+	return after, nil
+}
+
+func (s service) CanManage(curseID, userID string) (bool, error) {
+	return s.repo.IsInstructor(curseID, userID)
+}
+
+func (s service) CanTransition(curseID, userID string) (bool, error) {
+	return s.repo.IsLead(curseID, userID)
+}
+
+func (t transition) allows(status string) bool {
+	for _, from := range t.From {
+		if from == status {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCatalog valida los datos de la ficha y que exista la categoria
+func (s service) checkCatalog(catalog Catalog) (Catalog, error) {
+	catalog, err := catalog.normalize()
+	if err != nil {
+		return catalog, err
+	}
+
+	if catalog.CategoryID != nil && *catalog.CategoryID != "" {
+		ok, err := s.repo.CategoryExists(*catalog.CategoryID)
+		if err != nil {
+			return catalog, err
+		}
+
+		if !ok {
+			return catalog, fmt.Errorf("%w: category %s doesn't exist", ErrInvalidCatalog, *catalog.CategoryID)
+		}
+	}
+
+	return catalog, nil
+}
+
+// expandCategory agrega las subcategorias al filtro, un curso de una subcategoria tambien es de la categoria
+func (s service) expandCategory(filters Fillters) (Fillters, error) {
+	if filters.CategoryID == "" {
+		return filters, nil
+	}
+
+	ids, err := s.repo.CategoryDescendants(filters.CategoryID)
+	if err != nil {
+		return filters, err
+	}
+
+	filters.CategoryIDs = append([]string{filters.CategoryID}, ids...)
+	return filters, nil
+}
+
+func setCatalog(curse *domain.Curse, catalog Catalog) {
+	if catalog.Description != nil {
+		curse.Description = *catalog.Description
+	}
+
+	if catalog.CategoryID != nil && *catalog.CategoryID != "" {
+		curse.CategoryID = catalog.CategoryID
+	}
+
+	if catalog.Level != nil {
+		curse.Level = *catalog.Level
+	}
+
+	if catalog.Language != nil {
+		curse.Language = *catalog.Language
+	}
+
+	curse.DurationHours = catalog.DurationHours
+
+	if catalog.CoverImageURL != nil {
+		curse.CoverImageURL = *catalog.CoverImageURL
+	}
+
+	curse.Tags = curseTags(curse.ID, catalog.Tags)
+}
+
+func changed(before, after *domain.Curse) bool {
+	if before.Name != after.Name || !before.StartDate.Equal(after.StartDate) || !before.EndDate.Equal(after.EndDate) {
+		return true
+	}
+
+	if before.Description != after.Description || before.Level != after.Level || before.Language != after.Language ||
+		before.CoverImageURL != after.CoverImageURL || !sameString(before.CategoryID, after.CategoryID) ||
+		!sameInt(before.DurationHours, after.DurationHours) || !sameTags(before.Tags, after.Tags) {
+		return true
+	}
+
+	return !sameInt(before.Capacity, after.Capacity)
+}
+
+func sameString(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func sameInt(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func sameTags(a, b []domain.CurseTag) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	names := make(map[string]bool, len(a))
+	for _, t := range a {
+		names[t.Tag] = true
+	}
+	for _, t := range b {
+		if !names[t.Tag] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,11 @@
+package domain
+
+import "time"
+
+// UserAPIKey identifica a un usuario en el header X-API-Key. Solo se guarda el hash,
+// la key se muestra una vez al generarla
+type UserAPIKey struct {
+	UserID    string     `json:"user_id" gorm:"type:char(36);not null;primary_key"`
+	KeyHash   string     `json:"-" gorm:"type:char(64);not null;uniqueIndex"`
+	CreatedAt *time.Time `json:"created_at"`
+}
@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Attendance es la asistencia de un inscripto a una clase; SessionID es el ID de la ocurrencia
+type Attendance struct {
+	ID           string     `json:"id" gorm:"type:char(36);not null;primary_key;unique_index"`
+	CurseID      string     `json:"curse_id" gorm:"type:char(36);not null;index"`
+	SessionID    string     `json:"session_id" gorm:"type:varchar(60);not null;uniqueIndex:idx_attendance_session_user"`
+	SessionStart time.Time  `json:"session_start"`
+	EnrollmentID string     `json:"enrollment_id" gorm:"type:char(36);not null;index"`
+	UserID       string     `json:"user_id" gorm:"type:char(36);not null;uniqueIndex:idx_attendance_session_user"`
+	Status       string     `json:"status" gorm:"type:varchar(10);not null"`
+	Note         string     `json:"note,omitempty" gorm:"type:varchar(255)"`
+	MarkedBy     string     `json:"marked_by" gorm:"type:varchar(64)"`
+	CreatedAt    *time.Time `json:"created_at"`
+	UpdateAt     *time.Time `json:"-"`
+}
+
+const (
+	AttendancePresent = "present"
+	AttendanceAbsent  = "absent"
+	AttendanceLate    = "late"
+	AttendanceExcused = "excused"
+)
+
+func (a *Attendance) BeforeCreate(tx *gorm.DB) (err error) {
+	if a.ID == "" {
+		a.ID = uuid.New().String()
+	}
+	return
+}
@@ -0,0 +1,27 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type AuditLog struct {
+	ID         string          `json:"id" gorm:"type:char(36);not null;primary_key;unique_index"`
+	Actor      string          `json:"actor" gorm:"type:varchar(64);not null"`
+	Action     string          `json:"action" gorm:"type:varchar(20);not null"`
+	EntityType string          `json:"entity_type" gorm:"type:varchar(20);not null;index:idx_audit_entity"`
+	EntityID   string          `json:"entity_id" gorm:"type:char(36);not null;index:idx_audit_entity"`
+	Changes    json.RawMessage `json:"changes" gorm:"type:json"`
+	RequestID  string          `json:"request_id" gorm:"type:varchar(64)"`
+	CreatedAt  *time.Time      `json:"created_at"`
+}
+
+func (a *AuditLog) BeforeCreate(tx *gorm.DB) (err error) {
+	if a.ID == "" {
+		a.ID = uuid.New().String()
+	}
+	return
+}
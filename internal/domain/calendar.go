@@ -0,0 +1,11 @@
+package domain
+
+import "time"
+
+// CalendarToken permite suscribirse al calendario de un usuario sin iniciar sesion.
+// Solo se guarda el hash, el token se muestra una vez al generarlo
+type CalendarToken struct {
+	UserID    string     `json:"user_id" gorm:"type:char(36);not null;primary_key"`
+	TokenHash string     `json:"-" gorm:"type:char(64);not null;uniqueIndex"`
+	CreatedAt *time.Time `json:"created_at"`
+}
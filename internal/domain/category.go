@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Category es una categoria del catalogo, ParentID nil es una categoria raiz
+type Category struct {
+	ID        string     `json:"id" gorm:"type:char(36);not null;primary_key;unique_index"`
+	Name      string     `json:"name" gorm:"type:varchar(60);not null"`
+	Slug      string     `json:"slug" gorm:"type:varchar(80);not null;uniqueIndex"`
+	ParentID  *string    `json:"parent_id,omitempty" gorm:"type:char(36);index"`
+	Children  []Category `json:"children,omitempty" gorm:"-"`
+	CreatedAt *time.Time `json:"-"`
+	UpdateAt  *time.Time `json:"-"`
+}
+
+func (c *Category) BeforeCreate(tx *gorm.DB) (err error) {
+	if c.ID == "" {
+		c.ID = uuid.New().String()
+	}
+	return
+}
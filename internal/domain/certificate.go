@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Certificate se emite al aprobar una inscripcion. Guarda los nombres como estaban al emitirlo
+// para que el PDF y la verificacion no cambien si despues se edita el usuario o el curso
+type Certificate struct {
+	ID           string    `json:"id" gorm:"type:char(36);not null;primary_key;unique_index"`
+	Code         string    `json:"code" gorm:"type:varchar(40);not null;uniqueIndex"`
+	EnrollmentID string    `json:"enrollment_id" gorm:"type:char(36);not null;uniqueIndex"`
+	UserID       string    `json:"user_id" gorm:"type:char(36);not null;index"`
+	CurseID      string    `json:"curse_id" gorm:"type:char(36);not null;index"`
+	HolderName   string    `json:"holder_name" gorm:"type:varchar(120);not null"`
+	CurseName    string    `json:"curse_name" gorm:"type:varchar(50);not null"`
+	StartDate    time.Time `json:"start_date"`
+	EndDate      time.Time `json:"end_date"`
+	IssuedAt     time.Time `json:"issued_at"`
+}
+
+func (c *Certificate) BeforeCreate(tx *gorm.DB) (err error) {
+	if c.ID == "" {
+		c.ID = uuid.New().String()
+	}
+	return
+}
@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,14 +13,60 @@ type Curse struct {
 	Name      string         `json:"name" gorm:"type:char(50);not null"`
 	StartDate time.Time      `json:"start_date"`
 	EndDate   time.Time      `json:"end_date"`
+	Capacity  *int           `json:"capacity,omitempty"`
+	Status    string         `json:"status" gorm:"type:varchar(20);not null;default:published;index"`
+	Version   int            `json:"-" gorm:"not null;default:1"`
 	CreatedAt *time.Time     `json:"-"`
 	UpdateAt  *time.Time     `json:"-"`
 	Deleted   gorm.DeletedAt `json:"-"`
+
+	// datos de la ficha del catalogo, Description es markdown y lo renderiza el cliente
+	Description   string     `json:"description,omitempty" gorm:"type:text"`
+	CategoryID    *string    `json:"category_id,omitempty" gorm:"type:char(36);index"`
+	Tags          []CurseTag `json:"tags,omitempty" gorm:"foreignKey:CurseID"`
+	Level         string     `json:"level,omitempty" gorm:"type:varchar(20);index"`
+	Language      string     `json:"language,omitempty" gorm:"type:varchar(10);index"`
+	DurationHours *int       `json:"duration_hours,omitempty"`
+	CoverImageURL string     `json:"cover_image_url,omitempty" gorm:"type:varchar(500)"`
+}
+
+// estados del ciclo de vida del curso; la columna tiene published por defecto para los que ya existian
+const (
+	// CurseDraft no se muestra en el listado publico ni acepta inscripciones
+	CurseDraft     = "draft"
+	CursePublished = "published"
+	// CurseEnrollmentClosed se sigue mostrando pero no acepta inscripciones nuevas
+	CurseEnrollmentClosed = "enrollment_closed"
+	CurseArchived         = "archived"
+)
+
+const (
+	LevelBeginner     = "beginner"
+	LevelIntermediate = "intermediate"
+	LevelAdvanced     = "advanced"
+)
+
+// CurseTag es una etiqueta libre del curso, en json se muestra solo el texto
+type CurseTag struct {
+	CurseID string `gorm:"type:char(36);not null;primary_key"`
+	Tag     string `gorm:"type:varchar(30);not null;primary_key;index"`
+}
+
+func (t CurseTag) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Tag)
+}
+
+func (t *CurseTag) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &t.Tag)
 }
 
 func (c *Curse) BeforeCreate(tx *gorm.DB) (err error) {
 	if c.ID == "" {
 		c.ID = uuid.New().String()
 	}
+
+	if c.Version == 0 {
+		c.Version = 1
+	}
 	return
 }
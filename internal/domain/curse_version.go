@@ -0,0 +1,38 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CurseVersion es una foto de un curso despues de cada modificacion
+type CurseVersion struct {
+	ID        string     `json:"id" gorm:"type:char(36);not null;primary_key;unique_index"`
+	CurseID   string     `json:"curse_id" gorm:"type:char(36);not null;uniqueIndex:idx_curse_version"`
+	Version   int        `json:"version" gorm:"not null;uniqueIndex:idx_curse_version"`
+	Name      string     `json:"name" gorm:"type:char(50);not null"`
+	StartDate time.Time  `json:"start_date"`
+	EndDate   time.Time  `json:"end_date"`
+	Capacity  *int       `json:"capacity,omitempty"`
+	Status    string     `json:"status,omitempty" gorm:"type:varchar(20)"`
+	Actor     string     `json:"actor" gorm:"type:varchar(64)"`
+	CreatedAt *time.Time `json:"created_at"`
+
+	// datos de la ficha del catalogo en esa version
+	Description   string   `json:"description,omitempty" gorm:"type:text"`
+	CategoryID    *string  `json:"category_id,omitempty" gorm:"type:char(36)"`
+	Tags          []string `json:"tags,omitempty" gorm:"type:text;serializer:json"`
+	Level         string   `json:"level,omitempty" gorm:"type:varchar(20)"`
+	Language      string   `json:"language,omitempty" gorm:"type:varchar(10)"`
+	DurationHours *int     `json:"duration_hours,omitempty"`
+	CoverImageURL string   `json:"cover_image_url,omitempty" gorm:"type:varchar(500)"`
+}
+
+func (v *CurseVersion) BeforeCreate(tx *gorm.DB) (err error) {
+	if v.ID == "" {
+		v.ID = uuid.New().String()
+	}
+	return
+}
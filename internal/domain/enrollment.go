@@ -16,6 +16,7 @@ type Enrollment struct {
 	CurseID   string     `json:"curse_id,omitempty" gorm:"type:char(36)"`
 	Curse     *Curse     `json:"curse,omitempty"`
 	Status    string     `json:"status" gorm:"type:char(2)"`
+	Version   int        `json:"-" gorm:"not null;default:1"`
 	CreatedAt *time.Time `json:"-"`
 	UpdateAt  *time.Time `json:"-"`
 }
@@ -25,5 +26,39 @@ func (e *Enrollment) BeforeCreate(tx *gorm.DB) (err error) {
 	if e.ID == "" {
 		e.ID = uuid.New().String()
 	}
+
+	if e.Version == 0 {
+		e.Version = 1
+	}
 	return
 }
+
+const (
+	EnrollmentPending   = "P"
+	EnrollmentCancelled = "C"
+	// EnrollmentCompleted es la inscripcion aprobada al cerrar las notas
+	EnrollmentCompleted = "D"
+	// EnrollmentFailed es la inscripcion que no aprobo, por asistencia o por nota
+	EnrollmentFailed = "F"
+)
+
+// EnrollmentStatusChange describe un cambio de estado de una inscripcion
+type EnrollmentStatusChange struct {
+	ID      string `json:"id"`
+	UserID  string `json:"user_id"`
+	CurseID string `json:"curse_id"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+}
+
+// EnrollmentActiveStatuses son los estados que ocupan un lugar en el curso
+var EnrollmentActiveStatuses = []string{EnrollmentPending}
+
+// DeletePolicy indica que pasa con las inscripciones al borrar un usuario o un curso
+type DeletePolicy string
+
+const (
+	DeleteKeep   DeletePolicy = "keep"
+	DeleteCancel DeletePolicy = "cancel"
+	DeleteBlock  DeletePolicy = "block"
+)
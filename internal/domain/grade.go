@@ -0,0 +1,75 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// GradeScaleNumeric informa el porcentaje redondeado, GradeScaleLetter lo pasa a A-F
+	// y GradeScalePassFail solo dice si aprobo
+	GradeScaleNumeric  = "numeric"
+	GradeScaleLetter   = "letter"
+	GradeScalePassFail = "pass_fail"
+)
+
+// GradingPolicy es la escala de notas del curso; PassMark es el porcentaje minimo para aprobar
+type GradingPolicy struct {
+	CurseID  string     `json:"curse_id" gorm:"type:char(36);not null;primary_key"`
+	Scale    string     `json:"scale" gorm:"type:varchar(10);not null"`
+	PassMark float64    `json:"pass_mark" gorm:"not null"`
+	UpdateAt *time.Time `json:"-"`
+}
+
+// Assessment es una evaluacion del curso, las notas se ponderan con Weight
+type Assessment struct {
+	ID        string     `json:"id" gorm:"type:char(36);not null;primary_key;unique_index"`
+	CurseID   string     `json:"curse_id" gorm:"type:char(36);not null;index"`
+	Name      string     `json:"name" gorm:"type:varchar(100);not null"`
+	Weight    float64    `json:"weight" gorm:"not null"`
+	MaxScore  float64    `json:"max_score" gorm:"not null"`
+	DueDate   *time.Time `json:"due_date,omitempty"`
+	CreatedAt *time.Time `json:"-"`
+	UpdateAt  *time.Time `json:"-"`
+}
+
+func (a *Assessment) BeforeCreate(tx *gorm.DB) (err error) {
+	if a.ID == "" {
+		a.ID = uuid.New().String()
+	}
+	return
+}
+
+// Score es la nota de un inscripto en una evaluacion
+type Score struct {
+	ID           string     `json:"id" gorm:"type:char(36);not null;primary_key;unique_index"`
+	AssessmentID string     `json:"assessment_id" gorm:"type:char(36);not null;uniqueIndex:idx_score_assessment_enrollment"`
+	EnrollmentID string     `json:"enrollment_id" gorm:"type:char(36);not null;uniqueIndex:idx_score_assessment_enrollment"`
+	CurseID      string     `json:"curse_id" gorm:"type:char(36);not null;index"`
+	UserID       string     `json:"user_id" gorm:"type:char(36);not null;index"`
+	Value        float64    `json:"value" gorm:"not null"`
+	GradedBy     string     `json:"graded_by" gorm:"type:varchar(64)"`
+	CreatedAt    *time.Time `json:"-"`
+	UpdateAt     *time.Time `json:"-"`
+}
+
+func (s *Score) BeforeCreate(tx *gorm.DB) (err error) {
+	if s.ID == "" {
+		s.ID = uuid.New().String()
+	}
+	return
+}
+
+// FinalGrade es la nota final de una inscripcion, una vez guardada no se recalcula
+type FinalGrade struct {
+	EnrollmentID string    `json:"enrollment_id" gorm:"type:char(36);not null;primary_key"`
+	CurseID      string    `json:"curse_id" gorm:"type:char(36);not null;index"`
+	UserID       string    `json:"user_id" gorm:"type:char(36);not null;index"`
+	Percentage   float64   `json:"percentage"`
+	Grade        string    `json:"grade" gorm:"type:varchar(10);not null"`
+	Passed       bool      `json:"passed"`
+	FinalizedBy  string    `json:"finalized_by" gorm:"type:varchar(64)"`
+	FinalizedAt  time.Time `json:"finalized_at"`
+}
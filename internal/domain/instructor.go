@@ -0,0 +1,19 @@
+package domain
+
+import "time"
+
+// CurseInstructor asigna un usuario como instructor de un curso
+type CurseInstructor struct {
+	CurseID   string     `json:"curse_id" gorm:"type:char(36);not null;primary_key"`
+	Curse     *Curse     `json:"curse,omitempty"`
+	UserID    string     `json:"user_id" gorm:"type:char(36);not null;primary_key;index"`
+	User      *User      `json:"user,omitempty"`
+	Role      string     `json:"role" gorm:"type:varchar(20);not null"`
+	CreatedAt *time.Time `json:"created_at"`
+	UpdateAt  *time.Time `json:"-"`
+}
+
+const (
+	InstructorLead      = "lead"
+	InstructorAssistant = "assistant"
+)
@@ -0,0 +1,51 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Notification es un email ya renderizado que espera en cola a ser enviado
+type Notification struct {
+	ID     string `json:"id" gorm:"type:char(36);not null;primary_key;unique_index"`
+	UserID string `json:"user_id" gorm:"type:char(36);not null;index"`
+	Kind   string `json:"kind" gorm:"type:varchar(50);not null"`
+	// DedupeKey evita encolar dos veces el mismo aviso, por ejemplo un recordatorio
+	DedupeKey     *string    `json:"-" gorm:"type:varchar(150);uniqueIndex"`
+	To            string     `json:"to" gorm:"type:varchar(50);not null"`
+	Subject       string     `json:"subject" gorm:"type:varchar(255);not null"`
+	Text          string     `json:"-" gorm:"type:text"`
+	HTML          string     `json:"-" gorm:"type:text"`
+	Status        string     `json:"status" gorm:"type:varchar(20);not null;index:idx_notification_due"`
+	Attempts      int        `json:"attempts" gorm:"not null"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" gorm:"index:idx_notification_due"`
+	LastError     string     `json:"last_error" gorm:"type:varchar(255)"`
+	SentAt        *time.Time `json:"sent_at"`
+	CreatedAt     *time.Time `json:"created_at"`
+	UpdateAt      *time.Time `json:"-"`
+}
+
+// NotificationPreference guarda lo que eligio cada usuario, si no tiene fila recibe todo
+type NotificationPreference struct {
+	UserID      string     `json:"user_id" gorm:"type:char(36);not null;primary_key"`
+	EmailOptOut bool       `json:"email_opt_out" gorm:"not null;default:false"`
+	Locale      string     `json:"locale" gorm:"type:varchar(10)"`
+	CreatedAt   *time.Time `json:"-"`
+	UpdateAt    *time.Time `json:"-"`
+}
+
+const (
+	NotificationPending = "pending"
+	NotificationSent    = "sent"
+	// NotificationFailed queda cuando se agotaron los reintentos
+	NotificationFailed = "failed"
+)
+
+func (n *Notification) BeforeCreate(tx *gorm.DB) (err error) {
+	if n.ID == "" {
+		n.ID = uuid.New().String()
+	}
+	return
+}
@@ -0,0 +1,10 @@
+package domain
+
+import "time"
+
+// CursePrerequisite indica que para inscribirse en CurseID hay que haber aprobado PrerequisiteID
+type CursePrerequisite struct {
+	CurseID        string     `json:"curse_id" gorm:"type:char(36);not null;primary_key"`
+	PrerequisiteID string     `json:"prerequisite_id" gorm:"type:char(36);not null;primary_key;index"`
+	CreatedAt      *time.Time `json:"-"`
+}
@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CurseSchedule es una regla de recurrencia de las clases de un curso, por ejemplo
+// FREQ=WEEKLY;BYDAY=MO,WE de 18:00 a 20:00 en Europe/Madrid. Las horas se guardan
+// como hora local de Timezone para que los cambios de horario no las muevan
+type CurseSchedule struct {
+	ID        string     `json:"id" gorm:"type:char(36);not null;primary_key;unique_index"`
+	CurseID   string     `json:"curse_id" gorm:"type:char(36);not null;index"`
+	RRule     string     `json:"rrule" gorm:"type:varchar(255);not null"`
+	StartTime string     `json:"start_time" gorm:"type:char(5);not null"`
+	EndTime   string     `json:"end_time" gorm:"type:char(5);not null"`
+	Timezone  string     `json:"timezone" gorm:"type:varchar(64);not null"`
+	CreatedAt *time.Time `json:"created_at"`
+	UpdateAt  *time.Time `json:"-"`
+}
+
+// CurseSession es una clase puntual: una clase extra (sin ScheduleID), o el cambio o la
+// cancelacion de una ocurrencia de un CurseSchedule, identificada por OriginalStart
+type CurseSession struct {
+	ID            string     `json:"id" gorm:"type:char(36);not null;primary_key;unique_index"`
+	CurseID       string     `json:"curse_id" gorm:"type:char(36);not null;index"`
+	ScheduleID    *string    `json:"schedule_id,omitempty" gorm:"type:char(36);uniqueIndex:idx_session_occurrence"`
+	OriginalStart *time.Time `json:"original_start,omitempty" gorm:"uniqueIndex:idx_session_occurrence"`
+	StartsAt      time.Time  `json:"starts_at" gorm:"not null"`
+	EndsAt        time.Time  `json:"ends_at" gorm:"not null"`
+	Timezone      string     `json:"timezone" gorm:"type:varchar(64);not null"`
+	Cancelled     bool       `json:"cancelled" gorm:"not null;default:false"`
+	Note          string     `json:"note,omitempty" gorm:"type:varchar(255)"`
+	CreatedAt     *time.Time `json:"created_at"`
+	UpdateAt      *time.Time `json:"-"`
+
+	// Revision sube con cada cambio y nunca baja, los calendarios la usan como SEQUENCE
+	Revision int `json:"revision" gorm:"not null;default:0"`
+}
+
+// Occurrence es una clase ya calculada a partir de las reglas y las clases puntuales,
+// no se guarda en la base
+type Occurrence struct {
+	// ID es el de la CurseSession o <schedule_id>_<inicio original en UTC> si sale de la regla
+	ID            string     `json:"id"`
+	CurseID       string     `json:"curse_id"`
+	ScheduleID    string     `json:"schedule_id,omitempty"`
+	StartsAt      time.Time  `json:"starts_at"`
+	EndsAt        time.Time  `json:"ends_at"`
+	Timezone      string     `json:"timezone"`
+	Status        string     `json:"status"`
+	OriginalStart *time.Time `json:"original_start,omitempty"`
+	Note          string     `json:"note,omitempty"`
+
+	Revision int `json:"revision"`
+}
+
+const (
+	OccurrenceScheduled   = "scheduled"
+	OccurrenceRescheduled = "rescheduled"
+	OccurrenceCancelled   = "cancelled"
+)
+
+func (s *CurseSchedule) BeforeCreate(tx *gorm.DB) (err error) {
+	if s.ID == "" {
+		s.ID = uuid.New().String()
+	}
+	return
+}
+
+func (s *CurseSession) BeforeCreate(tx *gorm.DB) (err error) {
+	if s.ID == "" {
+		s.ID = uuid.New().String()
+	}
+	return
+}
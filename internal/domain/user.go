@@ -9,10 +9,11 @@ import (
 
 type User struct {
 	ID        string         `json:"id" gorm:"type:char(36);not null;primary_key;unique_index"`
-	FirstName string         `json:"first_name" gorm:"type:char(50);not null"`
-	LastName  string         `json:"last_name" gorm:"type:char(30);not null"`
-	Email     string         `json:"email" gorm:"type:char(50);not null"`
+	FirstName string         `json:"first_name" gorm:"type:char(50);not null;index:idx_users_search,class:FULLTEXT"`
+	LastName  string         `json:"last_name" gorm:"type:char(30);not null;index:idx_users_search,class:FULLTEXT"`
+	Email     string         `json:"email" gorm:"type:char(50);not null;index:idx_users_search,class:FULLTEXT"`
 	Phone     string         `json:"phone" gorm:"type:char(20);not null"`
+	Version   int            `json:"-" gorm:"not null;default:1"`
 	CreatedAt *time.Time     `json:"-"`
 	UpdateAt  *time.Time     `json:"-"`
 	Deleted   gorm.DeletedAt `json:"-"`
@@ -22,5 +23,9 @@ func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
 	if u.ID == "" {
 		u.ID = uuid.New().String()
 	}
+
+	if u.Version == 0 {
+		u.Version = 1
+	}
 	return
 }
@@ -0,0 +1,77 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// OutboxEvent se guarda en la misma transaccion que el cambio que lo genera
+// y despues el dispatcher lo reparte a los webhooks suscriptos
+type OutboxEvent struct {
+	ID           string          `json:"id" gorm:"type:char(36);not null;primary_key;unique_index"`
+	Type         string          `json:"type" gorm:"type:varchar(50);not null"`
+	EntityID     string          `json:"entity_id" gorm:"type:char(36);not null"`
+	Payload      json.RawMessage `json:"payload" gorm:"type:json"`
+	DispatchedAt *time.Time      `json:"dispatched_at" gorm:"index"`
+	CreatedAt    *time.Time      `json:"created_at"`
+}
+
+type Webhook struct {
+	ID  string `json:"id" gorm:"type:char(36);not null;primary_key;unique_index"`
+	URL string `json:"url" gorm:"type:varchar(255);not null"`
+	// Secret se usa para firmar las entregas con HMAC, solo se muestra al crearlo
+	Secret string `json:"secret,omitempty" gorm:"type:varchar(64);not null"`
+	// Events es la lista de tipos separados por coma, "*" para todos
+	Events    string         `json:"events" gorm:"type:varchar(255);not null"`
+	Active    bool           `json:"active" gorm:"not null;default:true"`
+	CreatedAt *time.Time     `json:"created_at"`
+	UpdateAt  *time.Time     `json:"-"`
+	Deleted   gorm.DeletedAt `json:"-"`
+}
+
+type WebhookDelivery struct {
+	ID             string       `json:"id" gorm:"type:char(36);not null;primary_key;unique_index"`
+	WebhookID      string       `json:"webhook_id" gorm:"type:char(36);not null;index"`
+	Webhook        *Webhook     `json:"-"`
+	EventID        string       `json:"event_id" gorm:"type:char(36);not null"`
+	Event          *OutboxEvent `json:"event,omitempty"`
+	Status         string       `json:"status" gorm:"type:varchar(20);not null;index:idx_delivery_due"`
+	Attempts       int          `json:"attempts" gorm:"not null"`
+	NextAttemptAt  time.Time    `json:"next_attempt_at" gorm:"index:idx_delivery_due"`
+	ResponseStatus int          `json:"response_status"`
+	LastError      string       `json:"last_error" gorm:"type:varchar(255)"`
+	DeliveredAt    *time.Time   `json:"delivered_at"`
+	CreatedAt      *time.Time   `json:"created_at"`
+	UpdateAt       *time.Time   `json:"-"`
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	// DeliveryDead queda cuando se agotaron los reintentos
+	DeliveryDead = "dead"
+)
+
+func (e *OutboxEvent) BeforeCreate(tx *gorm.DB) (err error) {
+	if e.ID == "" {
+		e.ID = uuid.New().String()
+	}
+	return
+}
+
+func (w *Webhook) BeforeCreate(tx *gorm.DB) (err error) {
+	if w.ID == "" {
+		w.ID = uuid.New().String()
+	}
+	return
+}
+
+func (d *WebhookDelivery) BeforeCreate(tx *gorm.DB) (err error) {
+	if d.ID == "" {
+		d.ID = uuid.New().String()
+	}
+	return
+}
@@ -0,0 +1,71 @@
+package enrollment
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+)
+
+// ErrScheduleConflict se devuelve cuando las clases del curso se superponen con otro curso del usuario
+var ErrScheduleConflict = errors.New("schedule conflicts with other enrollments")
+
+type (
+	// Conflict es un par de clases que se superponen
+	Conflict struct {
+		SessionID         string    `json:"session_id"`
+		StartsAt          time.Time `json:"starts_at"`
+		EndsAt            time.Time `json:"ends_at"`
+		ConflictCurseID   string    `json:"conflict_curse_id"`
+		ConflictCurseName string    `json:"conflict_curse_name"`
+		ConflictSessionID string    `json:"conflict_session_id"`
+		ConflictStartsAt  time.Time `json:"conflict_starts_at"`
+		ConflictEndsAt    time.Time `json:"conflict_ends_at"`
+	}
+
+	ConflictError struct {
+		Conflicts []Conflict
+	}
+)
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s: %d overlapping sessions", ErrScheduleConflict, len(e.Conflicts))
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrScheduleConflict
+}
+
+// overlaps compara las clases no canceladas; los intervalos son [inicio, fin), asi una clase
+// que termina a las 20:00 no choca con otra que empieza a las 20:00
+func overlaps(sessions []domain.Occurrence, other domain.Curse, otherSessions []domain.Occurrence) []Conflict {
+	var conflicts []Conflict
+
+	for _, a := range sessions {
+		if a.Status == domain.OccurrenceCancelled {
+			continue
+		}
+
+		for _, b := range otherSessions {
+			if b.Status == domain.OccurrenceCancelled {
+				continue
+			}
+
+			if a.StartsAt.Before(b.EndsAt) && b.StartsAt.Before(a.EndsAt) {
+				conflicts = append(conflicts, Conflict{
+					SessionID:         a.ID,
+					StartsAt:          a.StartsAt,
+					EndsAt:            a.EndsAt,
+					ConflictCurseID:   other.ID,
+					ConflictCurseName: other.Name,
+					ConflictSessionID: b.ID,
+					ConflictStartsAt:  b.StartsAt,
+					ConflictEndsAt:    b.EndsAt,
+				})
+			}
+		}
+	}
+
+	return conflicts
+}
@@ -2,9 +2,11 @@ package enrollment
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
+	"github.com/MartinZitterkopf/gocurse_web/pkg/auth"
 	"github.com/MartinZitterkopf/gocurse_web/pkg/meta"
 )
 
@@ -18,6 +20,10 @@ type (
 	CreateReq struct {
 		UserID  string `json:"user_id"`
 		CurseID string `json:"curse_id"`
+		// AllowConflicts inscribe aunque se superpongan las clases, solo para administradores
+		AllowConflicts bool `json:"allow_conflicts"`
+		// SkipPrerequisites inscribe sin haber aprobado los cursos previos, solo para administradores
+		SkipPrerequisites bool `json:"skip_prerequisites"`
 	}
 
 	Response struct {
@@ -53,8 +59,41 @@ func MakeCreateEndpoint(s Service) Controller {
 			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "curse id is required"})
 		}
 
-		enroll, err := s.Create(req.UserID, req.CurseID)
+		if req.AllowConflicts && !auth.IsAdmin(r) {
+			w.WriteHeader(403)
+			json.NewEncoder(w).Encode(&Response{Status: 403, Err: "only admins can use allow_conflicts"})
+			return
+		}
+
+		if req.SkipPrerequisites && !auth.IsAdmin(r) {
+			w.WriteHeader(403)
+			json.NewEncoder(w).Encode(&Response{Status: 403, Err: "only admins can use skip_prerequisites"})
+			return
+		}
+
+		opts := CreateOptions{AllowConflicts: req.AllowConflicts, SkipPrerequisites: req.SkipPrerequisites}
+		enroll, err := s.Create(r.Context(), req.UserID, req.CurseID, opts)
 		if err != nil {
+			if errors.Is(err, ErrCurseNotOpen) {
+				w.WriteHeader(409)
+				json.NewEncoder(w).Encode(&Response{Status: 409, Err: err.Error()})
+				return
+			}
+
+			var missing *PrerequisitesError
+			if errors.As(err, &missing) {
+				w.WriteHeader(409)
+				json.NewEncoder(w).Encode(&Response{Status: 409, Data: missing.Missing, Err: err.Error()})
+				return
+			}
+
+			var conflict *ConflictError
+			if errors.As(err, &conflict) {
+				w.WriteHeader(409)
+				json.NewEncoder(w).Encode(&Response{Status: 409, Data: conflict.Conflicts, Err: err.Error()})
+				return
+			}
+
 			w.WriteHeader(400)
 			json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
 			return
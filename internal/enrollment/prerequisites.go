@@ -0,0 +1,43 @@
+package enrollment
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+)
+
+// ErrMissingPrerequisites se devuelve cuando el usuario no aprobo todos los cursos que pide el curso
+var ErrMissingPrerequisites = errors.New("missing prerequisites")
+
+type (
+	MissingPrerequisite struct {
+		CurseID   string `json:"curse_id"`
+		CurseName string `json:"curse_name"`
+	}
+
+	PrerequisitesError struct {
+		Missing []MissingPrerequisite
+	}
+)
+
+func newPrerequisitesError(curses []domain.Curse) *PrerequisitesError {
+	e := &PrerequisitesError{}
+	for _, c := range curses {
+		e.Missing = append(e.Missing, MissingPrerequisite{CurseID: c.ID, CurseName: strings.TrimSpace(c.Name)})
+	}
+	return e
+}
+
+func (e *PrerequisitesError) Error() string {
+	names := make([]string, 0, len(e.Missing))
+	for _, m := range e.Missing {
+		names = append(names, m.CurseName)
+	}
+	return fmt.Sprintf("%s: %s", ErrMissingPrerequisites, strings.Join(names, ", "))
+}
+
+func (e *PrerequisitesError) Is(target error) bool {
+	return target == ErrMissingPrerequisites
+}
@@ -4,12 +4,17 @@ import (
 	"log"
 
 	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"github.com/MartinZitterkopf/gocurse_web/internal/outbox"
 	"gorm.io/gorm"
 )
 
 type (
 	Repository interface {
+		// Transaction corre fn con un Repository que usa tx, la transaccion que tambien recibe fn
+		Transaction(fn func(repo Repository, tx *gorm.DB) error) error
 		Create(enroll *domain.Enrollment) error
+		// GetActiveCurses devuelve los cursos con inscripcion activa del usuario
+		GetActiveCurses(userID string) ([]domain.Curse, error)
 	}
 
 	repo struct {
@@ -25,9 +30,24 @@ func NewRepo(l *log.Logger, db *gorm.DB) Repository {
 	}
 }
 
+func (r *repo) Transaction(fn func(repo Repository, tx *gorm.DB) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		txRepo := *r
+		txRepo.db = tx
+		return fn(&txRepo, tx)
+	})
+}
+
 func (r *repo) Create(enroll *domain.Enrollment) error {
 
-	if err := r.db.Create(enroll).Error; err != nil {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(enroll).Error; err != nil {
+			return err
+		}
+
+		return outbox.Add(tx, outbox.EnrollmentCreated, enroll.ID, enroll)
+	})
+	if err != nil {
 		r.log.Printf("error: %v", err)
 		return err
 	}
@@ -35,3 +55,16 @@ func (r *repo) Create(enroll *domain.Enrollment) error {
 	r.log.Println("enrollment created with id: ", enroll.ID)
 	return nil
 }
+
+func (r *repo) GetActiveCurses(userID string) ([]domain.Curse, error) {
+	var curses []domain.Curse
+
+	err := r.db.Joins("JOIN enrollments ON enrollments.curse_id = curses.id").
+		Where("enrollments.user_id = ? AND enrollments.status IN ?", userID, domain.EnrollmentActiveStatuses).
+		Find(&curses).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return curses, nil
+}
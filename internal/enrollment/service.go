@@ -1,56 +1,165 @@
 package enrollment
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log"
 
+	"github.com/MartinZitterkopf/gocurse_web/internal/audit"
 	"github.com/MartinZitterkopf/gocurse_web/internal/curse"
 	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"github.com/MartinZitterkopf/gocurse_web/internal/prerequisite"
+	"github.com/MartinZitterkopf/gocurse_web/internal/session"
 	"github.com/MartinZitterkopf/gocurse_web/internal/user"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/events"
+	"gorm.io/gorm"
 )
 
+// ErrCurseNotOpen se devuelve al inscribirse en un curso que no esta publicado
+var ErrCurseNotOpen = errors.New("curse is not open for enrollment")
+
 type (
 	Service interface {
-		Create(userID, curseID string) (*domain.Enrollment, error)
+		Create(ctx context.Context, userID, curseID string, opts CreateOptions) (*domain.Enrollment, error)
+	}
+
+	// CreateOptions son las excepciones que solo puede pedir un administrador
+	CreateOptions struct {
+		AllowConflicts bool
+		// SkipPrerequisites inscribe aunque no haya aprobado los cursos previos
+		SkipPrerequisites bool
 	}
 
 	service struct {
 		log          *log.Logger
 		userService  user.Service
 		curseService curse.Service
+		sessions     session.Service
+		prerequisite prerequisite.Service
 		repo         Repository
+		bus          events.Publisher
+	}
+
+	// CreatedEvent se publica despues de inscribir a un usuario, los efectos secundarios
+	// (emails, estadisticas, etc.) se suscriben a este evento en lugar de agregarse a Create
+	CreatedEvent struct {
+		Enrollment domain.Enrollment
 	}
 )
 
-func NewService(l *log.Logger, userSvc user.Service, curseSvc curse.Service, r Repository) Service {
+func NewService(l *log.Logger, userSvc user.Service, curseSvc curse.Service, sessionSvc session.Service, prerequisiteSvc prerequisite.Service, r Repository, bus events.Publisher) Service {
 	return &service{
 		log:          l,
 		userService:  userSvc,
 		curseService: curseSvc,
+		sessions:     sessionSvc,
+		prerequisite: prerequisiteSvc,
 		repo:         r,
+		bus:          bus,
 	}
 }
 
-func (s service) Create(userID, curseID string) (*domain.Enrollment, error) {
+func (s service) Create(ctx context.Context, userID, curseID string, opts CreateOptions) (*domain.Enrollment, error) {
 
 	enroll := &domain.Enrollment{
 		UserID:  userID,
 		CurseID: curseID,
-		Status:  "P",
+		Status:  domain.EnrollmentPending,
 	}
 
 	if _, err := s.userService.Get(enroll.UserID); err != nil {
 		return nil, errors.New("user id doesn't exists")
 	}
 
-	if _, err := s.curseService.GetByID(enroll.CurseID); err != nil {
+	c, err := s.curseService.GetByID(enroll.CurseID)
+	if err != nil {
 		return nil, errors.New("curse id doesn't exists")
 	}
 
-	if err := s.repo.Create(enroll); err != nil {
+	if c.Status != domain.CursePublished {
+		return nil, fmt.Errorf("%w, its status is %s", ErrCurseNotOpen, c.Status)
+	}
+
+	if !opts.SkipPrerequisites {
+		missing, err := s.prerequisite.Missing(userID, curseID)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(missing) > 0 {
+			return nil, newPrerequisitesError(missing)
+		}
+	}
+
+	if !opts.AllowConflicts {
+		if err := s.checkConflicts(userID, curseID); err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		if err := repo.Create(enroll); err != nil {
+			return err
+		}
+
+		return audit.Add(ctx, tx, audit.ActionCreate, audit.EntityEnrollment, enroll.ID, nil, enroll)
+	})
+	if err != nil {
 		s.log.Printf("error: %v", err)
 		return nil, err
 	}
 
+	if err := s.bus.Publish(ctx, CreatedEvent{Enrollment: *enroll}); err != nil {
+		s.log.Printf("error: %v", err)
+	}
 	return enroll, nil
 }
+
+// checkConflicts compara las clases del curso con las de los otros cursos activos del usuario
+func (s service) checkConflicts(userID, curseID string) error {
+	sessions, err := s.sessions.GetOccurrences(curseID, nil, nil)
+	if err != nil || len(sessions) == 0 {
+		return err
+	}
+
+	curses, err := s.repo.GetActiveCurses(userID)
+	if err != nil {
+		return err
+	}
+
+	// solo hace falta mirar el rango de fechas del curso nuevo
+	from, to := sessions[0].StartsAt, sessions[0].EndsAt
+	for _, o := range sessions {
+		if o.EndsAt.After(to) {
+			to = o.EndsAt
+		}
+	}
+
+	var conflicts []Conflict
+	for _, other := range curses {
+		if other.ID == curseID {
+			continue
+		}
+
+		otherSessions, err := s.sessions.GetOccurrences(other.ID, nil, &to)
+		if err != nil {
+			return err
+		}
+
+		var relevant []domain.Occurrence
+		for _, o := range otherSessions {
+			if o.EndsAt.After(from) {
+				relevant = append(relevant, o)
+			}
+		}
+
+		conflicts = append(conflicts, overlaps(sessions, other, relevant)...)
+	}
+
+	if len(conflicts) > 0 {
+		return &ConflictError{Conflicts: conflicts}
+	}
+
+	return nil
+}
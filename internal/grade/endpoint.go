@@ -0,0 +1,258 @@
+package grade
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/MartinZitterkopf/gocurse_web/pkg/auth"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/meta"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// forbidden es la respuesta a quien no es administrador ni instructor del curso
+const forbidden = "only admins and instructors of the curse can manage grades"
+
+type (
+	Controller func(w http.ResponseWriter, r *http.Request)
+
+	Endpoints struct {
+		GetPolicy        Controller
+		UpdatePolicy     Controller
+		GetAssessments   Controller
+		AddAssessment    Controller
+		UpdateAssessment Controller
+		DeleteAssessment Controller
+		SetScores        Controller
+		GetGradebook     Controller
+		Finalize         Controller
+		GetEnrollment    Controller
+	}
+
+	UpdatePolicyReq struct {
+		Scale    *string  `json:"scale"`
+		PassMark *float64 `json:"pass_mark"`
+	}
+
+	AddAssessmentReq struct {
+		Name     string  `json:"name"`
+		Weight   float64 `json:"weight"`
+		MaxScore float64 `json:"max_score"`
+		DueDate  string  `json:"due_date"`
+	}
+
+	UpdateAssessmentReq struct {
+		Name     *string  `json:"name"`
+		Weight   *float64 `json:"weight"`
+		MaxScore *float64 `json:"max_score"`
+		DueDate  *string  `json:"due_date"`
+	}
+
+	SetScoresReq struct {
+		Scores []ScoreInput `json:"scores"`
+	}
+
+	Response struct {
+		Status int         `json:"status"`
+		Data   interface{} `json:"data,omitempty"`
+		Err    string      `json:"error,omitempty"`
+		Meta   *meta.Meta  `json:"meta,omitempty"`
+	}
+)
+
+func MakeEndpoints(s Service) Endpoints {
+	return Endpoints{
+		GetPolicy:        auth.StaffOnly(s.CanManage, forbidden, makeGetPolicyEndpoint(s)),
+		UpdatePolicy:     auth.StaffOnly(s.CanManage, forbidden, makeUpdatePolicyEndpoint(s)),
+		GetAssessments:   makeGetAssessmentsEndpoint(s),
+		AddAssessment:    auth.StaffOnly(s.CanManage, forbidden, makeAddAssessmentEndpoint(s)),
+		UpdateAssessment: auth.StaffOnly(s.CanManage, forbidden, makeUpdateAssessmentEndpoint(s)),
+		DeleteAssessment: auth.StaffOnly(s.CanManage, forbidden, makeDeleteAssessmentEndpoint(s)),
+		SetScores:        auth.StaffOnly(s.CanManage, forbidden, makeSetScoresEndpoint(s)),
+		GetGradebook:     auth.StaffOnly(s.CanManage, forbidden, makeGetGradebookEndpoint(s)),
+		Finalize:         auth.StaffOnly(s.CanManage, forbidden, makeFinalizeEndpoint(s)),
+		GetEnrollment:    makeGetEnrollmentEndpoint(s),
+	}
+}
+
+func makeGetPolicyEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		policy, err := s.GetPolicy(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(404)
+			json.NewEncoder(w).Encode(&Response{Status: 404, Err: "curse doesn't exist"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: policy})
+	}
+}
+
+func makeUpdatePolicyEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req UpdatePolicyReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "invalid request format"})
+			return
+		}
+
+		policy, err := s.UpdatePolicy(r.Context(), mux.Vars(r)["id"], req.Scale, req.PassMark)
+		if err != nil {
+			writeError(w, err, "curse doesn't exist")
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: policy})
+	}
+}
+
+func makeGetAssessmentsEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		assessments, err := s.GetAssessments(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(404)
+			json.NewEncoder(w).Encode(&Response{Status: 404, Err: "curse doesn't exist"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: assessments})
+	}
+}
+
+func makeAddAssessmentEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req AddAssessmentReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "invalid request format"})
+			return
+		}
+
+		assessment, err := s.AddAssessment(r.Context(), mux.Vars(r)["id"], req.Name, req.Weight, req.MaxScore, req.DueDate)
+		if err != nil {
+			writeError(w, err, "curse doesn't exist")
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: assessment})
+	}
+}
+
+func makeUpdateAssessmentEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req UpdateAssessmentReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "invalid request format"})
+			return
+		}
+
+		vars := mux.Vars(r)
+		assessment, err := s.UpdateAssessment(r.Context(), vars["id"], vars["assessment"], req.Name, req.Weight, req.MaxScore, req.DueDate)
+		if err != nil {
+			writeError(w, err, "assessment doesn't exist")
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: assessment})
+	}
+}
+
+func makeDeleteAssessmentEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if err := s.DeleteAssessment(r.Context(), vars["id"], vars["assessment"]); err != nil {
+			writeError(w, err, "assessment doesn't exist")
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: "success"})
+	}
+}
+
+func makeSetScoresEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req SetScoresReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "invalid request format"})
+			return
+		}
+
+		if len(req.Scores) == 0 {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "scores is required"})
+			return
+		}
+
+		vars := mux.Vars(r)
+		scores, err := s.SetScores(r.Context(), vars["id"], vars["assessment"], req.Scores)
+		if err != nil {
+			writeError(w, err, "assessment doesn't exist")
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: scores})
+	}
+}
+
+func makeGetGradebookEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		book, err := s.Gradebook(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(404)
+			json.NewEncoder(w).Encode(&Response{Status: 404, Err: "curse doesn't exist"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: book})
+	}
+}
+
+func makeFinalizeEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		grades, err := s.Finalize(r.Context(), mux.Vars(r)["id"])
+		if err != nil {
+			writeError(w, err, "curse doesn't exist")
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: grades})
+	}
+}
+
+// el propio alumno puede ver sus notas, ademas de los administradores e instructores
+func makeGetEnrollmentEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report, err := s.EnrollmentGrade(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(404)
+			json.NewEncoder(w).Encode(&Response{Status: 404, Err: "enrollment doesn't exist"})
+			return
+		}
+
+		if auth.UserID(r) != report.UserID && !auth.CanManage(r, report.CurseID, s.CanManage) {
+			w.WriteHeader(403)
+			json.NewEncoder(w).Encode(&Response{Status: 403, Err: "you can only see your own grades"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: report})
+	}
+}
+
+func writeError(w http.ResponseWriter, err error, notFound string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(&Response{Status: 404, Err: notFound})
+	case errors.Is(err, ErrFinalized), errors.Is(err, ErrMissingScores):
+		w.WriteHeader(409)
+		json.NewEncoder(w).Encode(&Response{Status: 409, Err: err.Error()})
+	default:
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
+	}
+}
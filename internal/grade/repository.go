@@ -0,0 +1,260 @@
+package grade
+
+import (
+	"log"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"github.com/MartinZitterkopf/gocurse_web/internal/outbox"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type (
+	Repository interface {
+		// Transaction corre fn con un Repository que usa tx, la transaccion que tambien recibe fn
+		Transaction(fn func(repo Repository, tx *gorm.DB) error) error
+		GetPolicy(curseID string) (*domain.GradingPolicy, error)
+		SavePolicy(policy *domain.GradingPolicy) error
+		CreateAssessment(assessment *domain.Assessment) error
+		GetAssessments(curseID string) ([]domain.Assessment, error)
+		GetAssessment(curseID, id string) (*domain.Assessment, error)
+		UpdateAssessment(assessment *domain.Assessment) error
+		// DeleteAssessment borra la evaluacion junto con sus notas
+		DeleteAssessment(curseID, id string) error
+		// GetRoster devuelve las inscripciones del curso que no estan canceladas
+		GetRoster(curseID string) ([]domain.Enrollment, error)
+		GetEnrollment(id string) (*domain.Enrollment, error)
+		SaveScores(scores []domain.Score) error
+		GetScores(curseID string) ([]domain.Score, error)
+		GetScoresByEnrollment(enrollmentID string) ([]domain.Score, error)
+		GetFinalGrades(curseID string) ([]domain.FinalGrade, error)
+		GetFinalGrade(enrollmentID string) (*domain.FinalGrade, error)
+		// Finalize guarda las notas finales y pasa las inscripciones activas a aprobadas o fallidas
+		Finalize(grades []domain.FinalGrade) ([]domain.EnrollmentStatusChange, error)
+	}
+
+	repo struct {
+		log *log.Logger
+		db  *gorm.DB
+	}
+)
+
+func NewRepo(l *log.Logger, db *gorm.DB) Repository {
+	return &repo{
+		log: l,
+		db:  db,
+	}
+}
+
+func (r *repo) Transaction(fn func(repo Repository, tx *gorm.DB) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		txRepo := *r
+		txRepo.db = tx
+		return fn(&txRepo, tx)
+	})
+}
+
+func (r *repo) GetPolicy(curseID string) (*domain.GradingPolicy, error) {
+	policy := domain.GradingPolicy{CurseID: curseID}
+
+	if err := r.db.First(&policy).Error; err != nil {
+		return nil, err
+	}
+
+	return &policy, nil
+}
+
+func (r *repo) SavePolicy(policy *domain.GradingPolicy) error {
+	err := r.db.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"scale", "pass_mark"}),
+	}).Create(policy).Error
+	if err != nil {
+		r.log.Printf("error: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *repo) CreateAssessment(assessment *domain.Assessment) error {
+	if err := r.db.Create(assessment).Error; err != nil {
+		r.log.Printf("error: %v", err)
+		return err
+	}
+
+	r.log.Println("assessment created with id: ", assessment.ID)
+	return nil
+}
+
+func (r *repo) GetAssessments(curseID string) ([]domain.Assessment, error) {
+	var assessments []domain.Assessment
+
+	if err := r.db.Where("curse_id = ?", curseID).Order("created_at").Find(&assessments).Error; err != nil {
+		return nil, err
+	}
+
+	return assessments, nil
+}
+
+func (r *repo) GetAssessment(curseID, id string) (*domain.Assessment, error) {
+	var assessment domain.Assessment
+
+	if err := r.db.Where("curse_id = ? AND id = ?", curseID, id).First(&assessment).Error; err != nil {
+		return nil, err
+	}
+
+	return &assessment, nil
+}
+
+func (r *repo) UpdateAssessment(assessment *domain.Assessment) error {
+	if err := r.db.Save(assessment).Error; err != nil {
+		r.log.Printf("error: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *repo) DeleteAssessment(curseID, id string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("assessment_id = ?", id).Delete(&domain.Score{}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Where("curse_id = ? AND id = ?", curseID, id).Delete(&domain.Assessment{})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		r.log.Println("assessment deleted with id: ", id)
+		return nil
+	})
+}
+
+func (r *repo) GetRoster(curseID string) ([]domain.Enrollment, error) {
+	var enrollments []domain.Enrollment
+
+	err := r.db.Preload("User").
+		Where("curse_id = ? AND status <> ?", curseID, domain.EnrollmentCancelled).
+		Find(&enrollments).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return enrollments, nil
+}
+
+func (r *repo) GetEnrollment(id string) (*domain.Enrollment, error) {
+	enrollment := domain.Enrollment{ID: id}
+
+	if err := r.db.First(&enrollment).Error; err != nil {
+		return nil, err
+	}
+
+	return &enrollment, nil
+}
+
+// SaveScores guarda las notas, si el inscripto ya tenia nota en esa evaluacion la reemplaza
+func (r *repo) SaveScores(scores []domain.Score) error {
+	if len(scores) == 0 {
+		return nil
+	}
+
+	err := r.db.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"value", "graded_by"}),
+	}).Create(&scores).Error
+	if err != nil {
+		r.log.Printf("error: %v", err)
+		return err
+	}
+
+	r.log.Printf("%d scores saved for assessment %s", len(scores), scores[0].AssessmentID)
+	return nil
+}
+
+func (r *repo) GetScores(curseID string) ([]domain.Score, error) {
+	var scores []domain.Score
+
+	if err := r.db.Where("curse_id = ?", curseID).Find(&scores).Error; err != nil {
+		return nil, err
+	}
+
+	return scores, nil
+}
+
+func (r *repo) GetScoresByEnrollment(enrollmentID string) ([]domain.Score, error) {
+	var scores []domain.Score
+
+	if err := r.db.Where("enrollment_id = ?", enrollmentID).Find(&scores).Error; err != nil {
+		return nil, err
+	}
+
+	return scores, nil
+}
+
+func (r *repo) GetFinalGrades(curseID string) ([]domain.FinalGrade, error) {
+	var grades []domain.FinalGrade
+
+	if err := r.db.Where("curse_id = ?", curseID).Find(&grades).Error; err != nil {
+		return nil, err
+	}
+
+	return grades, nil
+}
+
+func (r *repo) GetFinalGrade(enrollmentID string) (*domain.FinalGrade, error) {
+	grade := domain.FinalGrade{EnrollmentID: enrollmentID}
+
+	if err := r.db.First(&grade).Error; err != nil {
+		return nil, err
+	}
+
+	return &grade, nil
+}
+
+func (r *repo) Finalize(grades []domain.FinalGrade) ([]domain.EnrollmentStatusChange, error) {
+	var passed, failed []string
+	for _, g := range grades {
+		if g.Passed {
+			passed = append(passed, g.EnrollmentID)
+		} else {
+			failed = append(failed, g.EnrollmentID)
+		}
+	}
+
+	var changes []domain.EnrollmentStatusChange
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&grades).Error; err != nil {
+			return err
+		}
+
+		if len(passed) > 0 {
+			changed, err := outbox.StatusChanged(tx, domain.EnrollmentCompleted, "id IN ? AND status IN ?", passed, domain.EnrollmentActiveStatuses)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, changed...)
+		}
+
+		if len(failed) > 0 {
+			changed, err := outbox.StatusChanged(tx, domain.EnrollmentFailed, "id IN ? AND status IN ?", failed, domain.EnrollmentActiveStatuses)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, changed...)
+		}
+
+		return nil
+	})
+	if err != nil {
+		r.log.Printf("error: %v", err)
+		return nil, err
+	}
+
+	r.log.Printf("%d final grades saved", len(grades))
+	return changes, nil
+}
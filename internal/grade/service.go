@@ -0,0 +1,623 @@
+package grade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/attendance"
+	"github.com/MartinZitterkopf/gocurse_web/internal/audit"
+	"github.com/MartinZitterkopf/gocurse_web/internal/curse"
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"github.com/MartinZitterkopf/gocurse_web/internal/instructor"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/auth"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/events"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidGrade se devuelve cuando los datos de la escala, la evaluacion o la nota no son validos
+	ErrInvalidGrade = errors.New("invalid grade")
+	// ErrFinalized se devuelve al modificar las notas de un curso que ya se cerro
+	ErrFinalized = errors.New("grades are already finalized for this curse")
+	// ErrMissingScores se devuelve al cerrar las notas si falta calificar a alguien
+	ErrMissingScores = errors.New("missing scores")
+	ErrNotEnrolled   = errors.New("user is not enrolled in this curse")
+)
+
+// DefaultPassMark es el porcentaje para aprobar de los cursos sin escala configurada
+const DefaultPassMark = 60
+
+type (
+	Service interface {
+		GetPolicy(curseID string) (*domain.GradingPolicy, error)
+		UpdatePolicy(ctx context.Context, curseID string, scale *string, passMark *float64) (*domain.GradingPolicy, error)
+		AddAssessment(ctx context.Context, curseID, name string, weight, maxScore float64, dueDate string) (*domain.Assessment, error)
+		GetAssessments(curseID string) ([]domain.Assessment, error)
+		UpdateAssessment(ctx context.Context, curseID, id string, name *string, weight, maxScore *float64, dueDate *string) (*domain.Assessment, error)
+		DeleteAssessment(ctx context.Context, curseID, id string) error
+		SetScores(ctx context.Context, curseID, assessmentID string, scores []ScoreInput) ([]domain.Score, error)
+		Gradebook(curseID string) (*Gradebook, error)
+		// Finalize calcula las notas finales y pasa las inscripciones a aprobadas o fallidas
+		Finalize(ctx context.Context, curseID string) ([]domain.FinalGrade, error)
+		EnrollmentGrade(enrollmentID string) (*Report, error)
+		// CanManage indica si el usuario puede calificar, es decir si es instructor del curso
+		CanManage(curseID, userID string) (bool, error)
+	}
+
+	ScoreInput struct {
+		UserID string  `json:"user_id"`
+		Value  float64 `json:"value"`
+	}
+
+	// Result es la nota calculada con las evaluaciones calificadas hasta el momento
+	Result struct {
+		Percentage *float64 `json:"percentage"`
+		Grade      string   `json:"grade,omitempty"`
+		Passed     bool     `json:"passed"`
+		// Missing es la cantidad de evaluaciones sin nota
+		Missing int `json:"missing"`
+	}
+
+	GradebookRow struct {
+		EnrollmentID string             `json:"enrollment_id"`
+		UserID       string             `json:"user_id"`
+		FirstName    string             `json:"first_name"`
+		LastName     string             `json:"last_name"`
+		Status       string             `json:"enrollment_status"`
+		Scores       map[string]float64 `json:"scores"`
+		Result       Result             `json:"result"`
+		Final        *domain.FinalGrade `json:"final,omitempty"`
+	}
+
+	Gradebook struct {
+		Policy      domain.GradingPolicy `json:"policy"`
+		Assessments []domain.Assessment  `json:"assessments"`
+		Rows        []GradebookRow       `json:"rows"`
+		Finalized   bool                 `json:"finalized"`
+	}
+
+	Report struct {
+		EnrollmentID string             `json:"enrollment_id"`
+		CurseID      string             `json:"curse_id"`
+		UserID       string             `json:"user_id"`
+		Scores       []domain.Score     `json:"scores"`
+		Result       Result             `json:"result"`
+		Final        *domain.FinalGrade `json:"final,omitempty"`
+	}
+
+	service struct {
+		log          *log.Logger
+		repo         Repository
+		curseService curse.Service
+		instructors  instructor.Service
+		attendance   attendance.Service
+		bus          events.Publisher
+		now          func() time.Time
+	}
+)
+
+func NewService(l *log.Logger, r Repository, curseSvc curse.Service, instructorSvc instructor.Service, attendanceSvc attendance.Service, bus events.Publisher) Service {
+	return &service{
+		log:          l,
+		repo:         r,
+		curseService: curseSvc,
+		instructors:  instructorSvc,
+		attendance:   attendanceSvc,
+		bus:          bus,
+		now:          time.Now,
+	}
+}
+
+func (s service) GetPolicy(curseID string) (*domain.GradingPolicy, error) {
+	if _, err := s.curseService.GetByID(curseID); err != nil {
+		return nil, err
+	}
+
+	policy, err := s.repo.GetPolicy(curseID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &domain.GradingPolicy{CurseID: curseID, Scale: domain.GradeScaleNumeric, PassMark: DefaultPassMark}, nil
+	}
+
+	return policy, err
+}
+
+func (s service) UpdatePolicy(ctx context.Context, curseID string, scale *string, passMark *float64) (*domain.GradingPolicy, error) {
+	if err := s.checkOpen(curseID); err != nil {
+		return nil, err
+	}
+
+	policy, err := s.GetPolicy(curseID)
+	if err != nil {
+		return nil, err
+	}
+	before := *policy
+
+	if scale != nil {
+		switch *scale {
+		case domain.GradeScaleNumeric, domain.GradeScaleLetter, domain.GradeScalePassFail:
+			policy.Scale = *scale
+		default:
+			return nil, fmt.Errorf("%w: scale must be numeric, letter or pass_fail", ErrInvalidGrade)
+		}
+	}
+
+	if passMark != nil {
+		if *passMark < 0 || *passMark > 100 {
+			return nil, fmt.Errorf("%w: pass mark must be between 0 and 100", ErrInvalidGrade)
+		}
+		policy.PassMark = *passMark
+	}
+
+	err = s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		if err := repo.SavePolicy(policy); err != nil {
+			return err
+		}
+
+		return audit.Add(ctx, tx, audit.ActionUpdate, audit.EntityGradingPolicy, curseID, before, policy)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+func (s service) AddAssessment(ctx context.Context, curseID, name string, weight, maxScore float64, dueDate string) (*domain.Assessment, error) {
+	if err := s.checkOpen(curseID); err != nil {
+		return nil, err
+	}
+
+	assessment := &domain.Assessment{CurseID: curseID, Name: name, Weight: weight, MaxScore: maxScore}
+	if dueDate != "" {
+		if err := setDueDate(assessment, dueDate); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := validAssessment(assessment); err != nil {
+		return nil, err
+	}
+
+	err := s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		if err := repo.CreateAssessment(assessment); err != nil {
+			return err
+		}
+
+		return audit.Add(ctx, tx, audit.ActionCreate, audit.EntityAssessment, assessment.ID, nil, assessment)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return assessment, nil
+}
+
+func (s service) GetAssessments(curseID string) ([]domain.Assessment, error) {
+	if _, err := s.curseService.GetByID(curseID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetAssessments(curseID)
+}
+
+func (s service) UpdateAssessment(ctx context.Context, curseID, id string, name *string, weight, maxScore *float64, dueDate *string) (*domain.Assessment, error) {
+	if err := s.checkOpen(curseID); err != nil {
+		return nil, err
+	}
+
+	assessment, err := s.repo.GetAssessment(curseID, id)
+	if err != nil {
+		return nil, err
+	}
+	before := *assessment
+
+	if name != nil {
+		assessment.Name = *name
+	}
+
+	if weight != nil {
+		assessment.Weight = *weight
+	}
+
+	if maxScore != nil {
+		assessment.MaxScore = *maxScore
+	}
+
+	if dueDate != nil {
+		if err := setDueDate(assessment, *dueDate); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := validAssessment(assessment); err != nil {
+		return nil, err
+	}
+
+	err = s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		if err := repo.UpdateAssessment(assessment); err != nil {
+			return err
+		}
+
+		return audit.Add(ctx, tx, audit.ActionUpdate, audit.EntityAssessment, id, before, assessment)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return assessment, nil
+}
+
+func (s service) DeleteAssessment(ctx context.Context, curseID, id string) error {
+	if err := s.checkOpen(curseID); err != nil {
+		return err
+	}
+
+	before, err := s.repo.GetAssessment(curseID, id)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		if err := repo.DeleteAssessment(curseID, id); err != nil {
+			return err
+		}
+
+		return audit.Add(ctx, tx, audit.ActionDelete, audit.EntityAssessment, id, before, nil)
+	})
+}
+
+func (s service) SetScores(ctx context.Context, curseID, assessmentID string, inputs []ScoreInput) ([]domain.Score, error) {
+	if err := s.checkOpen(curseID); err != nil {
+		return nil, err
+	}
+
+	assessment, err := s.repo.GetAssessment(curseID, assessmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	roster, err := s.repo.GetRoster(curseID)
+	if err != nil {
+		return nil, err
+	}
+
+	byUser := make(map[string]domain.Enrollment, len(roster))
+	for _, e := range roster {
+		byUser[e.UserID] = e
+	}
+
+	actor := auth.Actor(ctx)
+	scores := make([]domain.Score, 0, len(inputs))
+	for _, in := range inputs {
+		e, ok := byUser[in.UserID]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrNotEnrolled, in.UserID)
+		}
+
+		if in.Value < 0 || in.Value > assessment.MaxScore {
+			return nil, fmt.Errorf("%w: score must be between 0 and %g", ErrInvalidGrade, assessment.MaxScore)
+		}
+
+		scores = append(scores, domain.Score{
+			AssessmentID: assessment.ID,
+			EnrollmentID: e.ID,
+			CurseID:      curseID,
+			UserID:       e.UserID,
+			Value:        in.Value,
+			GradedBy:     actor,
+		})
+	}
+
+	err = s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		if err := repo.SaveScores(scores); err != nil {
+			return err
+		}
+
+		return audit.Add(ctx, tx, audit.ActionUpdate, audit.EntityScore, assessment.ID, nil, scores)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return scores, nil
+}
+
+func (s service) Gradebook(curseID string) (*Gradebook, error) {
+	policy, err := s.GetPolicy(curseID)
+	if err != nil {
+		return nil, err
+	}
+
+	assessments, err := s.repo.GetAssessments(curseID)
+	if err != nil {
+		return nil, err
+	}
+
+	roster, err := s.repo.GetRoster(curseID)
+	if err != nil {
+		return nil, err
+	}
+
+	scores, err := s.repo.GetScores(curseID)
+	if err != nil {
+		return nil, err
+	}
+
+	finals, err := s.repo.GetFinalGrades(curseID)
+	if err != nil {
+		return nil, err
+	}
+
+	byEnrollment := map[string][]domain.Score{}
+	for _, sc := range scores {
+		byEnrollment[sc.EnrollmentID] = append(byEnrollment[sc.EnrollmentID], sc)
+	}
+
+	finalByEnrollment := make(map[string]domain.FinalGrade, len(finals))
+	for _, f := range finals {
+		finalByEnrollment[f.EnrollmentID] = f
+	}
+
+	book := &Gradebook{Policy: *policy, Assessments: assessments, Rows: []GradebookRow{}, Finalized: len(finals) > 0}
+	for _, e := range roster {
+		row := GradebookRow{
+			EnrollmentID: e.ID,
+			UserID:       e.UserID,
+			Status:       e.Status,
+			Scores:       map[string]float64{},
+			Result:       compute(*policy, assessments, byEnrollment[e.ID]),
+		}
+
+		if e.User != nil {
+			row.FirstName = e.User.FirstName
+			row.LastName = e.User.LastName
+		}
+
+		for _, sc := range byEnrollment[e.ID] {
+			row.Scores[sc.AssessmentID] = sc.Value
+		}
+
+		if f, ok := finalByEnrollment[e.ID]; ok {
+			row.Final = &f
+		}
+
+		book.Rows = append(book.Rows, row)
+	}
+
+	return book, nil
+}
+
+func (s service) Finalize(ctx context.Context, curseID string) ([]domain.FinalGrade, error) {
+	book, err := s.Gradebook(curseID)
+	if err != nil {
+		return nil, err
+	}
+
+	if book.Finalized {
+		return nil, ErrFinalized
+	}
+
+	if len(book.Assessments) == 0 {
+		return nil, fmt.Errorf("%w: the curse has no assessments", ErrInvalidGrade)
+	}
+
+	var missing []string
+	for _, row := range book.Rows {
+		if row.Result.Missing > 0 {
+			missing = append(missing, row.UserID)
+		}
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w for users %s", ErrMissingScores, strings.Join(missing, ", "))
+	}
+
+	// la regla de asistencia fail se evalua recien aca, con todas las clases marcadas
+	belowThreshold, err := s.attendance.BelowThreshold(curseID)
+	if err != nil {
+		return nil, err
+	}
+
+	actor, now := auth.Actor(ctx), s.now()
+	grades := make([]domain.FinalGrade, 0, len(book.Rows))
+	for _, row := range book.Rows {
+		// el que no llega a la asistencia minima no aprueba aunque le alcance la nota
+		passed := row.Result.Passed && row.Status != domain.EnrollmentFailed && !belowThreshold[row.EnrollmentID]
+
+		grades = append(grades, domain.FinalGrade{
+			EnrollmentID: row.EnrollmentID,
+			CurseID:      curseID,
+			UserID:       row.UserID,
+			Percentage:   *row.Result.Percentage,
+			Grade:        format(book.Policy.Scale, *row.Result.Percentage, book.Policy.PassMark, passed),
+			Passed:       passed,
+			FinalizedBy:  actor,
+			FinalizedAt:  now,
+		})
+	}
+
+	if len(grades) == 0 {
+		return grades, nil
+	}
+
+	var changes []domain.EnrollmentStatusChange
+	err = s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		changes, err = repo.Finalize(grades)
+		if err != nil {
+			return err
+		}
+
+		return audit.Add(ctx, tx, audit.ActionCreate, audit.EntityFinalGrade, curseID, nil, grades)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, change := range changes {
+		if err := s.bus.Publish(ctx, change); err != nil {
+			s.log.Println(err)
+		}
+	}
+
+	return grades, nil
+}
+
+func (s service) EnrollmentGrade(enrollmentID string) (*Report, error) {
+	enroll, err := s.repo.GetEnrollment(enrollmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := s.GetPolicy(enroll.CurseID)
+	if err != nil {
+		return nil, err
+	}
+
+	assessments, err := s.repo.GetAssessments(enroll.CurseID)
+	if err != nil {
+		return nil, err
+	}
+
+	scores, err := s.repo.GetScoresByEnrollment(enrollmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		EnrollmentID: enrollmentID,
+		CurseID:      enroll.CurseID,
+		UserID:       enroll.UserID,
+		Scores:       scores,
+		Result:       compute(*policy, assessments, scores),
+	}
+
+	final, err := s.repo.GetFinalGrade(enrollmentID)
+	switch {
+	case err == nil:
+		report.Final = final
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+
+	return report, nil
+}
+
+func (s service) CanManage(curseID, userID string) (bool, error) {
+	return s.instructors.IsInstructor(curseID, userID)
+}
+
+// checkOpen valida que el curso exista y que todavia no se hayan cerrado las notas
+func (s service) checkOpen(curseID string) error {
+	if _, err := s.curseService.GetByID(curseID); err != nil {
+		return err
+	}
+
+	finals, err := s.repo.GetFinalGrades(curseID)
+	if err != nil {
+		return err
+	}
+
+	if len(finals) > 0 {
+		return ErrFinalized
+	}
+
+	return nil
+}
+
+// compute pondera las notas cargadas: suma de peso * nota / maximo sobre la suma de los pesos calificados
+func compute(policy domain.GradingPolicy, assessments []domain.Assessment, scores []domain.Score) Result {
+	values := make(map[string]float64, len(scores))
+	for _, sc := range scores {
+		values[sc.AssessmentID] = sc.Value
+	}
+
+	var result Result
+	var weighted, weights float64
+	for _, a := range assessments {
+		v, ok := values[a.ID]
+		if !ok {
+			result.Missing++
+			continue
+		}
+
+		weighted += a.Weight * v / a.MaxScore
+		weights += a.Weight
+	}
+
+	if weights == 0 {
+		return result
+	}
+
+	percentage := math.Round(weighted/weights*10000) / 100
+	result.Percentage = &percentage
+	result.Passed = percentage >= policy.PassMark
+	result.Grade = format(policy.Scale, percentage, policy.PassMark, result.Passed)
+
+	return result
+}
+
+// format arma la nota en la escala del curso. En letras la F sale de passed, y de la nota de
+// aprobacion a 100 se reparte en cuatro tramos iguales de D a A: con 60 quedan D 60, C 70, B 80 y A 90
+func format(scale string, percentage, passMark float64, passed bool) string {
+	switch scale {
+	case domain.GradeScaleLetter:
+		if !passed {
+			return "F"
+		}
+
+		band := (100 - passMark) / 4
+		switch {
+		case percentage >= passMark+3*band:
+			return "A"
+		case percentage >= passMark+2*band:
+			return "B"
+		case percentage >= passMark+band:
+			return "C"
+		}
+		return "D"
+	case domain.GradeScalePassFail:
+		if passed {
+			return "pass"
+		}
+		return "fail"
+	}
+
+	return fmt.Sprintf("%.2f", percentage)
+}
+
+func validAssessment(a *domain.Assessment) error {
+	if strings.TrimSpace(a.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidGrade)
+	}
+
+	if a.Weight <= 0 {
+		return fmt.Errorf("%w: weight must be greater than 0", ErrInvalidGrade)
+	}
+
+	if a.MaxScore <= 0 {
+		return fmt.Errorf("%w: max score must be greater than 0", ErrInvalidGrade)
+	}
+
+	return nil
+}
+
+// setDueDate acepta una fecha 2006-01-02 o vacio para quitarla
+func setDueDate(a *domain.Assessment, dueDate string) error {
+	if dueDate == "" {
+		a.DueDate = nil
+		return nil
+	}
+
+	date, err := time.Parse("2006-01-02", dueDate)
+	if err != nil {
+		return fmt.Errorf("%w: due date must be 2006-01-02", ErrInvalidGrade)
+	}
+
+	a.DueDate = &date
+	return nil
+}
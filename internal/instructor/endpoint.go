@@ -0,0 +1,186 @@
+package instructor
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/MartinZitterkopf/gocurse_web/pkg/auth"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/meta"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type (
+	Controller func(w http.ResponseWriter, r *http.Request)
+
+	Endpoints struct {
+		Assign      Controller
+		Remove      Controller
+		GetByCurse  Controller
+		GetTeaching Controller
+	}
+
+	AssignReq struct {
+		UserID string `json:"user_id"`
+		Role   string `json:"role"`
+	}
+
+	RemoveReq struct {
+		UserID string `json:"user_id"`
+	}
+
+	Response struct {
+		Status int         `json:"status"`
+		Data   interface{} `json:"data,omitempty"`
+		Err    string      `json:"error,omitempty"`
+		Meta   *meta.Meta  `json:"meta,omitempty"`
+	}
+)
+
+func MakeEndpoints(s Service) Endpoints {
+	return Endpoints{
+		Assign:      adminOnly(makeAssignEndpoint(s)),
+		Remove:      adminOnly(makeRemoveEndpoint(s)),
+		GetByCurse:  makeGetByCurseEndpoint(s),
+		GetTeaching: makeGetTeachingEndpoint(s),
+	}
+}
+
+// los instructores pueden manejar la asistencia, las notas y los borradores del curso,
+// por eso solo un administrador los asigna o los quita
+func adminOnly(next Controller) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !auth.IsAdmin(r) {
+			w.WriteHeader(403)
+			json.NewEncoder(w).Encode(&Response{Status: 403, Err: "only admins can manage instructors"})
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func makeAssignEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req AssignReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "invalid request format"})
+			return
+		}
+
+		if req.UserID == "" {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "user id is required"})
+			return
+		}
+
+		instructor, err := s.Assign(r.Context(), mux.Vars(r)["id"], req.UserID, req.Role)
+		if err != nil {
+			status := 400
+			if errors.Is(err, ErrLastLead) || errors.Is(err, ErrNoLead) {
+				status = 409
+			}
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(&Response{Status: status, Err: err.Error()})
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: instructor})
+	}
+}
+
+// el usuario a quitar se manda en el cuerpo igual que al asignarlo, o como ?user_id=
+func makeRemoveEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := RemoveReq{UserID: r.URL.Query().Get("user_id")}
+		if req.UserID == "" {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				w.WriteHeader(400)
+				json.NewEncoder(w).Encode(&Response{Status: 400, Err: "invalid request format"})
+				return
+			}
+		}
+
+		if req.UserID == "" {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "user id is required"})
+			return
+		}
+
+		if err := s.Remove(r.Context(), mux.Vars(r)["id"], req.UserID); err != nil {
+			switch {
+			case errors.Is(err, ErrLastLead):
+				w.WriteHeader(409)
+				json.NewEncoder(w).Encode(&Response{Status: 409, Err: err.Error()})
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				w.WriteHeader(404)
+				json.NewEncoder(w).Encode(&Response{Status: 404, Err: "user is not an instructor of this curse"})
+			default:
+				w.WriteHeader(500)
+				json.NewEncoder(w).Encode(&Response{Status: 500, Err: err.Error()})
+			}
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: "success"})
+	}
+}
+
+func makeGetByCurseEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		instructors, err := s.GetByCurse(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(404)
+			json.NewEncoder(w).Encode(&Response{Status: 404, Err: "curse doesn't exist"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: instructors})
+	}
+}
+
+func makeGetTeachingEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+
+		page, limit, err := meta.Params(r.URL.Query())
+		if err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
+			return
+		}
+
+		// los borradores solo los ve el propio instructor, un administrador o alguien que tambien los da
+		var filters TeachingFilters
+		if !auth.IsAdmin(r) && auth.UserID(r) != id {
+			filters.HideDrafts = true
+			filters.Viewer = auth.UserID(r)
+		}
+
+		count, err := s.CountTeaching(id, filters)
+		if err != nil {
+			w.WriteHeader(404)
+			json.NewEncoder(w).Encode(&Response{Status: 404, Err: "user doesn't exist"})
+			return
+		}
+
+		meta, err := meta.New(page, limit, count)
+		if err != nil {
+			w.WriteHeader(500)
+			json.NewEncoder(w).Encode(&Response{Status: 500, Err: err.Error()})
+			return
+		}
+
+		teaching, err := s.GetTeaching(id, filters, meta.Offset(), meta.Limit())
+		if err != nil {
+			w.WriteHeader(500)
+			json.NewEncoder(w).Encode(&Response{Status: 500, Err: err.Error()})
+			return
+		}
+
+		meta.SetLinkHeader(w, r)
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: teaching, Meta: meta})
+	}
+}
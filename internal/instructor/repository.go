@@ -0,0 +1,175 @@
+package instructor
+
+import (
+	"log"
+	"time"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type (
+	Repository interface {
+		// Transaction corre fn con un Repository que usa tx, la transaccion que tambien recibe fn
+		Transaction(fn func(repo Repository, tx *gorm.DB) error) error
+		Assign(instructor *domain.CurseInstructor) error
+		Remove(curseID, userID string) error
+		GetByCurse(curseID string) ([]domain.CurseInstructor, error)
+		GetByUser(userID string, filters TeachingFilters, offset, limit int) ([]domain.CurseInstructor, error)
+		CountByUser(userID string, filters TeachingFilters) (int, error)
+		IsInstructor(curseID, userID string) (bool, error)
+	}
+
+	repo struct {
+		log *log.Logger
+		db  *gorm.DB
+	}
+)
+
+func NewRepo(l *log.Logger, db *gorm.DB) Repository {
+	return &repo{
+		log: l,
+		db:  db,
+	}
+}
+
+func (r *repo) Transaction(fn func(repo Repository, tx *gorm.DB) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		txRepo := *r
+		txRepo.db = tx
+		return fn(&txRepo, tx)
+	})
+}
+
+// Assign agrega al instructor o le cambia el rol si ya estaba asignado
+func (r *repo) Assign(instructor *domain.CurseInstructor) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if instructor.Role != domain.InstructorLead {
+			if err := checkOtherLead(tx, instructor.CurseID, instructor.UserID, true); err != nil {
+				return err
+			}
+		}
+
+		err := tx.Clauses(clause.OnConflict{
+			DoUpdates: clause.AssignmentColumns([]string{"role"}),
+		}).Create(instructor).Error
+		if err != nil {
+			return err
+		}
+
+		r.log.Printf("user %s assigned as %s instructor of curse %s", instructor.UserID, instructor.Role, instructor.CurseID)
+		return nil
+	})
+}
+
+func (r *repo) Remove(curseID, userID string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkOtherLead(tx, curseID, userID, false); err != nil {
+			return err
+		}
+
+		result := tx.Where("curse_id = ? AND user_id = ?", curseID, userID).Delete(&domain.CurseInstructor{})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		r.log.Printf("user %s removed as instructor of curse %s", userID, curseID)
+		return nil
+	})
+}
+
+func (r *repo) GetByCurse(curseID string) ([]domain.CurseInstructor, error) {
+	var instructors []domain.CurseInstructor
+
+	if err := r.db.Preload("User").Where("curse_id = ?", curseID).
+		Order("role desc, created_at").Find(&instructors).Error; err != nil {
+		return nil, err
+	}
+
+	return instructors, nil
+}
+
+func (r *repo) GetByUser(userID string, filters TeachingFilters, offset, limit int) ([]domain.CurseInstructor, error) {
+	var instructors []domain.CurseInstructor
+
+	if err := teaching(r.db.Preload("Curse"), userID, filters).
+		Order("curses.start_date desc, curses.id").Limit(limit).Offset(offset).Find(&instructors).Error; err != nil {
+		return nil, err
+	}
+
+	return instructors, nil
+}
+
+func (r *repo) CountByUser(userID string, filters TeachingFilters) (int, error) {
+	var count int64
+
+	if err := teaching(r.db.Model(&domain.CurseInstructor{}), userID, filters).Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	return int(count), nil
+}
+
+func (r *repo) IsInstructor(curseID, userID string) (bool, error) {
+	var count int64
+
+	if err := r.db.Model(&domain.CurseInstructor{}).
+		Where("curse_id = ? AND user_id = ?", curseID, userID).Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// checkOtherLead falla si userID es el unico lider de un curso que todavia no termino; con
+// assigning tambien falla si el curso no tiene lider, para no agregarle solo asistentes.
+// Bloquea los instructores del curso para que dos peticiones no dejen el curso sin lider
+func checkOtherLead(tx *gorm.DB, curseID, userID string, assigning bool) error {
+	var leads []domain.CurseInstructor
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("curse_id = ? AND role = ?", curseID, domain.InstructorLead).Find(&leads).Error; err != nil {
+		return err
+	}
+
+	errNoLead := ErrLastLead
+	switch {
+	case len(leads) == 0 && assigning:
+		errNoLead = ErrNoLead
+	case len(leads) != 1 || leads[0].UserID != userID:
+		return nil
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	var active int64
+	if err := tx.Model(&domain.Curse{}).Where("id = ? AND end_date >= ?", curseID, today).Count(&active).Error; err != nil {
+		return err
+	}
+
+	if active > 0 {
+		return errNoLead
+	}
+
+	return nil
+}
+
+func teaching(tx *gorm.DB, userID string, filters TeachingFilters) *gorm.DB {
+	tx = tx.Joins("JOIN curses ON curses.id = curse_instructors.curse_id AND curses.deleted IS NULL").
+		Where("curse_instructors.user_id = ?", userID)
+
+	if filters.HideDrafts {
+		if filters.Viewer != "" {
+			tx = tx.Where("(curses.status <> ? OR curses.id IN (SELECT curse_id FROM curse_instructors WHERE user_id = ?))", domain.CurseDraft, filters.Viewer)
+		} else {
+			tx = tx.Where("curses.status <> ?", domain.CurseDraft)
+		}
+	}
+
+	return tx
+}
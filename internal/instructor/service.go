@@ -0,0 +1,132 @@
+package instructor
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/audit"
+	"github.com/MartinZitterkopf/gocurse_web/internal/curse"
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"github.com/MartinZitterkopf/gocurse_web/internal/user"
+	"gorm.io/gorm"
+)
+
+// ErrLastLead se devuelve al quitar o bajar de rol al unico lider de un curso activo
+var ErrLastLead = errors.New("curse must keep at least one lead instructor while it is active")
+
+// ErrNoLead se devuelve al agregar un asistente a un curso activo que todavia no tiene lider
+var ErrNoLead = errors.New("curse needs a lead instructor before adding assistants")
+
+// ErrInvalidRole se devuelve cuando el rol no es lead ni assistant
+var ErrInvalidRole = errors.New("invalid role, must be lead or assistant")
+
+type (
+	Service interface {
+		Assign(ctx context.Context, curseID, userID, role string) (*domain.CurseInstructor, error)
+		Remove(ctx context.Context, curseID, userID string) error
+		GetByCurse(curseID string) ([]domain.CurseInstructor, error)
+		GetTeaching(userID string, filters TeachingFilters, offset, limit int) ([]domain.CurseInstructor, error)
+		CountTeaching(userID string, filters TeachingFilters) (int, error)
+		// IsInstructor indica si el usuario da el curso, con cualquier rol
+		IsInstructor(curseID, userID string) (bool, error)
+	}
+
+	// TeachingFilters es igual que el filtro de borradores del listado de cursos
+	TeachingFilters struct {
+		// HideDrafts oculta los borradores salvo los de los cursos donde Viewer es instructor
+		HideDrafts bool
+		Viewer     string
+	}
+
+	service struct {
+		log          *log.Logger
+		repo         Repository
+		userService  user.Service
+		curseService curse.Service
+	}
+)
+
+func NewService(l *log.Logger, r Repository, userSvc user.Service, curseSvc curse.Service) Service {
+	return &service{
+		log:          l,
+		repo:         r,
+		userService:  userSvc,
+		curseService: curseSvc,
+	}
+}
+
+func (s service) Assign(ctx context.Context, curseID, userID, role string) (*domain.CurseInstructor, error) {
+	if role == "" {
+		role = domain.InstructorLead
+	}
+
+	if role != domain.InstructorLead && role != domain.InstructorAssistant {
+		return nil, ErrInvalidRole
+	}
+
+	if _, err := s.curseService.GetByID(curseID); err != nil {
+		return nil, errors.New("curse id doesn't exists")
+	}
+
+	if _, err := s.userService.Get(userID); err != nil {
+		return nil, errors.New("user id doesn't exists")
+	}
+
+	instructor := &domain.CurseInstructor{
+		CurseID: curseID,
+		UserID:  userID,
+		Role:    role,
+	}
+
+	err := s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		if err := repo.Assign(instructor); err != nil {
+			return err
+		}
+
+		return audit.Add(ctx, tx, audit.ActionCreate, audit.EntityInstructor, curseID, nil, instructor)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return instructor, nil
+}
+
+func (s service) Remove(ctx context.Context, curseID, userID string) error {
+	return s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		if err := repo.Remove(curseID, userID); err != nil {
+			return err
+		}
+
+		return audit.Add(ctx, tx, audit.ActionDelete, audit.EntityInstructor, curseID, &domain.CurseInstructor{CurseID: curseID, UserID: userID}, nil)
+	})
+}
+
+func (s service) GetByCurse(curseID string) ([]domain.CurseInstructor, error) {
+	if _, err := s.curseService.GetByID(curseID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetByCurse(curseID)
+}
+
+func (s service) GetTeaching(userID string, filters TeachingFilters, offset, limit int) ([]domain.CurseInstructor, error) {
+	return s.repo.GetByUser(userID, filters, offset, limit)
+}
+
+func (s service) CountTeaching(userID string, filters TeachingFilters) (int, error) {
+	if _, err := s.userService.Get(userID); err != nil {
+		return 0, err
+	}
+
+	return s.repo.CountByUser(userID, filters)
+}
+
+func (s service) IsInstructor(curseID, userID string) (bool, error) {
+	if userID == "" {
+		return false, nil
+	}
+
+	return s.repo.IsInstructor(curseID, userID)
+}
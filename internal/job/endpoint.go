@@ -0,0 +1,82 @@
+package job
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/MartinZitterkopf/gocurse_web/pkg/auth"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/scheduler"
+	"github.com/gorilla/mux"
+)
+
+type (
+	Controller func(w http.ResponseWriter, r *http.Request)
+
+	Endpoints struct {
+		GetAll  Controller
+		Trigger Controller
+	}
+
+	// Service lo implementa *scheduler.Scheduler
+	Service interface {
+		Jobs() ([]scheduler.JobInfo, error)
+		Trigger(name string) error
+	}
+
+	Response struct {
+		Status int         `json:"status"`
+		Data   interface{} `json:"data,omitempty"`
+		Err    string      `json:"error,omitempty"`
+	}
+)
+
+func MakeEndpoints(s Service) Endpoints {
+	return Endpoints{
+		GetAll:  adminOnly(makeGetAllEndpoint(s)),
+		Trigger: adminOnly(makeTriggerEndpoint(s)),
+	}
+}
+
+func adminOnly(next Controller) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !auth.IsAdmin(r) {
+			w.WriteHeader(403)
+			json.NewEncoder(w).Encode(&Response{Status: 403, Err: "only admins can manage jobs"})
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func makeGetAllEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobs, err := s.Jobs()
+		if err != nil {
+			w.WriteHeader(500)
+			json.NewEncoder(w).Encode(&Response{Status: 500, Err: err.Error()})
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: jobs})
+	}
+}
+
+// el job no corre en la peticion, lo ejecuta la instancia lider en su proximo ciclo
+func makeTriggerEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.Trigger(mux.Vars(r)["name"]); err != nil {
+			status := 500
+			if errors.Is(err, scheduler.ErrJobNotFound) {
+				status = 404
+			}
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(&Response{Status: status, Err: err.Error()})
+			return
+		}
+
+		w.WriteHeader(202)
+		json.NewEncoder(w).Encode(&Response{Status: 202, Data: "job scheduled"})
+	}
+}
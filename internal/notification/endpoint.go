@@ -0,0 +1,156 @@
+package notification
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/auth"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/meta"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type (
+	Controller func(w http.ResponseWriter, r *http.Request)
+
+	Endpoints struct {
+		GetAll           Controller
+		GetPreference    Controller
+		UpdatePreference Controller
+	}
+
+	UpdatePreferenceReq struct {
+		EmailOptOut *bool   `json:"email_opt_out"`
+		Locale      *string `json:"locale"`
+	}
+
+	Response struct {
+		Status int         `json:"status"`
+		Data   interface{} `json:"data,omitempty"`
+		Err    string      `json:"error,omitempty"`
+		Meta   *meta.Meta  `json:"meta,omitempty"`
+	}
+)
+
+func MakeEndpoints(s Service) Endpoints {
+	return Endpoints{
+		GetAll:           makeGetAllEndpoint(s),
+		GetPreference:    selfOrAdmin(makeGetPreferenceEndpoint(s)),
+		UpdatePreference: selfOrAdmin(makeUpdatePreferenceEndpoint(s)),
+	}
+}
+
+// las preferencias las puede ver y cambiar el mismo usuario o un administrador
+func selfOrAdmin(next Controller) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !auth.IsAdmin(r) && auth.UserID(r) != mux.Vars(r)["id"] {
+			w.WriteHeader(403)
+			json.NewEncoder(w).Encode(&Response{Status: 403, Err: "you can only manage your own notification preferences"})
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func makeGetAllEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !auth.IsAdmin(r) {
+			w.WriteHeader(403)
+			json.NewEncoder(w).Encode(&Response{Status: 403, Err: "only admins can list notifications"})
+			return
+		}
+
+		v := r.URL.Query()
+		filters := Fillters{
+			UserID: v.Get("user_id"),
+			Status: v.Get("status"),
+		}
+
+		switch filters.Status {
+		case "", domain.NotificationPending, domain.NotificationSent, domain.NotificationFailed:
+		default:
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "invalid status, must be pending, sent or failed"})
+			return
+		}
+
+		page, limit, err := meta.Params(v)
+		if err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
+			return
+		}
+
+		count, err := s.Count(filters)
+		if err != nil {
+			w.WriteHeader(500)
+			json.NewEncoder(w).Encode(&Response{Status: 500, Err: err.Error()})
+			return
+		}
+
+		meta, err := meta.New(page, limit, count)
+		if err != nil {
+			w.WriteHeader(500)
+			json.NewEncoder(w).Encode(&Response{Status: 500, Err: err.Error()})
+			return
+		}
+
+		notifications, err := s.GetAll(filters, meta.Offset(), meta.Limit())
+		if err != nil {
+			w.WriteHeader(500)
+			json.NewEncoder(w).Encode(&Response{Status: 500, Err: err.Error()})
+			return
+		}
+
+		meta.SetLinkHeader(w, r)
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: notifications, Meta: meta})
+	}
+}
+
+func makeGetPreferenceEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		preference, err := s.GetPreference(mux.Vars(r)["id"])
+		if err != nil {
+			preferenceError(w, err)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: preference})
+	}
+}
+
+func makeUpdatePreferenceEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req UpdatePreferenceReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "invalid request format"})
+			return
+		}
+
+		preference, err := s.UpdatePreference(mux.Vars(r)["id"], req.EmailOptOut, req.Locale)
+		if err != nil {
+			preferenceError(w, err)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: preference})
+	}
+}
+
+func preferenceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidLocale):
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(&Response{Status: 404, Err: "user doesn't exist"})
+	default:
+		w.WriteHeader(500)
+		json.NewEncoder(w).Encode(&Response{Status: 500, Err: err.Error()})
+	}
+}
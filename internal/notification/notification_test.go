@@ -0,0 +1,163 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/mailer"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/queuetest"
+)
+
+// memoryRepo guarda la cola en memoria para probar Notify y el Worker sin base de datos
+type memoryRepo struct {
+	Repository
+
+	queue  *queuetest.Queue[domain.Notification]
+	users  map[string]domain.User
+	curses map[string]domain.Curse
+}
+
+func newMemoryRepo(notifications ...domain.Notification) *memoryRepo {
+	return &memoryRepo{queue: queuetest.New(queuetest.Fields[domain.Notification]{
+		ID:      func(n domain.Notification) string { return n.ID },
+		Pending: func(n domain.Notification) bool { return n.Status == domain.NotificationPending },
+		Next:    func(n *domain.Notification) *time.Time { return &n.NextAttemptAt },
+	}, notifications...)}
+}
+
+func (r *memoryRepo) Create(n *domain.Notification) error {
+	// el ID lo pone gorm al crear
+	if n.ID == "" {
+		n.ID = fmt.Sprintf("n%d", r.queue.Len()+1)
+	}
+	r.queue.Add(*n)
+	return nil
+}
+
+func (r *memoryRepo) ClaimDue(limit int, now time.Time, lease time.Duration) ([]domain.Notification, error) {
+	return r.queue.ClaimDue(limit, now, lease)
+}
+
+func (r *memoryRepo) SaveAttempt(n *domain.Notification) error {
+	return r.queue.SaveAttempt(n)
+}
+
+func (r *memoryRepo) GetPreference(userID string) (*domain.NotificationPreference, error) {
+	return &domain.NotificationPreference{UserID: userID}, nil
+}
+
+func (r *memoryRepo) GetRecipient(userID, curseID string) (*domain.User, *domain.Curse, error) {
+	u, c := r.users[userID], r.curses[curseID]
+	return &u, &c, nil
+}
+
+func TestNotifyIsDeliveredThroughSMTP(t *testing.T) {
+	sink, err := mailer.NewSink("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	renderer, err := NewRenderer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := newMemoryRepo()
+	repo.users = map[string]domain.User{
+		"u1": {ID: "u1", FirstName: "Ana", LastName: "Gomez", Email: "ana@example.com"},
+	}
+	repo.curses = map[string]domain.Curse{
+		"c1": {ID: "c1", Name: "Go avanzado", StartDate: time.Now().AddDate(0, 0, 7), EndDate: time.Now().AddDate(0, 1, 0)},
+	}
+	l := log.New(io.Discard, "", 0)
+	svc := NewService(l, repo, renderer, nil)
+
+	if err := svc.Notify(context.Background(), KindEnrollmentCreated, "u1", "c1"); err != nil {
+		t.Fatal(err)
+	}
+
+	worker := NewWorker(l, repo, mailer.NewSMTP(sink.Config()), WorkerConfig{
+		From:        "no-reply@example.com",
+		MaxAttempts: 3,
+		Backoff:     time.Minute,
+		MaxBackoff:  time.Hour,
+		BatchSize:   10,
+		Lease:       time.Minute,
+	})
+	if err := worker.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	received := sink.Received()
+	if len(received) != 1 {
+		t.Fatalf("expected 1 email in the sink, got %d", len(received))
+	}
+
+	msg := received[0]
+	if msg.From != "no-reply@example.com" || len(msg.To) != 1 || msg.To[0] != "ana@example.com" {
+		t.Errorf("unexpected envelope from %q to %v", msg.From, msg.To)
+	}
+	if !strings.Contains(msg.Data, "Go avanzado") {
+		t.Errorf("email doesn't mention the curse:\n%s", msg.Data)
+	}
+
+	n := repo.queue.Get("n1")
+	if n.Status != domain.NotificationSent || n.Attempts != 1 || n.SentAt == nil {
+		t.Errorf("notification not marked as sent: status %q, attempts %d", n.Status, n.Attempts)
+	}
+}
+
+func TestFailedDeliveryIsRetriedThenFailed(t *testing.T) {
+	// un sink cerrado deja un puerto donde nadie escucha
+	sink, err := mailer.NewSink("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := sink.Config()
+	sink.Close()
+
+	now := time.Now()
+	repo := newMemoryRepo(domain.Notification{
+		ID: "n1", To: "ana@example.com", Subject: "hola", Text: "hola",
+		Status: domain.NotificationPending, NextAttemptAt: now,
+	})
+
+	l := log.New(io.Discard, "", 0)
+	worker := NewWorker(l, repo, mailer.NewSMTP(config), WorkerConfig{
+		From:        "no-reply@example.com",
+		MaxAttempts: 2,
+		Backoff:     time.Minute,
+		MaxBackoff:  time.Hour,
+		BatchSize:   10,
+		Lease:       time.Second,
+	})
+	worker.now = func() time.Time { return now }
+
+	if err := worker.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	n := repo.queue.Get("n1")
+	if n.Status != domain.NotificationPending || n.Attempts != 1 || n.LastError == "" {
+		t.Fatalf("expected a pending retry after the first failure, got status %q, attempts %d", n.Status, n.Attempts)
+	}
+	if want := now.Add(time.Minute); !n.NextAttemptAt.Equal(want) {
+		t.Errorf("expected the retry at %v, got %v", want, n.NextAttemptAt)
+	}
+
+	now = now.Add(time.Minute)
+	if err := worker.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := repo.queue.Get("n1"); n.Status != domain.NotificationFailed || n.Attempts != 2 {
+		t.Errorf("expected failed after 2 attempts, got status %q, attempts %d", n.Status, n.Attempts)
+	}
+}
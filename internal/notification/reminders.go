@@ -0,0 +1,108 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/MartinZitterkopf/gocurse_web/pkg/scheduler"
+)
+
+// ReminderConfig indica con cuanta anticipacion se avisa a los inscriptos, 0 desactiva ese aviso
+type ReminderConfig struct {
+	Schedule    string
+	DaysBefore  int
+	HoursBefore int
+}
+
+// ReminderConfigFromEnv lee REMINDER_SCHEDULE, REMINDER_DAYS_BEFORE y REMINDER_HOURS_BEFORE
+func ReminderConfigFromEnv() (ReminderConfig, error) {
+	config := ReminderConfig{
+		Schedule:    os.Getenv("REMINDER_SCHEDULE"),
+		DaysBefore:  3,
+		HoursBefore: 2,
+	}
+
+	if config.Schedule == "" {
+		config.Schedule = "*/10 * * * *"
+	}
+
+	if _, err := scheduler.Parse(config.Schedule); err != nil {
+		return config, fmt.Errorf("invalid REMINDER_SCHEDULE: %w", err)
+	}
+
+	for env, value := range map[string]*int{"REMINDER_DAYS_BEFORE": &config.DaysBefore, "REMINDER_HOURS_BEFORE": &config.HoursBefore} {
+		v := os.Getenv(env)
+		if v == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return config, fmt.Errorf("invalid %s %q", env, v)
+		}
+		*value = n
+	}
+
+	return config, nil
+}
+
+// Offsets devuelve las anticipaciones configuradas
+func (c ReminderConfig) Offsets() []time.Duration {
+	var offsets []time.Duration
+	if c.DaysBefore > 0 {
+		offsets = append(offsets, time.Duration(c.DaysBefore)*24*time.Hour)
+	}
+	if c.HoursBefore > 0 {
+		offsets = append(offsets, time.Duration(c.HoursBefore)*time.Hour)
+	}
+	return offsets
+}
+
+// ReminderJob es el job del scheduler que encola los recordatorios de cada anticipacion
+// y el resumen de inscriptos para los instructores.
+// La primera vez revisa la ultima hora para no mandar avisos viejos al instalarlo
+func ReminderJob(s Service, offsets []time.Duration) scheduler.JobFunc {
+	return func(ctx context.Context, run scheduler.Run) error {
+		from := run.Last
+		if from.IsZero() {
+			from = run.Now.Add(-time.Hour)
+		}
+
+		for _, before := range offsets {
+			if _, err := s.SendReminders(ctx, before, from, run.Now); err != nil {
+				return err
+			}
+		}
+
+		// el resumen para los instructores depende de la asignacion de instructores a los cursos,
+		// sin instructores asignados no hay a quien mandarlo; reciben uno solo, con la mayor anticipacion
+		if len(offsets) > 0 {
+			if _, err := s.SendRosters(ctx, offsets[0], from, run.Now); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+func startsIn(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return plural(int(d/(24*time.Hour)), "day")
+	case d%time.Hour == 0:
+		return plural(int(d/time.Hour), "hour")
+	default:
+		return plural(int(d/time.Minute), "minute")
+	}
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
@@ -0,0 +1,211 @@
+package notification
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type (
+	Repository interface {
+		Create(notification *domain.Notification) error
+		GetAll(filters Fillters, offset, limit int) ([]domain.Notification, error)
+		Count(filters Fillters) (int, error)
+		ClaimDue(limit int, now time.Time, lease time.Duration) ([]domain.Notification, error)
+		SaveAttempt(notification *domain.Notification) error
+		GetPreference(userID string) (*domain.NotificationPreference, error)
+		SavePreference(preference *domain.NotificationPreference) error
+		GetRecipient(userID, curseID string) (*domain.User, *domain.Curse, error)
+		GetEnrollmentsStarting(from, to time.Time) ([]domain.Enrollment, error)
+		GetInstructorsStarting(from, to time.Time) ([]domain.CurseInstructor, error)
+		GetRoster(curseID string) ([]domain.User, error)
+	}
+
+	repo struct {
+		log *log.Logger
+		db  *gorm.DB
+	}
+)
+
+func NewRepo(l *log.Logger, db *gorm.DB) Repository {
+	return &repo{
+		log: l,
+		db:  db,
+	}
+}
+
+// Create no hace nada si ya existe una notificacion con el mismo DedupeKey
+func (r *repo) Create(notification *domain.Notification) error {
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(notification)
+	if result.Error != nil {
+		r.log.Printf("error: %v", result.Error)
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 && notification.DedupeKey != nil {
+		r.log.Println("notification already queued: ", *notification.DedupeKey)
+		return nil
+	}
+
+	r.log.Println("notification queued with id: ", notification.ID)
+	return nil
+}
+
+func (r *repo) GetAll(filters Fillters, offset, limit int) ([]domain.Notification, error) {
+	var notifications []domain.Notification
+
+	tx := applyFilters(r.db.Model(&notifications), filters)
+	if err := tx.Order("created_at desc, id desc").Limit(limit).Offset(offset).Find(&notifications).Error; err != nil {
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+func (r *repo) Count(filters Fillters) (int, error) {
+	var count int64
+
+	tx := applyFilters(r.db.Model(&domain.Notification{}), filters)
+	if err := tx.Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	return int(count), nil
+}
+
+// ClaimDue reserva las notificaciones pendientes corriendo su proximo intento lease hacia
+// adelante, igual que las entregas de webhooks, para que dos instancias no envien el mismo email
+func (r *repo) ClaimDue(limit int, now time.Time, lease time.Duration) ([]domain.Notification, error) {
+	var ids []string
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&domain.Notification{}).Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", domain.NotificationPending, now).
+			Order("next_attempt_at, id").Limit(limit).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		return tx.Model(&domain.Notification{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(lease)).Error
+	})
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	var notifications []domain.Notification
+	if err := r.db.Where("id IN ?", ids).Find(&notifications).Error; err != nil {
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+func (r *repo) SaveAttempt(notification *domain.Notification) error {
+	return r.db.Model(notification).Updates(map[string]interface{}{
+		"status":          notification.Status,
+		"attempts":        notification.Attempts,
+		"next_attempt_at": notification.NextAttemptAt,
+		"last_error":      notification.LastError,
+		"sent_at":         notification.SentAt,
+	}).Error
+}
+
+// GetPreference devuelve la preferencia guardada o la de por defecto si el usuario no tiene
+func (r *repo) GetPreference(userID string) (*domain.NotificationPreference, error) {
+	preference := domain.NotificationPreference{UserID: userID}
+
+	err := r.db.Where("user_id = ?", userID).First(&preference).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	return &preference, nil
+}
+
+func (r *repo) SavePreference(preference *domain.NotificationPreference) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"email_opt_out", "locale"}),
+	}).Create(preference).Error
+}
+
+// GetRecipient carga el usuario y el curso del email; los dos se buscan aunque esten borrados
+// porque al borrarlos se avisa a los inscriptos que se cancelo su inscripcion
+func (r *repo) GetRecipient(userID, curseID string) (*domain.User, *domain.Curse, error) {
+	u := domain.User{ID: userID}
+	if err := r.db.Unscoped().First(&u).Error; err != nil {
+		return nil, nil, err
+	}
+
+	c := domain.Curse{ID: curseID}
+	if err := r.db.Unscoped().First(&c).Error; err != nil {
+		return nil, nil, err
+	}
+
+	return &u, &c, nil
+}
+
+// GetEnrollmentsStarting devuelve las inscripciones activas de los cursos que empiezan
+// despues de from y hasta to inclusive, con el usuario y el curso cargados
+func (r *repo) GetEnrollmentsStarting(from, to time.Time) ([]domain.Enrollment, error) {
+	var enrollments []domain.Enrollment
+
+	err := r.db.Preload("User").Preload("Curse").
+		Joins("JOIN curses ON curses.id = enrollments.curse_id AND curses.deleted IS NULL").
+		Where("curses.start_date > ? AND curses.start_date <= ?", from, to).
+		Where("enrollments.status IN ?", domain.EnrollmentActiveStatuses).
+		Find(&enrollments).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return enrollments, nil
+}
+
+// GetInstructorsStarting es como GetEnrollmentsStarting pero para los instructores de esos cursos
+func (r *repo) GetInstructorsStarting(from, to time.Time) ([]domain.CurseInstructor, error) {
+	var instructors []domain.CurseInstructor
+
+	err := r.db.Preload("User").Preload("Curse").
+		Joins("JOIN curses ON curses.id = curse_instructors.curse_id AND curses.deleted IS NULL").
+		Where("curses.start_date > ? AND curses.start_date <= ?", from, to).
+		Find(&instructors).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return instructors, nil
+}
+
+// GetRoster devuelve los usuarios con inscripcion activa en el curso
+func (r *repo) GetRoster(curseID string) ([]domain.User, error) {
+	var users []domain.User
+
+	err := r.db.Joins("JOIN enrollments ON enrollments.user_id = users.id").
+		Where("enrollments.curse_id = ? AND enrollments.status IN ?", curseID, domain.EnrollmentActiveStatuses).
+		Order("users.last_name, users.first_name").Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func applyFilters(tx *gorm.DB, filters Fillters) *gorm.DB {
+	if filters.UserID != "" {
+		tx = tx.Where("user_id = ?", filters.UserID)
+	}
+
+	if filters.Status != "" {
+		tx = tx.Where("status = ?", filters.Status)
+	}
+
+	return tx
+}
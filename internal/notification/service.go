@@ -0,0 +1,222 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"github.com/MartinZitterkopf/gocurse_web/internal/enrollment"
+	"github.com/MartinZitterkopf/gocurse_web/internal/user"
+)
+
+// ErrInvalidLocale se devuelve cuando no hay plantillas para el locale pedido
+var ErrInvalidLocale = errors.New("invalid locale")
+
+const (
+	KindEnrollmentCreated   = "enrollment_created"
+	KindEnrollmentCancelled = "enrollment_cancelled"
+	KindCurseReminder       = "curse_reminder"
+	KindRosterSummary       = "roster_summary"
+)
+
+type (
+	Service interface {
+		// Notify renderiza el email y lo deja en cola, no hace nada si el usuario no quiere emails
+		Notify(ctx context.Context, kind, userID, curseID string) error
+		SendReminders(ctx context.Context, before time.Duration, from, to time.Time) (int, error)
+		SendRosters(ctx context.Context, before time.Duration, from, to time.Time) (int, error)
+		GetAll(filters Fillters, offset, limit int) ([]domain.Notification, error)
+		Count(filters Fillters) (int, error)
+		GetPreference(userID string) (*domain.NotificationPreference, error)
+		UpdatePreference(userID string, emailOptOut *bool, locale *string) (*domain.NotificationPreference, error)
+		OnEnrollmentCreated(ctx context.Context, e enrollment.CreatedEvent) error
+		OnStatusChanged(ctx context.Context, change domain.EnrollmentStatusChange) error
+	}
+
+	service struct {
+		log         *log.Logger
+		repo        Repository
+		renderer    *Renderer
+		userService user.Service
+		now         func() time.Time
+	}
+
+	Fillters struct {
+		UserID string
+		Status string
+	}
+
+	// Data es lo que reciben las plantillas
+	Data struct {
+		User  domain.User
+		Curse domain.Curse
+		// StartsIn es el texto "3 days", "2 hours", etc. de los recordatorios
+		StartsIn string
+		// Roster son los inscriptos, solo para el resumen de los instructores
+		Roster []domain.User
+	}
+)
+
+func NewService(l *log.Logger, r Repository, renderer *Renderer, userSvc user.Service) Service {
+	return &service{
+		log:         l,
+		repo:        r,
+		renderer:    renderer,
+		userService: userSvc,
+		now:         time.Now,
+	}
+}
+
+func (s service) Notify(ctx context.Context, kind, userID, curseID string) error {
+	u, c, err := s.repo.GetRecipient(userID, curseID)
+	if err != nil {
+		return err
+	}
+
+	return s.enqueue(kind, nil, Data{User: *u, Curse: *c})
+}
+
+// SendReminders encola un recordatorio para cada inscripto en los cursos que empiezan dentro
+// de before contando desde el intervalo (from, to]; el DedupeKey evita repetirlos
+func (s service) SendReminders(ctx context.Context, before time.Duration, from, to time.Time) (int, error) {
+	enrollments, err := s.repo.GetEnrollmentsStarting(from.Add(before), to.Add(before))
+	if err != nil {
+		return 0, err
+	}
+
+	var sent int
+	for _, e := range enrollments {
+		if e.User == nil || e.Curse == nil {
+			continue
+		}
+
+		key := fmt.Sprintf("%s:%s:%s", KindCurseReminder, e.ID, before)
+		if err := s.enqueue(KindCurseReminder, &key, Data{User: *e.User, Curse: *e.Curse, StartsIn: startsIn(before)}); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+
+	return sent, nil
+}
+
+// SendRosters manda a cada instructor la lista de inscriptos de los cursos que empiezan
+// dentro de before, con la misma ventana que SendReminders
+func (s service) SendRosters(ctx context.Context, before time.Duration, from, to time.Time) (int, error) {
+	instructors, err := s.repo.GetInstructorsStarting(from.Add(before), to.Add(before))
+	if err != nil {
+		return 0, err
+	}
+
+	var sent int
+	for _, i := range instructors {
+		if i.User == nil || i.Curse == nil {
+			continue
+		}
+
+		roster, err := s.repo.GetRoster(i.CurseID)
+		if err != nil {
+			return sent, err
+		}
+
+		key := fmt.Sprintf("%s:%s:%s:%s", KindRosterSummary, i.CurseID, i.UserID, before)
+		if err := s.enqueue(KindRosterSummary, &key, Data{User: *i.User, Curse: *i.Curse, StartsIn: startsIn(before), Roster: roster}); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+
+	return sent, nil
+}
+
+func (s service) enqueue(kind string, dedupeKey *string, data Data) error {
+	preference, err := s.repo.GetPreference(data.User.ID)
+	if err != nil {
+		return err
+	}
+
+	if preference.EmailOptOut {
+		s.log.Printf("user %s opted out of emails, %s not sent", data.User.ID, kind)
+		return nil
+	}
+
+	rendered, err := s.renderer.Render(kind, preference.Locale, data)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.Create(&domain.Notification{
+		UserID:        data.User.ID,
+		Kind:          kind,
+		DedupeKey:     dedupeKey,
+		To:            data.User.Email,
+		Subject:       rendered.Subject,
+		Text:          rendered.Text,
+		HTML:          rendered.HTML,
+		Status:        domain.NotificationPending,
+		NextAttemptAt: s.now(),
+	})
+}
+
+func (s service) GetAll(filters Fillters, offset, limit int) ([]domain.Notification, error) {
+	return s.repo.GetAll(filters, offset, limit)
+}
+
+func (s service) Count(filters Fillters) (int, error) {
+	return s.repo.Count(filters)
+}
+
+func (s service) GetPreference(userID string) (*domain.NotificationPreference, error) {
+	if _, err := s.userService.Get(userID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetPreference(userID)
+}
+
+// UpdatePreference acepta solo los locales que tienen plantillas, vacio vuelve a DefaultLocale
+func (s service) UpdatePreference(userID string, emailOptOut *bool, locale *string) (*domain.NotificationPreference, error) {
+	if locale != nil && *locale != "" && !s.renderer.HasLocale(*locale) {
+		return nil, fmt.Errorf("%w %q", ErrInvalidLocale, *locale)
+	}
+
+	preference, err := s.GetPreference(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if emailOptOut != nil {
+		preference.EmailOptOut = *emailOptOut
+	}
+
+	if locale != nil {
+		preference.Locale = *locale
+	}
+
+	if err := s.repo.SavePreference(preference); err != nil {
+		return nil, err
+	}
+
+	return preference, nil
+}
+
+// OnEnrollmentCreated manda la confirmacion, se suscribe a enrollment.CreatedEvent
+func (s service) OnEnrollmentCreated(ctx context.Context, e enrollment.CreatedEvent) error {
+	if e.Enrollment.Status != domain.EnrollmentPending {
+		return nil
+	}
+
+	return s.Notify(ctx, KindEnrollmentCreated, e.Enrollment.UserID, e.Enrollment.CurseID)
+}
+
+// OnStatusChanged avisa las cancelaciones
+func (s service) OnStatusChanged(ctx context.Context, change domain.EnrollmentStatusChange) error {
+	if change.To != domain.EnrollmentCancelled {
+		return nil
+	}
+
+	return s.Notify(ctx, KindEnrollmentCancelled, change.UserID, change.CurseID)
+}
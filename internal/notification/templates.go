@@ -0,0 +1,130 @@
+package notification
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultLocale se usa cuando el usuario no eligio idioma o no hay plantillas para el suyo
+const DefaultLocale = "en"
+
+//go:embed templates
+var templatesFS embed.FS
+
+type (
+	// Renderer arma el asunto y los cuerpos de texto y html de cada tipo de notificacion.
+	// Las plantillas estan en templates/<locale>/<kind>.txt y .html, el asunto se define
+	// en el .txt con {{define "subject"}}
+	Renderer struct {
+		text map[string]*template.Template
+		html map[string]*htmltemplate.Template
+	}
+
+	Rendered struct {
+		Subject string
+		Text    string
+		HTML    string
+	}
+)
+
+var funcs = map[string]interface{}{
+	"date": func(t time.Time) string {
+		return t.Format("2006-01-02")
+	},
+}
+
+func NewRenderer() (*Renderer, error) {
+	return newRenderer(templatesFS)
+}
+
+func newRenderer(fsys fs.FS) (*Renderer, error) {
+	r := &Renderer{
+		text: map[string]*template.Template{},
+		html: map[string]*htmltemplate.Template{},
+	}
+
+	paths, err := fs.Glob(fsys, "templates/*/*")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range paths {
+		parts := strings.Split(path, "/")
+		locale, file := parts[1], parts[2]
+
+		b, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case strings.HasSuffix(file, ".txt"):
+			key := locale + "/" + strings.TrimSuffix(file, ".txt")
+			t, err := template.New(key).Funcs(funcs).Option("missingkey=error").Parse(string(b))
+			if err != nil {
+				return nil, err
+			}
+			r.text[key] = t
+		case strings.HasSuffix(file, ".html"):
+			key := locale + "/" + strings.TrimSuffix(file, ".html")
+			t, err := htmltemplate.New(key).Funcs(funcs).Option("missingkey=error").Parse(string(b))
+			if err != nil {
+				return nil, err
+			}
+			r.html[key] = t
+		}
+	}
+
+	return r, nil
+}
+
+// HasLocale indica si hay plantillas para el locale
+func (r *Renderer) HasLocale(locale string) bool {
+	for key := range r.text {
+		if strings.HasPrefix(key, locale+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Render usa las plantillas del locale pedido y si no existen las de DefaultLocale
+func (r *Renderer) Render(kind, locale string, data interface{}) (*Rendered, error) {
+	key := locale + "/" + kind
+	if _, ok := r.text[key]; !ok {
+		key = DefaultLocale + "/" + kind
+	}
+
+	t, ok := r.text[key]
+	if !ok {
+		return nil, fmt.Errorf("no template for notification %q", kind)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := t.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+
+	if err := t.Execute(&text, data); err != nil {
+		return nil, err
+	}
+
+	// el html es opcional, sin el se manda solo texto
+	if h, ok := r.html[key]; ok {
+		if err := h.Execute(&html, data); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Rendered{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
@@ -0,0 +1,176 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/mailer"
+)
+
+type (
+	WorkerConfig struct {
+		From        string
+		Interval    time.Duration
+		MaxAttempts int
+		// Backoff es la espera despues del primer fallo, se duplica en cada intento hasta MaxBackoff
+		Backoff    time.Duration
+		MaxBackoff time.Duration
+		BatchSize  int
+		// SendTimeout limita cada envio, asi un servidor que no responde no traba el lote
+		SendTimeout time.Duration
+		// Lease tiene que cubrir el lote entero, que se envia de a un email, para que otra
+		// instancia no vuelva a tomar los ultimos mientras esperan su turno
+		Lease time.Duration
+	}
+
+	// Worker envia los emails en cola y reintenta los que fallan
+	Worker struct {
+		log    *log.Logger
+		repo   Repository
+		mailer mailer.Mailer
+		config WorkerConfig
+		now    func() time.Time
+	}
+)
+
+func NewWorker(l *log.Logger, r Repository, m mailer.Mailer, config WorkerConfig) *Worker {
+	return &Worker{
+		log:    l,
+		repo:   r,
+		mailer: m,
+		config: config,
+		now:    time.Now,
+	}
+}
+
+// ConfigFromEnv lee MAIL_FROM, NOTIFICATION_POLL_INTERVAL y NOTIFICATION_MAX_ATTEMPTS
+func ConfigFromEnv() (WorkerConfig, error) {
+	config := WorkerConfig{
+		From:        os.Getenv("MAIL_FROM"),
+		Interval:    5 * time.Second,
+		MaxAttempts: 5,
+		Backoff:     time.Minute,
+		MaxBackoff:  6 * time.Hour,
+		BatchSize:   50,
+		SendTimeout: mailer.DefaultTimeout,
+	}
+	config.Lease = time.Duration(config.BatchSize) * (config.SendTimeout + 10*time.Second)
+
+	if config.From == "" {
+		config.From = "no-reply@localhost"
+	}
+
+	if v := os.Getenv("NOTIFICATION_POLL_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval <= 0 {
+			return config, fmt.Errorf("invalid NOTIFICATION_POLL_INTERVAL %q", v)
+		}
+		config.Interval = interval
+	}
+
+	if v := os.Getenv("NOTIFICATION_MAX_ATTEMPTS"); v != "" {
+		attempts, err := strconv.Atoi(v)
+		if err != nil || attempts < 1 {
+			return config, fmt.Errorf("invalid NOTIFICATION_MAX_ATTEMPTS %q", v)
+		}
+		config.MaxAttempts = attempts
+	}
+
+	return config, nil
+}
+
+// Run envia la cola cada Interval hasta que se cancele ctx
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.RunOnce(ctx); err != nil {
+			w.log.Printf("notification worker error: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Worker) RunOnce(ctx context.Context) error {
+	notifications, err := w.repo.ClaimDue(w.config.BatchSize, w.now(), w.config.Lease)
+	if err != nil {
+		return err
+	}
+
+	for i := range notifications {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		w.attempt(ctx, &notifications[i])
+		if err := w.repo.SaveAttempt(&notifications[i]); err != nil {
+			w.log.Printf("notification worker error: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (w *Worker) attempt(ctx context.Context, n *domain.Notification) {
+	n.Attempts++
+
+	if w.config.SendTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.config.SendTimeout)
+		defer cancel()
+	}
+
+	err := w.mailer.Send(ctx, mailer.Message{
+		From:    w.config.From,
+		To:      []string{n.To},
+		Subject: n.Subject,
+		Text:    n.Text,
+		HTML:    n.HTML,
+	})
+	if err == nil {
+		now := w.now()
+		n.Status = domain.NotificationSent
+		n.SentAt = &now
+		n.LastError = ""
+		return
+	}
+
+	n.LastError = truncate(err.Error(), 255)
+	if n.Attempts >= w.config.MaxAttempts {
+		n.Status = domain.NotificationFailed
+		return
+	}
+
+	n.NextAttemptAt = w.now().Add(w.backoff(n.Attempts))
+}
+
+func (w *Worker) backoff(attempts int) time.Duration {
+	wait := w.config.Backoff
+	for i := 1; i < attempts && wait < w.config.MaxBackoff; i++ {
+		wait *= 2
+	}
+
+	if wait > w.config.MaxBackoff {
+		wait = w.config.MaxBackoff
+	}
+
+	return wait
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,59 @@
+package outbox
+
+import (
+	"encoding/json"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"gorm.io/gorm"
+)
+
+const (
+	UserCreated             = "user.created"
+	CurseUpdated            = "curse.updated"
+	EnrollmentCreated       = "enrollment.created"
+	EnrollmentStatusChanged = "enrollment.status_changed"
+)
+
+// Add guarda el evento usando tx, que tiene que ser la misma transaccion del cambio,
+// asi el evento existe si y solo si el cambio se confirmo
+func Add(tx *gorm.DB, eventType, entityID string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return tx.Create(&domain.OutboxEvent{
+		Type:     eventType,
+		EntityID: entityID,
+		Payload:  data,
+	}).Error
+}
+
+// StatusChanged cambia el estado de las inscripciones que cumplen where, genera un evento
+// por cada una y devuelve los cambios para que se puedan publicar al confirmar la transaccion
+func StatusChanged(tx *gorm.DB, to string, where string, args ...interface{}) ([]domain.EnrollmentStatusChange, error) {
+	var enrollments []domain.Enrollment
+	if err := tx.Where(where, args...).Find(&enrollments).Error; err != nil {
+		return nil, err
+	}
+
+	var changes []domain.EnrollmentStatusChange
+	for _, e := range enrollments {
+		if e.Status == to {
+			continue
+		}
+
+		if err := tx.Model(&domain.Enrollment{}).Where("id = ?", e.ID).
+			Updates(map[string]interface{}{"status": to, "version": gorm.Expr("version + 1")}).Error; err != nil {
+			return nil, err
+		}
+
+		change := domain.EnrollmentStatusChange{ID: e.ID, UserID: e.UserID, CurseID: e.CurseID, From: e.Status, To: to}
+		if err := Add(tx, EnrollmentStatusChanged, e.ID, change); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,91 @@
+package prerequisite
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/MartinZitterkopf/gocurse_web/pkg/auth"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/meta"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// forbidden es la respuesta a quien no es administrador ni instructor del curso
+const forbidden = "only admins and instructors of the curse can change its prerequisites"
+
+type (
+	Controller func(w http.ResponseWriter, r *http.Request)
+
+	Endpoints struct {
+		Get Controller
+		Set Controller
+	}
+
+	SetReq struct {
+		PrerequisiteIDs []string `json:"prerequisite_ids"`
+	}
+
+	Response struct {
+		Status int         `json:"status"`
+		Data   interface{} `json:"data,omitempty"`
+		Err    string      `json:"error,omitempty"`
+		Meta   *meta.Meta  `json:"meta,omitempty"`
+	}
+)
+
+func MakeEndpoints(s Service) Endpoints {
+	return Endpoints{
+		Get: makeGetEndpoint(s),
+		Set: auth.StaffOnly(s.CanManage, forbidden, makeSetEndpoint(s)),
+	}
+}
+
+func makeGetEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		curses, err := s.Get(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(404)
+			json.NewEncoder(w).Encode(&Response{Status: 404, Err: "curse doesn't exist"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: curses})
+	}
+}
+
+// el cuerpo tiene la lista completa, una lista vacia quita todos los prerrequisitos
+func makeSetEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req SetReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "invalid request format"})
+			return
+		}
+
+		if req.PrerequisiteIDs == nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "prerequisite ids is required"})
+			return
+		}
+
+		curses, err := s.Set(r.Context(), mux.Vars(r)["id"], req.PrerequisiteIDs)
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrCycle):
+				w.WriteHeader(409)
+				json.NewEncoder(w).Encode(&Response{Status: 409, Err: err.Error()})
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				w.WriteHeader(404)
+				json.NewEncoder(w).Encode(&Response{Status: 404, Err: err.Error()})
+			default:
+				w.WriteHeader(400)
+				json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
+			}
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: curses})
+	}
+}
@@ -0,0 +1,114 @@
+package prerequisite
+
+import (
+	"log"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type (
+	Repository interface {
+		// Transaction corre fn con un Repository que usa tx, la transaccion que tambien recibe fn
+		Transaction(fn func(repo Repository, tx *gorm.DB) error) error
+		// GetByCurse devuelve los cursos que pide curseID, aunque esten borrados
+		GetByCurse(curseID string) ([]domain.Curse, error)
+		// Replace reemplaza los prerrequisitos del curso por prerequisiteIDs. check recibe todas las
+		// relaciones como curso -> prerrequisitos, ya con el cambio, y si devuelve un error no se guarda nada
+		Replace(curseID string, prerequisiteIDs []string, check func(graph map[string][]string) error) error
+		// GetCompleted devuelve cuales de curseIDs aprobo el usuario
+		GetCompleted(userID string, curseIDs []string) ([]string, error)
+	}
+
+	repo struct {
+		log *log.Logger
+		db  *gorm.DB
+	}
+)
+
+func NewRepo(l *log.Logger, db *gorm.DB) Repository {
+	return &repo{
+		log: l,
+		db:  db,
+	}
+}
+
+func (r *repo) Transaction(fn func(repo Repository, tx *gorm.DB) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		txRepo := *r
+		txRepo.db = tx
+		return fn(&txRepo, tx)
+	})
+}
+
+func (r *repo) GetByCurse(curseID string) ([]domain.Curse, error) {
+	var curses []domain.Curse
+
+	err := r.db.Unscoped().
+		Joins("JOIN curse_prerequisites ON curse_prerequisites.prerequisite_id = curses.id").
+		Where("curse_prerequisites.curse_id = ?", curseID).
+		Order("curses.name").
+		Find(&curses).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return curses, nil
+}
+
+// Replace lee el grafo con FOR UPDATE en la misma transaccion que lo modifica, asi dos cambios
+// concurrentes (A -> B y B -> A) no pueden pasar los dos el control de ciclos
+func (r *repo) Replace(curseID string, prerequisiteIDs []string, check func(graph map[string][]string) error) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var edges []domain.CursePrerequisite
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Find(&edges).Error; err != nil {
+			return err
+		}
+
+		graph := make(map[string][]string)
+		for _, e := range edges {
+			graph[e.CurseID] = append(graph[e.CurseID], e.PrerequisiteID)
+		}
+		graph[curseID] = prerequisiteIDs
+
+		if err := check(graph); err != nil {
+			return err
+		}
+
+		if err := tx.Where("curse_id = ?", curseID).Delete(&domain.CursePrerequisite{}).Error; err != nil {
+			return err
+		}
+
+		if len(prerequisiteIDs) == 0 {
+			return nil
+		}
+
+		rows := make([]domain.CursePrerequisite, 0, len(prerequisiteIDs))
+		for _, id := range prerequisiteIDs {
+			rows = append(rows, domain.CursePrerequisite{CurseID: curseID, PrerequisiteID: id})
+		}
+
+		return tx.Create(&rows).Error
+	})
+	if err != nil {
+		r.log.Printf("error: %v", err)
+		return err
+	}
+
+	r.log.Printf("%d prerequisites set for curse %s", len(prerequisiteIDs), curseID)
+	return nil
+}
+
+func (r *repo) GetCompleted(userID string, curseIDs []string) ([]string, error) {
+	var completed []string
+
+	err := r.db.Model(&domain.Enrollment{}).
+		Where("user_id = ? AND curse_id IN ? AND status = ?", userID, curseIDs, domain.EnrollmentCompleted).
+		Distinct().Pluck("curse_id", &completed).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return completed, nil
+}
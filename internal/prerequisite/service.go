@@ -0,0 +1,184 @@
+package prerequisite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/audit"
+	"github.com/MartinZitterkopf/gocurse_web/internal/curse"
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrCycle se devuelve cuando los prerrequisitos terminarian pidiendo el mismo curso
+	ErrCycle = errors.New("prerequisites would create a cycle")
+	// ErrSelfPrerequisite se devuelve cuando un curso se pide a si mismo
+	ErrSelfPrerequisite = errors.New("a curse can't be its own prerequisite")
+)
+
+type (
+	Service interface {
+		Get(curseID string) ([]domain.Curse, error)
+		// Set reemplaza los prerrequisitos del curso, rechaza los ciclos
+		Set(ctx context.Context, curseID string, prerequisiteIDs []string) ([]domain.Curse, error)
+		// Missing devuelve los prerrequisitos de curseID que el usuario todavia no aprobo. Los cursos
+		// borrados no cuentan, ya no se pueden cursar y bloquearian cualquier inscripcion
+		Missing(userID, curseID string) ([]domain.Curse, error)
+		// CanManage indica si el usuario es instructor del curso y puede cambiar sus prerrequisitos
+		CanManage(curseID, userID string) (bool, error)
+	}
+
+	service struct {
+		log          *log.Logger
+		repo         Repository
+		curseService curse.Service
+	}
+)
+
+func NewService(l *log.Logger, r Repository, curseSvc curse.Service) Service {
+	return &service{
+		log:          l,
+		repo:         r,
+		curseService: curseSvc,
+	}
+}
+
+func (s service) Get(curseID string) ([]domain.Curse, error) {
+	if _, err := s.curseService.GetByID(curseID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetByCurse(curseID)
+}
+
+func (s service) Set(ctx context.Context, curseID string, prerequisiteIDs []string) ([]domain.Curse, error) {
+	before, err := s.Get(curseID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(prerequisiteIDs))
+	seen := make(map[string]bool, len(prerequisiteIDs))
+	for _, id := range prerequisiteIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		if id == curseID {
+			return nil, ErrSelfPrerequisite
+		}
+
+		if _, err := s.curseService.GetByID(id); err != nil {
+			return nil, fmt.Errorf("prerequisite %s: %w", id, err)
+		}
+		ids = append(ids, id)
+	}
+
+	var after []domain.Curse
+	err = s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		err := repo.Replace(curseID, ids, func(graph map[string][]string) error {
+			if path := findCycle(graph, curseID); path != nil {
+				return fmt.Errorf("%w: %s", ErrCycle, strings.Join(path, " -> "))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		after, err = repo.GetByCurse(curseID)
+		if err != nil {
+			return err
+		}
+
+		return audit.Add(ctx, tx, audit.ActionUpdate, audit.EntityPrerequisite, curseID,
+			map[string]interface{}{"prerequisites": curseIDs(before)}, map[string]interface{}{"prerequisites": curseIDs(after)})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return after, nil
+}
+
+func (s service) Missing(userID, curseID string) ([]domain.Curse, error) {
+	all, err := s.repo.GetByCurse(curseID)
+	if err != nil {
+		return nil, err
+	}
+
+	var prerequisites []domain.Curse
+	for _, c := range all {
+		if !c.Deleted.Valid {
+			prerequisites = append(prerequisites, c)
+		}
+	}
+
+	if len(prerequisites) == 0 {
+		return nil, nil
+	}
+
+	completed, err := s.repo.GetCompleted(userID, curseIDs(prerequisites))
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(map[string]bool, len(completed))
+	for _, id := range completed {
+		done[id] = true
+	}
+
+	var missing []domain.Curse
+	for _, c := range prerequisites {
+		if !done[c.ID] {
+			missing = append(missing, c)
+		}
+	}
+
+	return missing, nil
+}
+
+func (s service) CanManage(curseID, userID string) (bool, error) {
+	return s.curseService.CanManage(curseID, userID)
+}
+
+// findCycle busca en profundidad un camino desde los prerrequisitos de start que vuelva a start,
+// solo puede aparecer un ciclo nuevo por las relaciones que se acaban de cambiar
+func findCycle(graph map[string][]string, start string) []string {
+	visited := make(map[string]bool)
+
+	var visit func(id string, path []string) []string
+	visit = func(id string, path []string) []string {
+		path = append(path, id)
+		for _, next := range graph[id] {
+			if next == start {
+				return append(path, next)
+			}
+
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+
+			if cycle := visit(next, path); cycle != nil {
+				return cycle
+			}
+		}
+		return nil
+	}
+
+	return visit(start, nil)
+}
+
+func curseIDs(curses []domain.Curse) []string {
+	ids := make([]string, 0, len(curses))
+	for _, c := range curses {
+		ids = append(ids, c.ID)
+	}
+	return ids
+}
@@ -0,0 +1,261 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/MartinZitterkopf/gocurse_web/pkg/auth"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/meta"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// forbidden es la respuesta a quien no es administrador ni instructor del curso
+const forbidden = "only admins and instructors of the curse can change its sessions"
+
+type (
+	Controller func(w http.ResponseWriter, r *http.Request)
+
+	Endpoints struct {
+		GetSessions    Controller
+		AddSession     Controller
+		UpdateSession  Controller
+		DeleteSession  Controller
+		GetSchedules   Controller
+		AddSchedule    Controller
+		DeleteSchedule Controller
+	}
+
+	AddScheduleReq struct {
+		RRule     string `json:"rrule"`
+		StartTime string `json:"start_time"`
+		EndTime   string `json:"end_time"`
+		Timezone  string `json:"timezone"`
+	}
+
+	AddSessionReq struct {
+		StartsAt string `json:"starts_at"`
+		EndsAt   string `json:"ends_at"`
+		Timezone string `json:"timezone"`
+		Note     string `json:"note"`
+	}
+
+	UpdateSessionReq struct {
+		StartsAt  *string `json:"starts_at"`
+		EndsAt    *string `json:"ends_at"`
+		Note      *string `json:"note"`
+		Cancelled *bool   `json:"cancelled"`
+	}
+
+	Response struct {
+		Status int         `json:"status"`
+		Data   interface{} `json:"data,omitempty"`
+		Err    string      `json:"error,omitempty"`
+		Meta   *meta.Meta  `json:"meta,omitempty"`
+	}
+)
+
+func MakeEndpoints(s Service) Endpoints {
+	return Endpoints{
+		GetSessions:    makeGetSessionsEndpoint(s),
+		AddSession:     auth.StaffOnly(s.CanManage, forbidden, makeAddSessionEndpoint(s)),
+		UpdateSession:  auth.StaffOnly(s.CanManage, forbidden, makeUpdateSessionEndpoint(s)),
+		DeleteSession:  auth.StaffOnly(s.CanManage, forbidden, makeDeleteSessionEndpoint(s)),
+		GetSchedules:   makeGetSchedulesEndpoint(s),
+		AddSchedule:    auth.StaffOnly(s.CanManage, forbidden, makeAddScheduleEndpoint(s)),
+		DeleteSchedule: auth.StaffOnly(s.CanManage, forbidden, makeDeleteScheduleEndpoint(s)),
+	}
+}
+
+func makeGetSessionsEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := parseRange(r.URL.Query())
+		if err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
+			return
+		}
+
+		occurrences, err := s.GetOccurrences(mux.Vars(r)["id"], from, to)
+		if err != nil {
+			writeError(w, err, "curse doesn't exist")
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: occurrences})
+	}
+}
+
+func makeAddSessionEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req AddSessionReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "invalid request format"})
+			return
+		}
+
+		if req.StartsAt == "" || req.EndsAt == "" {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "starts_at and ends_at are required"})
+			return
+		}
+
+		occurrence, err := s.AddSession(r.Context(), mux.Vars(r)["id"], req.StartsAt, req.EndsAt, req.Timezone, req.Note)
+		if err != nil {
+			writeError(w, err, "curse doesn't exist")
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: occurrence})
+	}
+}
+
+func makeUpdateSessionEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req UpdateSessionReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "invalid request format"})
+			return
+		}
+
+		vars := mux.Vars(r)
+		occurrence, err := s.UpdateSession(r.Context(), vars["id"], vars["session"], req.StartsAt, req.EndsAt, req.Note, req.Cancelled)
+		if err != nil {
+			writeError(w, err, "session doesn't exist")
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: occurrence})
+	}
+}
+
+func makeDeleteSessionEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if err := s.DeleteSession(r.Context(), vars["id"], vars["session"]); err != nil {
+			writeError(w, err, "session doesn't exist")
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: "success"})
+	}
+}
+
+func makeGetSchedulesEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		schedules, err := s.GetSchedules(mux.Vars(r)["id"])
+		if err != nil {
+			writeError(w, err, "curse doesn't exist")
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: schedules})
+	}
+}
+
+func makeAddScheduleEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req AddScheduleReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "invalid request format"})
+			return
+		}
+
+		if req.RRule == "" {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "rrule is required"})
+			return
+		}
+
+		schedule, err := s.AddSchedule(r.Context(), mux.Vars(r)["id"], req.RRule, req.StartTime, req.EndTime, req.Timezone)
+		if err != nil {
+			writeError(w, err, "curse doesn't exist")
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: schedule})
+	}
+}
+
+func makeDeleteScheduleEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if err := s.DeleteSchedule(r.Context(), vars["id"], vars["schedule"]); err != nil {
+			writeError(w, err, "schedule doesn't exist")
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: "success"})
+	}
+}
+
+func writeError(w http.ResponseWriter, err error, notFound string) {
+	switch {
+	case errors.Is(err, ErrInvalidSession):
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(&Response{Status: 404, Err: notFound})
+	default:
+		w.WriteHeader(500)
+		json.NewEncoder(w).Encode(&Response{Status: 500, Err: err.Error()})
+	}
+}
+
+// parseRange lee ?from= y ?to= como RFC 3339 o YYYY-MM-DD; las fechas sin hora se toman en
+// la zona de ?tz= (UTC por defecto) y to incluye todo ese dia
+func parseRange(v url.Values) (*time.Time, *time.Time, error) {
+	loc := time.UTC
+	if tz := v.Get("tz"); tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unknown timezone %q", tz)
+		}
+		loc = l
+	}
+
+	parse := func(param string, endOfDay bool) (*time.Time, error) {
+		value := v.Get(param)
+		if value == "" {
+			return nil, nil
+		}
+
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return &t, nil
+		}
+
+		t, err := time.ParseInLocation("2006-01-02", value, loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s, must be RFC 3339 or YYYY-MM-DD", param)
+		}
+
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return &t, nil
+	}
+
+	from, err := parse("from", false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	to, err := parse("to", true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if from != nil && to != nil && !to.After(*from) {
+		return nil, nil, errors.New("to must be after from")
+	}
+
+	return from, to, nil
+}
@@ -0,0 +1,172 @@
+package session
+
+import (
+	"log"
+	"time"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"gorm.io/gorm"
+)
+
+type (
+	Repository interface {
+		// Transaction corre fn con un Repository que usa tx, la transaccion que tambien recibe fn
+		Transaction(fn func(repo Repository, tx *gorm.DB) error) error
+		CreateSchedule(schedule *domain.CurseSchedule) error
+		GetSchedules(curseID string) ([]domain.CurseSchedule, error)
+		GetSchedule(curseID, id string) (*domain.CurseSchedule, error)
+		DeleteSchedule(curseID, id string) error
+		CreateSession(session *domain.CurseSession) error
+		UpdateSession(session *domain.CurseSession) error
+		GetSessions(curseID string) ([]domain.CurseSession, error)
+		GetSession(curseID, id string) (*domain.CurseSession, error)
+		GetOverride(scheduleID string, originalStart time.Time) (*domain.CurseSession, error)
+		DeleteSession(curseID, id string) error
+	}
+
+	repo struct {
+		log *log.Logger
+		db  *gorm.DB
+	}
+)
+
+func NewRepo(l *log.Logger, db *gorm.DB) Repository {
+	return &repo{
+		log: l,
+		db:  db,
+	}
+}
+
+func (r *repo) Transaction(fn func(repo Repository, tx *gorm.DB) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		txRepo := *r
+		txRepo.db = tx
+		return fn(&txRepo, tx)
+	})
+}
+
+func (r *repo) CreateSchedule(schedule *domain.CurseSchedule) error {
+	if err := r.db.Create(schedule).Error; err != nil {
+		r.log.Printf("error: %v", err)
+		return err
+	}
+
+	r.log.Println("schedule created with id: ", schedule.ID)
+	return nil
+}
+
+func (r *repo) GetSchedules(curseID string) ([]domain.CurseSchedule, error) {
+	var schedules []domain.CurseSchedule
+
+	if err := r.db.Where("curse_id = ?", curseID).Order("created_at, id").Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+
+	return schedules, nil
+}
+
+func (r *repo) GetSchedule(curseID, id string) (*domain.CurseSchedule, error) {
+	var schedule domain.CurseSchedule
+
+	if err := r.db.Where("curse_id = ? AND id = ?", curseID, id).First(&schedule).Error; err != nil {
+		return nil, err
+	}
+
+	return &schedule, nil
+}
+
+// DeleteSchedule borra la regla junto con los cambios y cancelaciones de sus ocurrencias
+func (r *repo) DeleteSchedule(curseID, id string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("schedule_id = ?", id).Delete(&domain.CurseSession{}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Where("curse_id = ? AND id = ?", curseID, id).Delete(&domain.CurseSchedule{})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		r.log.Println("schedule deleted with id: ", id)
+		return nil
+	})
+}
+
+func (r *repo) CreateSession(session *domain.CurseSession) error {
+	if err := r.db.Create(session).Error; err != nil {
+		r.log.Printf("error: %v", err)
+		return err
+	}
+
+	r.log.Println("session created with id: ", session.ID)
+	return nil
+}
+
+// UpdateSession sube la revision en la misma sentencia, asi dos cambios concurrentes no la repiten
+func (r *repo) UpdateSession(session *domain.CurseSession) error {
+	err := r.db.Model(session).Updates(map[string]interface{}{
+		"starts_at": session.StartsAt,
+		"ends_at":   session.EndsAt,
+		"cancelled": session.Cancelled,
+		"note":      session.Note,
+		"revision":  gorm.Expr("revision + 1"),
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	return r.db.Model(session).Select("revision").First(session).Error
+}
+
+func (r *repo) GetSessions(curseID string) ([]domain.CurseSession, error) {
+	var sessions []domain.CurseSession
+
+	if err := r.db.Where("curse_id = ?", curseID).Order("starts_at, id").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (r *repo) GetSession(curseID, id string) (*domain.CurseSession, error) {
+	var session domain.CurseSession
+
+	if err := r.db.Where("curse_id = ? AND id = ?", curseID, id).First(&session).Error; err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// GetOverride devuelve el cambio guardado para una ocurrencia de la regla, nil si no tiene
+func (r *repo) GetOverride(scheduleID string, originalStart time.Time) (*domain.CurseSession, error) {
+	var sessions []domain.CurseSession
+
+	if err := r.db.Where("schedule_id = ? AND original_start = ?", scheduleID, originalStart).Limit(1).Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+
+	if len(sessions) == 0 {
+		return nil, nil
+	}
+
+	return &sessions[0], nil
+}
+
+func (r *repo) DeleteSession(curseID, id string) error {
+	result := r.db.Where("curse_id = ? AND id = ?", curseID, id).Delete(&domain.CurseSession{})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	r.log.Println("session deleted with id: ", id)
+	return nil
+}
@@ -0,0 +1,552 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/audit"
+	"github.com/MartinZitterkopf/gocurse_web/internal/curse"
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/rrule"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidSession se devuelve cuando los datos de la regla o de la clase no son validos
+var ErrInvalidSession = errors.New("invalid session")
+
+// occurrenceLayout es el formato del inicio original en el ID de las ocurrencias de una regla
+const occurrenceLayout = "20060102T150405Z"
+
+type (
+	Service interface {
+		AddSchedule(ctx context.Context, curseID, rule, startTime, endTime, timezone string) (*domain.CurseSchedule, error)
+		GetSchedules(curseID string) ([]domain.CurseSchedule, error)
+		DeleteSchedule(ctx context.Context, curseID, id string) error
+		AddSession(ctx context.Context, curseID, startsAt, endsAt, timezone, note string) (*domain.Occurrence, error)
+		UpdateSession(ctx context.Context, curseID, id string, startsAt, endsAt, note *string, cancelled *bool) (*domain.Occurrence, error)
+		DeleteSession(ctx context.Context, curseID, id string) error
+		// GetOccurrences expande las reglas dentro de las fechas del curso y les aplica los cambios,
+		// devuelve las clases que empiezan en [from, to) ordenadas, incluidas las canceladas
+		GetOccurrences(curseID string, from, to *time.Time) ([]domain.Occurrence, error)
+		// CanManage indica si el usuario es instructor del curso y puede cambiar sus clases
+		CanManage(curseID, userID string) (bool, error)
+	}
+
+	service struct {
+		log          *log.Logger
+		repo         Repository
+		curseService curse.Service
+	}
+)
+
+func NewService(l *log.Logger, r Repository, curseSvc curse.Service) Service {
+	return &service{
+		log:          l,
+		repo:         r,
+		curseService: curseSvc,
+	}
+}
+
+func (s service) AddSchedule(ctx context.Context, curseID, rule, startTime, endTime, timezone string) (*domain.CurseSchedule, error) {
+	if _, err := s.curseService.GetByID(curseID); err != nil {
+		return nil, err
+	}
+
+	parsed, err := rrule.Parse(rule)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSession, err)
+	}
+
+	if _, err := loadLocation(timezone); err != nil {
+		return nil, err
+	}
+
+	start, err := parseClock(startTime)
+	if err != nil {
+		return nil, err
+	}
+
+	end, err := parseClock(endTime)
+	if err != nil {
+		return nil, err
+	}
+
+	if end <= start {
+		return nil, fmt.Errorf("%w: end time must be after start time", ErrInvalidSession)
+	}
+
+	schedule := &domain.CurseSchedule{
+		CurseID:   curseID,
+		RRule:     parsed.String(),
+		StartTime: startTime,
+		EndTime:   endTime,
+		Timezone:  timezone,
+	}
+
+	err = s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		if err := repo.CreateSchedule(schedule); err != nil {
+			return err
+		}
+
+		return audit.Add(ctx, tx, audit.ActionCreate, audit.EntitySchedule, schedule.ID, nil, schedule)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
+func (s service) GetSchedules(curseID string) ([]domain.CurseSchedule, error) {
+	if _, err := s.curseService.GetByID(curseID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetSchedules(curseID)
+}
+
+func (s service) DeleteSchedule(ctx context.Context, curseID, id string) error {
+	before, err := s.repo.GetSchedule(curseID, id)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		if err := repo.DeleteSchedule(curseID, id); err != nil {
+			return err
+		}
+
+		return audit.Add(ctx, tx, audit.ActionDelete, audit.EntitySchedule, id, before, nil)
+	})
+}
+
+func (s service) AddSession(ctx context.Context, curseID, startsAt, endsAt, timezone, note string) (*domain.Occurrence, error) {
+	c, err := s.curseService.GetByID(curseID)
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := loadLocation(timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &domain.CurseSession{CurseID: curseID, Timezone: timezone, Note: note}
+	if err := setTimes(session, &startsAt, &endsAt, loc); err != nil {
+		return nil, err
+	}
+
+	from, to := curseRange(c, loc)
+	if session.StartsAt.Before(from) || !session.StartsAt.Before(to) {
+		return nil, fmt.Errorf("%w: session must be within the curse dates", ErrInvalidSession)
+	}
+
+	err = s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		if err := repo.CreateSession(session); err != nil {
+			return err
+		}
+
+		return audit.Add(ctx, tx, audit.ActionCreate, audit.EntitySession, session.ID, nil, session)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	occurrence := fromSession(*session, loc)
+	return &occurrence, nil
+}
+
+// UpdateSession cambia una clase puntual o una ocurrencia de una regla; en ese caso se guarda
+// un CurseSession que la reemplaza y el ID de la ocurrencia no cambia
+func (s service) UpdateSession(ctx context.Context, curseID, id string, startsAt, endsAt, note *string, cancelled *bool) (*domain.Occurrence, error) {
+	session, err := s.findSession(curseID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	before := *session
+	loc, err := loadLocation(session.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := setTimes(session, startsAt, endsAt, loc); err != nil {
+		return nil, err
+	}
+
+	// igual que en AddSession, una clase no se puede mover fuera de las fechas del curso
+	if startsAt != nil {
+		c, err := s.curseService.GetByID(curseID)
+		if err != nil {
+			return nil, err
+		}
+
+		from, to := curseRange(c, loc)
+		if session.StartsAt.Before(from) || !session.StartsAt.Before(to) {
+			return nil, fmt.Errorf("%w: session must be within the curse dates", ErrInvalidSession)
+		}
+	}
+
+	if note != nil {
+		session.Note = *note
+	}
+
+	if cancelled != nil {
+		session.Cancelled = *cancelled
+	}
+
+	err = s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		if session.CreatedAt == nil {
+			// el primer cambio de una ocurrencia de la regla ya es la revision 1
+			session.Revision = 1
+			if err := repo.CreateSession(session); err != nil {
+				return err
+			}
+		} else if err := repo.UpdateSession(session); err != nil {
+			return err
+		}
+
+		return audit.Add(ctx, tx, audit.ActionUpdate, audit.EntitySession, session.ID, &before, session)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	occurrence := fromSession(*session, loc)
+	return &occurrence, nil
+}
+
+// DeleteSession borra una clase puntual, o el cambio de una ocurrencia para que vuelva a ser como la regla.
+// En ese caso el registro no se borra: se le ponen los datos de la regla y sube la revision, porque
+// si volviera a 0 los calendarios ignorarian el cambio
+func (s service) DeleteSession(ctx context.Context, curseID, id string) error {
+	session, err := s.findSession(curseID, id)
+	if err != nil {
+		return err
+	}
+
+	if session.CreatedAt == nil {
+		return gorm.ErrRecordNotFound
+	}
+
+	if session.ScheduleID == nil {
+		return s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+			if err := repo.DeleteSession(curseID, session.ID); err != nil {
+				return err
+			}
+
+			return audit.Add(ctx, tx, audit.ActionDelete, audit.EntitySession, session.ID, session, nil)
+		})
+	}
+
+	before := *session
+	rule, err := s.ruleSession(curseID, *session.ScheduleID, *session.OriginalStart)
+	if err != nil {
+		return err
+	}
+
+	session.StartsAt, session.EndsAt = rule.StartsAt, rule.EndsAt
+	session.Cancelled, session.Note = false, ""
+	return s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		if err := repo.UpdateSession(session); err != nil {
+			return err
+		}
+
+		return audit.Add(ctx, tx, audit.ActionDelete, audit.EntitySession, session.ID, &before, nil)
+	})
+}
+
+func (s service) GetOccurrences(curseID string, from, to *time.Time) ([]domain.Occurrence, error) {
+	c, err := s.curseService.GetByID(curseID)
+	if err != nil {
+		return nil, err
+	}
+
+	schedules, err := s.repo.GetSchedules(curseID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.repo.GetSessions(curseID)
+	if err != nil {
+		return nil, err
+	}
+
+	inRange := func(t time.Time) bool {
+		return (from == nil || !t.Before(*from)) && (to == nil || t.Before(*to))
+	}
+
+	var occurrences []domain.Occurrence
+	overridden := map[string]bool{}
+	for _, session := range sessions {
+		loc, err := loadLocation(session.Timezone)
+		if err != nil {
+			return nil, err
+		}
+
+		occurrence := fromSession(session, loc)
+		overridden[occurrence.ID] = true
+
+		start := occurrence.StartsAt
+		if session.Cancelled && session.OriginalStart != nil {
+			start = *occurrence.OriginalStart
+		}
+
+		if inRange(start) {
+			occurrences = append(occurrences, occurrence)
+		}
+	}
+
+	for _, schedule := range schedules {
+		expanded, err := expand(c, schedule, from, to)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, occurrence := range expanded {
+			if !overridden[occurrence.ID] {
+				occurrences = append(occurrences, occurrence)
+			}
+		}
+	}
+
+	sort.SliceStable(occurrences, func(i, j int) bool {
+		return occurrences[i].StartsAt.Before(occurrences[j].StartsAt)
+	})
+
+	return occurrences, nil
+}
+
+// findSession busca la clase puntual o arma el reemplazo de una ocurrencia de la regla,
+// sin guardar, si todavia no tiene cambios
+func (s service) findSession(curseID, id string) (*domain.CurseSession, error) {
+	scheduleID, original, ok := parseOccurrenceID(id)
+	if !ok {
+		return s.repo.GetSession(curseID, id)
+	}
+
+	schedule, err := s.repo.GetSchedule(curseID, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+
+	override, err := s.repo.GetOverride(scheduleID, original)
+	if err != nil || override != nil {
+		return override, err
+	}
+
+	return s.expandSession(curseID, schedule, original)
+}
+
+// ruleSession arma la ocurrencia de la regla sin los cambios guardados
+func (s service) ruleSession(curseID, scheduleID string, original time.Time) (*domain.CurseSession, error) {
+	schedule, err := s.repo.GetSchedule(curseID, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.expandSession(curseID, schedule, original)
+}
+
+func (s service) expandSession(curseID string, schedule *domain.CurseSchedule, original time.Time) (*domain.CurseSession, error) {
+	c, err := s.curseService.GetByID(curseID)
+	if err != nil {
+		return nil, err
+	}
+
+	end := original.Add(time.Second)
+	expanded, err := expand(c, *schedule, &original, &end)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(expanded) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	return &domain.CurseSession{
+		CurseID:       curseID,
+		ScheduleID:    &schedule.ID,
+		OriginalStart: &original,
+		StartsAt:      expanded[0].StartsAt,
+		EndsAt:        expanded[0].EndsAt,
+		Timezone:      schedule.Timezone,
+	}, nil
+}
+
+// expand calcula las ocurrencias de la regla dentro de las fechas del curso
+func expand(c *domain.Curse, schedule domain.CurseSchedule, from, to *time.Time) ([]domain.Occurrence, error) {
+	rule, err := rrule.Parse(schedule.RRule)
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := loadLocation(schedule.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	start, _ := parseClock(schedule.StartTime)
+	end, _ := parseClock(schedule.EndTime)
+
+	first, last := curseRange(c, loc)
+	dtstart := atClock(first, start)
+
+	windowFrom, windowTo := first, last
+	if from != nil && from.After(windowFrom) {
+		windowFrom = *from
+	}
+	if to != nil && to.Before(windowTo) {
+		windowTo = *to
+	}
+
+	var occurrences []domain.Occurrence
+	for _, t := range rule.Between(dtstart, windowFrom, windowTo) {
+		original := t
+		occurrences = append(occurrences, domain.Occurrence{
+			ID:            occurrenceID(schedule.ID, t),
+			CurseID:       c.ID,
+			ScheduleID:    schedule.ID,
+			StartsAt:      t,
+			EndsAt:        atClock(t, end),
+			Timezone:      schedule.Timezone,
+			Status:        domain.OccurrenceScheduled,
+			OriginalStart: &original,
+		})
+	}
+
+	return occurrences, nil
+}
+
+func (s service) CanManage(curseID, userID string) (bool, error) {
+	return s.curseService.CanManage(curseID, userID)
+}
+
+// curseRange devuelve el inicio del primer dia y el fin del ultimo dia del curso en loc
+func curseRange(c *domain.Curse, loc *time.Location) (time.Time, time.Time) {
+	sy, sm, sd := c.StartDate.Date()
+	ey, em, ed := c.EndDate.Date()
+
+	return time.Date(sy, sm, sd, 0, 0, 0, 0, loc), time.Date(ey, em, ed+1, 0, 0, 0, 0, loc)
+}
+
+func fromSession(session domain.CurseSession, loc *time.Location) domain.Occurrence {
+	occurrence := domain.Occurrence{
+		ID:       session.ID,
+		CurseID:  session.CurseID,
+		StartsAt: session.StartsAt.In(loc),
+		EndsAt:   session.EndsAt.In(loc),
+		Timezone: session.Timezone,
+		Status:   domain.OccurrenceScheduled,
+		Note:     session.Note,
+		Revision: session.Revision,
+	}
+
+	if session.ScheduleID != nil && session.OriginalStart != nil {
+		original := session.OriginalStart.In(loc)
+		occurrence.ID = occurrenceID(*session.ScheduleID, original)
+		occurrence.ScheduleID = *session.ScheduleID
+		occurrence.OriginalStart = &original
+		if !original.Equal(session.StartsAt) {
+			occurrence.Status = domain.OccurrenceRescheduled
+		}
+	}
+
+	if session.Cancelled {
+		occurrence.Status = domain.OccurrenceCancelled
+	}
+
+	return occurrence
+}
+
+func occurrenceID(scheduleID string, original time.Time) string {
+	return scheduleID + "_" + original.UTC().Format(occurrenceLayout)
+}
+
+func parseOccurrenceID(id string) (string, time.Time, bool) {
+	i := strings.LastIndex(id, "_")
+	if i < 0 {
+		return "", time.Time{}, false
+	}
+
+	t, err := time.Parse(occurrenceLayout, id[i+1:])
+	if err != nil {
+		return "", time.Time{}, false
+	}
+
+	return id[:i], t, true
+}
+
+func setTimes(session *domain.CurseSession, startsAt, endsAt *string, loc *time.Location) error {
+	if startsAt != nil {
+		t, err := parseDateTime(*startsAt, loc)
+		if err != nil {
+			return err
+		}
+		session.StartsAt = t
+	}
+
+	if endsAt != nil {
+		t, err := parseDateTime(*endsAt, loc)
+		if err != nil {
+			return err
+		}
+		session.EndsAt = t
+	}
+
+	if !session.EndsAt.After(session.StartsAt) {
+		return fmt.Errorf("%w: ends_at must be after starts_at", ErrInvalidSession)
+	}
+
+	return nil
+}
+
+// parseDateTime acepta RFC 3339 o una fecha y hora sin zona, que se toma como hora local de loc
+func parseDateTime(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02T15:04:05"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("%w: invalid date %q, must be RFC 3339 or YYYY-MM-DDTHH:MM", ErrInvalidSession, value)
+}
+
+// atClock devuelve la hora del dia de day en su zona; no suma la duracion a la medianoche
+// porque los dias con cambio de horario no duran 24 horas
+func atClock(day time.Time, clock time.Duration) time.Time {
+	y, m, d := day.Date()
+	return time.Date(y, m, d, int(clock/time.Hour), int(clock%time.Hour/time.Minute), 0, 0, day.Location())
+}
+
+// parseClock convierte "HH:MM" en la duracion desde la medianoche
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid time %q, must be HH:MM", ErrInvalidSession, value)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func loadLocation(timezone string) (*time.Location, error) {
+	if timezone == "" {
+		return nil, fmt.Errorf("%w: timezone is required", ErrInvalidSession)
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unknown timezone %q", ErrInvalidSession, timezone)
+	}
+
+	return loc, nil
+}
@@ -2,10 +2,16 @@ package user
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
-	"strconv"
+	"strings"
+	"time"
 
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/auth"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/etag"
 	"github.com/MartinZitterkopf/gocurse_web/pkg/meta"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/sorting"
 	"github.com/gorilla/mux"
 )
 
@@ -13,11 +19,15 @@ type (
 	Controller func(w http.ResponseWriter, r *http.Request)
 
 	Endpoints struct {
-		Create Controller
-		Get    Controller
-		GetAll Controller
-		Update Controller
-		Delete Controller
+		Create  Controller
+		Get     Controller
+		GetAll  Controller
+		Update  Controller
+		Delete  Controller
+		Restore Controller
+		Purge   Controller
+
+		RotateAPIKey Controller
 	}
 
 	CreateReq struct {
@@ -40,15 +50,29 @@ type (
 		Err    string      `json:"error,omitempty"`
 		Meta   *meta.Meta  `json:"meta,omitempty"`
 	}
+
+	// DeletedUser es como se muestra en los listados con include_deleted u only_deleted,
+	// el unico lugar donde se expone la fecha de borrado
+	DeletedUser struct {
+		domain.User
+		DeletedAt *time.Time `json:"deleted_at"`
+	}
 )
 
+// columnas por las que se puede ordenar con ?sort=
+var sortableFields = []string{"first_name", "last_name", "email", "created_at"}
+
 func MakeEndpoints(s Service) Endpoints {
 	return Endpoints{
-		Create: makeCreateEnpoint(s),
-		GetAll: makeGetAllEnpoint(s),
-		Get:    makeGetEnpoint(s),
-		Update: makeUpdateEnpoint(s),
-		Delete: makeDeleteEnpoint(s),
+		Create:  makeCreateEnpoint(s),
+		GetAll:  makeGetAllEnpoint(s),
+		Get:     makeGetEnpoint(s),
+		Update:  makeUpdateEnpoint(s),
+		Delete:  makeDeleteEnpoint(s),
+		Restore: makeRestoreEndpoint(s),
+		Purge:   makePurgeEndpoint(s),
+
+		RotateAPIKey: makeRotateAPIKeyEndpoint(s),
 	}
 }
 
@@ -75,7 +99,7 @@ func makeCreateEnpoint(s Service) Controller {
 		}
 
 		// modificado luego video 65
-		user, err := s.Create(req.FirstName, req.LastName, req.Email, req.Phone)
+		user, err := s.Create(r.Context(), req.FirstName, req.LastName, req.Email, req.Phone)
 		if err != nil {
 			w.WriteHeader(400)
 			json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
@@ -92,10 +116,44 @@ func makeGetAllEnpoint(s Service) Controller {
 		filters := Fillters{
 			FirstName: v.Get("first_name"),
 			LastName:  v.Get("last_name"),
+			Email:     v.Get("email"),
+			Phone:     v.Get("phone"),
+			Q:         strings.TrimSpace(v.Get("q")),
+		}
+
+		page, limit, err := meta.Params(v)
+		if err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
+			return
+		}
+
+		filters.IncludeDeleted = v.Get("include_deleted") == "true"
+		filters.OnlyDeleted = v.Get("only_deleted") == "true"
+		if (filters.IncludeDeleted || filters.OnlyDeleted) && !auth.IsAdmin(r) {
+			w.WriteHeader(403)
+			json.NewEncoder(w).Encode(&Response{Status: 403, Err: "only admins can list deleted users"})
+			return
+		}
+
+		sort, err := sorting.Parse(v.Get("sort"), sortableFields)
+		if err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
+			return
 		}
 
-		limit, _ := strconv.Atoi(v.Get("limit"))
-		page, _ := strconv.Atoi(v.Get("page"))
+		if meta.IsCursor(v) {
+			// el cursor solo codifica created_at e id, por eso no se puede combinar con otro orden
+			if sort != nil {
+				w.WriteHeader(400)
+				json.NewEncoder(w).Encode(&Response{Status: 400, Err: "sort is not supported with cursor pagination"})
+				return
+			}
+
+			getAllByCursor(s, w, r, filters, limit)
+			return
+		}
 
 		count, err := s.Count(filters)
 		if err != nil {
@@ -111,14 +169,59 @@ func makeGetAllEnpoint(s Service) Controller {
 			return
 		}
 
-		users, err := s.GetAll(filters, meta.Offset(), meta.Limit())
+		users, err := s.GetAll(filters, sort, meta.Offset(), meta.Limit())
 		if err != nil {
 			w.WriteHeader(400)
 			json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
+			return
+		}
+
+		meta.SetLinkHeader(w, r)
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: listData(users, filters), Meta: meta})
+	}
+}
+
+func getAllByCursor(s Service, w http.ResponseWriter, r *http.Request, filters Fillters, limit int) {
+	v := r.URL.Query()
+
+	cursor, err := meta.DecodeCursor(v.Get("cursor"))
+	if err != nil {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
+		return
+	}
+
+	// en modo cursor el conteo es opcional porque tiene que recorrer toda la tabla
+	count := -1
+	if v.Get("count") == "true" {
+		count, err = s.Count(filters)
+		if err != nil {
+			w.WriteHeader(500)
+			json.NewEncoder(w).Encode(&Response{Status: 500, Err: err.Error()})
+			return
 		}
+	}
 
-		json.NewEncoder(w).Encode(&Response{Status: 200, Data: users, Meta: meta})
+	meta, err := meta.NewCursor(v.Get("cursor"), limit, count)
+	if err != nil {
+		w.WriteHeader(500)
+		json.NewEncoder(w).Encode(&Response{Status: 500, Err: err.Error()})
+		return
 	}
+
+	users, next, err := s.GetAllAfter(filters, cursor, meta.Limit())
+	if err != nil {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
+		return
+	}
+
+	if next != nil {
+		meta.NextCursor = next.Encode()
+	}
+
+	meta.SetLinkHeader(w, r)
+	json.NewEncoder(w).Encode(&Response{Status: 200, Data: listData(users, filters), Meta: meta})
 }
 
 func makeGetEnpoint(s Service) Controller {
@@ -133,6 +236,12 @@ func makeGetEnpoint(s Service) Controller {
 			return
 		}
 
+		etag.Set(w, user.Version)
+		if etag.NotModified(r, user.Version) {
+			w.WriteHeader(304)
+			return
+		}
+
 		json.NewEncoder(w).Encode(&Response{Status: 200, Data: user})
 	}
 }
@@ -162,7 +271,25 @@ func makeUpdateEnpoint(s Service) Controller {
 		path := mux.Vars(r)
 		id := path["id"]
 
-		if err := s.Update(id, req.FirstName, req.LastName, req.Email, req.Phone); err != nil {
+		version, err := etag.IfMatch(r)
+		if errors.Is(err, etag.ErrMissing) {
+			w.WriteHeader(428)
+			json.NewEncoder(w).Encode(&Response{Status: 428, Err: err.Error()})
+			return
+		}
+		if err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
+			return
+		}
+
+		if err := s.Update(r.Context(), id, version, req.FirstName, req.LastName, req.Email, req.Phone); err != nil {
+			if errors.Is(err, ErrVersionConflict) {
+				w.WriteHeader(412)
+				json.NewEncoder(w).Encode(&Response{Status: 412, Err: err.Error()})
+				return
+			}
+
 			w.WriteHeader(404)
 			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "user doesn't exist"})
 			return
@@ -177,7 +304,31 @@ func makeDeleteEnpoint(s Service) Controller {
 		path := mux.Vars(r)
 		id := path["id"]
 
-		if err := s.Delete(id); err != nil {
+		version, err := etag.IfMatch(r)
+		if errors.Is(err, etag.ErrMissing) {
+			w.WriteHeader(428)
+			json.NewEncoder(w).Encode(&Response{Status: 428, Err: err.Error()})
+			return
+		}
+		if err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(&Response{Status: 400, Err: err.Error()})
+			return
+		}
+
+		if err := s.Delete(r.Context(), id, version); err != nil {
+			if errors.Is(err, ErrVersionConflict) {
+				w.WriteHeader(412)
+				json.NewEncoder(w).Encode(&Response{Status: 412, Err: err.Error()})
+				return
+			}
+
+			if errors.Is(err, ErrActiveEnrollments) {
+				w.WriteHeader(409)
+				json.NewEncoder(w).Encode(&Response{Status: 409, Err: err.Error()})
+				return
+			}
+
 			w.WriteHeader(404)
 			json.NewEncoder(w).Encode(&Response{Status: 400, Err: "user doesn't exist"})
 			return
@@ -186,3 +337,83 @@ func makeDeleteEnpoint(s Service) Controller {
 		json.NewEncoder(w).Encode(&Response{Status: 200, Data: "success"})
 	}
 }
+
+func makeRestoreEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !auth.IsAdmin(r) {
+			w.WriteHeader(403)
+			json.NewEncoder(w).Encode(&Response{Status: 403, Err: "only admins can restore users"})
+			return
+		}
+
+		path := mux.Vars(r)
+		id := path["id"]
+
+		if err := s.Restore(r.Context(), id); err != nil {
+			w.WriteHeader(404)
+			json.NewEncoder(w).Encode(&Response{Status: 404, Err: "deleted user doesn't exist"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: "success"})
+	}
+}
+
+func makePurgeEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !auth.IsAdmin(r) {
+			w.WriteHeader(403)
+			json.NewEncoder(w).Encode(&Response{Status: 403, Err: "only admins can purge users"})
+			return
+		}
+
+		path := mux.Vars(r)
+		id := path["id"]
+
+		if err := s.Purge(r.Context(), id); err != nil {
+			w.WriteHeader(404)
+			json.NewEncoder(w).Encode(&Response{Status: 404, Err: "user doesn't exist"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: "success"})
+	}
+}
+
+// la primera key de un usuario la genera un administrador, despues el usuario puede rotar la suya
+func makeRotateAPIKeyEndpoint(s Service) Controller {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+
+		if !auth.IsAdmin(r) && auth.UserID(r) != id {
+			w.WriteHeader(403)
+			json.NewEncoder(w).Encode(&Response{Status: 403, Err: "you can only manage your own api key"})
+			return
+		}
+
+		key, err := s.RotateAPIKey(r.Context(), id)
+		if err != nil {
+			w.WriteHeader(404)
+			json.NewEncoder(w).Encode(&Response{Status: 404, Err: "user doesn't exist"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(&Response{Status: 200, Data: map[string]string{"api_key": key}})
+	}
+}
+
+func listData(users []domain.User, filters Fillters) interface{} {
+	if !filters.IncludeDeleted && !filters.OnlyDeleted {
+		return users
+	}
+
+	data := make([]DeletedUser, 0, len(users))
+	for _, item := range users {
+		d := DeletedUser{User: item}
+		if item.Deleted.Valid {
+			d.DeletedAt = &item.Deleted.Time
+		}
+		data = append(data, d)
+	}
+	return data
+}
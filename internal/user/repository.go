@@ -1,40 +1,74 @@
 package user
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"os"
 	"strings"
 
 	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"github.com/MartinZitterkopf/gocurse_web/internal/outbox"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/meta"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/sorting"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type (
 	Repository interface {
+		// Transaction corre fn con un Repository que usa tx, la transaccion que tambien recibe fn
+		Transaction(fn func(repo Repository, tx *gorm.DB) error) error
 		Create(user *domain.User) error
-		GetAll(filters Fillters, limit, offset int) ([]domain.User, error)
+		GetAll(filters Fillters, sort sorting.Sort, limit, offset int) ([]domain.User, error)
+		GetAllAfter(filters Fillters, cursor *meta.Cursor, limit int) ([]domain.User, error)
 		Get(id string) (*domain.User, error)
-		Delete(id string) error
-		Update(id string, firstName *string, lastName *string, email *string, phone *string) error
+		Delete(id string, version int) ([]domain.EnrollmentStatusChange, error)
+		Restore(id string) error
+		Purge(id string) error
+		Update(id string, version int, firstName *string, lastName *string, email *string, phone *string) error
 		Count(filters Fillters) (int, error)
+		// SaveAPIKey reemplaza la key anterior del usuario
+		SaveAPIKey(key *domain.UserAPIKey) error
+		UserIDByKeyHash(hash string) (string, error)
 	}
 
 	repo struct {
 		log *log.Logger
 		db  *gorm.DB
+		// fullText usa el indice FULLTEXT de MySQL para el parametro q en lugar de like
+		fullText     bool
+		deletePolicy domain.DeletePolicy
 	}
 )
 
 func NewRepo(log *log.Logger, db *gorm.DB) Repository {
 	return &repo{
-		log: log,
-		db:  db,
+		log:          log,
+		db:           db,
+		fullText:     os.Getenv("USER_SEARCH_FULLTEXT") == "true",
+		deletePolicy: deletePolicyFromEnv(),
 	}
 }
 
+func (repo *repo) Transaction(fn func(repo Repository, tx *gorm.DB) error) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		txRepo := *repo
+		txRepo.db = tx
+		return fn(&txRepo, tx)
+	})
+}
+
 func (repo *repo) Create(user *domain.User) error {
 
-	if err := repo.db.Create(user).Error; err != nil {
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+
+		return outbox.Add(tx, outbox.UserCreated, user.ID, user)
+	})
+	if err != nil {
 		repo.log.Printf("error; %v", err)
 		return err
 	}
@@ -42,15 +76,40 @@ func (repo *repo) Create(user *domain.User) error {
 	return nil
 }
 
-func (repo *repo) GetAll(filters Fillters, offset, limit int) ([]domain.User, error) {
+func (repo *repo) GetAll(filters Fillters, sort sorting.Sort, offset, limit int) ([]domain.User, error) {
 	var u []domain.User
 
 	// Model hace referencia al modelo de usuario y Find lo que hace es poblar la informacion que saca de la estructura
 	tx := repo.db.Model(&u)
-	tx = applyFilters(tx, filters)
+	tx = applyFilters(tx, filters, repo.fullText)
 	tx = tx.Limit(limit).Offset(offset)
 
-	result := tx.Order("created_at desc").Find(&u)
+	// cuando se busca con q primero van las coincidencias exactas y despues el orden pedido
+	order := sort.OrderBy("created_at desc, id desc")
+	if filters.Q != "" {
+		tx = tx.Clauses(searchRank(filters.Q, order))
+	} else {
+		tx = tx.Order(order)
+	}
+
+	result := tx.Find(&u)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return u, nil
+}
+
+// GetAllAfter pagina por keyset: trae los registros que estan despues del cursor
+// segun el orden created_at desc, id desc, sin usar offset
+func (repo *repo) GetAllAfter(filters Fillters, cursor *meta.Cursor, limit int) ([]domain.User, error) {
+	var u []domain.User
+
+	tx := repo.db.Model(&u)
+	tx = applyFilters(tx, filters, repo.fullText)
+	tx = applyCursor(tx, cursor)
+
+	result := tx.Order("created_at desc, id desc").Limit(limit).Find(&u)
 	if result.Error != nil {
 		return nil, result.Error
 	}
@@ -68,17 +127,145 @@ func (repo *repo) Get(id string) (*domain.User, error) {
 	return &user, nil
 }
 
-func (repo *repo) Delete(id string) error {
-	user := domain.User{ID: id}
+// Delete devuelve las inscripciones que cambiaron de estado por la politica de borrado
+func (repo *repo) Delete(id string, version int) ([]domain.EnrollmentStatusChange, error) {
+	var changes []domain.EnrollmentStatusChange
+
+	// las inscripciones se actualizan en la misma transaccion que el borrado
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		changes, err = applyDeletePolicy(tx, repo.deletePolicy, id)
+		if err != nil {
+			return err
+		}
+
+		user := domain.User{ID: id}
+		del := tx
+		if version > 0 {
+			del = del.Where("version = ?", version)
+		}
 
-	if err := repo.db.Delete(&user).Error; err != nil {
+		result := del.Delete(&user)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return repo.notUpdated(id)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// notUpdated distingue si no se modifico nada porque el registro no existe o porque cambio su version
+func (repo *repo) notUpdated(id string) error {
+	if _, err := repo.Get(id); err != nil {
 		return err
 	}
 
+	return ErrVersionConflict
+}
+
+func (repo *repo) Restore(id string) error {
+	result := repo.db.Unscoped().Model(&domain.User{}).Where("id = ? AND deleted IS NOT NULL", id).Update("deleted", nil)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
 	return nil
 }
 
-func (repo *repo) Update(id string, firstName *string, lastName *string, email *string, phone *string) error {
+// Purge borra definitivamente el registro junto con sus inscripciones y asignaciones como instructor
+func (repo *repo) Purge(id string) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", id).Delete(&domain.Enrollment{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", id).Delete(&domain.CurseInstructor{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", id).Delete(&domain.Attendance{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", id).Delete(&domain.Score{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", id).Delete(&domain.FinalGrade{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", id).Delete(&domain.Certificate{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", id).Delete(&domain.CalendarToken{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", id).Delete(&domain.UserAPIKey{}).Error; err != nil {
+			return err
+		}
+
+		// los emails guardan la direccion y el texto que se le envio al usuario
+		if err := tx.Where("user_id = ?", id).Delete(&domain.Notification{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", id).Delete(&domain.NotificationPreference{}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().Delete(&domain.User{ID: id})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		repo.log.Println("User purged with id: ", id)
+		return nil
+	})
+}
+
+func (repo *repo) SaveAPIKey(key *domain.UserAPIKey) error {
+	return repo.db.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"key_hash", "created_at"}),
+	}).Create(key).Error
+}
+
+// UserIDByKeyHash no reconoce las keys de usuarios borrados
+func (repo *repo) UserIDByKeyHash(hash string) (string, error) {
+	var key domain.UserAPIKey
+
+	err := repo.db.Joins("JOIN users ON users.id = user_api_keys.user_id AND users.deleted IS NULL").
+		Where("user_api_keys.key_hash = ?", hash).First(&key).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return key.UserID, nil
+}
+
+func (repo *repo) Update(id string, version int, firstName *string, lastName *string, email *string, phone *string) error {
 	values := make(map[string]interface{})
 
 	if firstName != nil {
@@ -97,15 +284,36 @@ func (repo *repo) Update(id string, firstName *string, lastName *string, email *
 		values["phone"] = *phone
 	}
 
-	if err := repo.db.Model(&domain.User{}).Where("id = ?", id).Updates(values).Error; err != nil {
-		return err
+	// version 0 actualiza sin controlar la version, si no solo se actualiza si nadie lo modifico antes
+	values["version"] = gorm.Expr("version + 1")
+	tx := repo.db.Model(&domain.User{}).Where("id = ?", id)
+	if version > 0 {
+		tx = tx.Where("version = ?", version)
+	}
+
+	result := tx.Updates(values)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return repo.notUpdated(id)
 	}
 
 	return nil
 }
 
 // recibe la base de datos desde gorm y el filtro a buscar
-func applyFilters(tx *gorm.DB, filters Fillters) *gorm.DB {
+func applyFilters(tx *gorm.DB, filters Fillters, fullText bool) *gorm.DB {
+	// los registros borrados solo se ven si se piden explicitamente
+	if filters.IncludeDeleted || filters.OnlyDeleted {
+		tx = tx.Unscoped()
+	}
+
+	if filters.OnlyDeleted {
+		tx = tx.Where("deleted IS NOT NULL")
+	}
+
 	if filters.FirstName != "" {
 		filters.FirstName = fmt.Sprintf("%%%s%%", strings.ToLower(filters.FirstName))
 		tx = tx.Where("lower(first_name) like ?", filters.FirstName)
@@ -113,16 +321,81 @@ func applyFilters(tx *gorm.DB, filters Fillters) *gorm.DB {
 
 	if filters.LastName != "" {
 		filters.LastName = fmt.Sprintf("%%%s%%", strings.ToLower(filters.LastName))
-		tx = tx.Where("lower(first_name) like ?", filters.LastName)
+		tx = tx.Where("lower(last_name) like ?", filters.LastName)
+	}
+
+	if filters.Email != "" {
+		filters.Email = fmt.Sprintf("%%%s%%", strings.ToLower(filters.Email))
+		tx = tx.Where("lower(email) like ?", filters.Email)
+	}
+
+	// el telefono se compara solo por sus digitos, asi "+54 11 1234" encuentra "541112345678"
+	if phone := digits(filters.Phone); phone != "" {
+		tx = tx.Where(phoneDigits+" like ?", fmt.Sprintf("%%%s%%", phone))
+	}
+
+	if filters.Q != "" {
+		tx = applySearch(tx, filters.Q, fullText)
 	}
 
 	return tx
 }
 
+const (
+	fullName    = "lower(concat(first_name, ' ', last_name))"
+	phoneDigits = "replace(replace(replace(replace(replace(phone, ' ', ''), '-', ''), '+', ''), '(', ''), ')', '')"
+)
+
+// applySearch exige que cada palabra de q aparezca en el nombre o en el email
+func applySearch(tx *gorm.DB, q string, fullText bool) *gorm.DB {
+	terms := strings.Fields(strings.ToLower(q))
+
+	if fullText {
+		// en modo boolean cada termino es obligatorio (+) y acepta prefijos (*)
+		var against []string
+		for _, t := range terms {
+			if t = strings.Trim(t, `+-<>()~*"@`); t != "" {
+				against = append(against, "+"+t+"*")
+			}
+		}
+		if len(against) > 0 {
+			return tx.Where("MATCH(first_name, last_name, email) AGAINST (? IN BOOLEAN MODE)", strings.Join(against, " "))
+		}
+	}
+
+	for _, t := range terms {
+		like := fmt.Sprintf("%%%s%%", t)
+		tx = tx.Where("("+fullName+" like ? OR lower(email) like ?)", like, like)
+	}
+
+	return tx
+}
+
+// searchRank ordena primero el nombre completo o email exacto, despues los que empiezan con q,
+// luego el resto y dentro de cada grupo segun order
+func searchRank(q, order string) clause.OrderBy {
+	q = strings.ToLower(q)
+	return clause.OrderBy{Expression: clause.Expr{
+		SQL: "CASE WHEN " + fullName + " = ? OR lower(email) = ? THEN 0 " +
+			"WHEN " + fullName + " like ? OR lower(last_name) like ? OR lower(email) like ? THEN 1 ELSE 2 END, " + order,
+		Vars: []interface{}{q, q, q + "%", q + "%", q + "%"},
+	}}
+}
+
+func digits(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
 func (repo *repo) Count(filters Fillters) (int, error) {
 	var count int64
 	tx := repo.db.Model(domain.User{})
-	tx = applyFilters(tx, filters)
+	tx = applyFilters(tx, filters, repo.fullText)
 
 	if err := tx.Count(&count).Error; err != nil {
 		return 0, err
@@ -130,3 +403,38 @@ func (repo *repo) Count(filters Fillters) (int, error) {
 
 	return int(count), nil
 }
+
+func applyCursor(tx *gorm.DB, cursor *meta.Cursor) *gorm.DB {
+	if cursor == nil {
+		return tx
+	}
+
+	return tx.Where("(created_at < ? OR (created_at = ? AND id < ?))", cursor.CreatedAt, cursor.CreatedAt, cursor.ID)
+}
+
+func applyDeletePolicy(tx *gorm.DB, policy domain.DeletePolicy, id string) ([]domain.EnrollmentStatusChange, error) {
+	switch policy {
+	case domain.DeleteBlock:
+		var count int64
+		if err := tx.Model(&domain.Enrollment{}).Where("user_id = ? AND status IN ?", id, domain.EnrollmentActiveStatuses).Count(&count).Error; err != nil {
+			return nil, err
+		}
+
+		if count > 0 {
+			return nil, ErrActiveEnrollments
+		}
+
+	case domain.DeleteCancel:
+		return outbox.StatusChanged(tx, domain.EnrollmentCancelled, "user_id = ? AND status IN ?", id, domain.EnrollmentActiveStatuses)
+	}
+
+	return nil, nil
+}
+
+func deletePolicyFromEnv() domain.DeletePolicy {
+	switch policy := domain.DeletePolicy(os.Getenv("ENROLLMENT_DELETE_POLICY")); policy {
+	case domain.DeleteCancel, domain.DeleteBlock:
+		return policy
+	}
+	return domain.DeleteKeep
+}
@@ -1,42 +1,75 @@
 package user
 
 import (
+	"context"
+	"errors"
 	"log"
 
+	"github.com/MartinZitterkopf/gocurse_web/internal/audit"
 	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/auth"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/events"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/meta"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/sorting"
+	"gorm.io/gorm"
 )
 
+// ErrActiveEnrollments se devuelve al borrar con la politica block y hay inscripciones activas
+var ErrActiveEnrollments = errors.New("user has active enrollments")
+
+// ErrVersionConflict se devuelve cuando la version que manda el cliente ya no es la actual
+var ErrVersionConflict = errors.New("user was modified by another request")
+
 type (
 	Service interface {
 		// modificado luego video 65
-		Create(firstName, lastName, email, phone string) (*domain.User, error)
-		GetAll(filters Fillters, offset, limit int) ([]domain.User, error)
+		Create(ctx context.Context, firstName, lastName, email, phone string) (*domain.User, error)
+		GetAll(filters Fillters, sort sorting.Sort, offset, limit int) ([]domain.User, error)
+		GetAllAfter(filters Fillters, cursor *meta.Cursor, limit int) ([]domain.User, *meta.Cursor, error)
 		Get(id string) (*domain.User, error)
-		Delete(id string) error
-		Update(id string, firstName *string, lastName *string, email *string, phone *string) error
+		Delete(ctx context.Context, id string, version int) error
+		Restore(ctx context.Context, id string) error
+		Purge(ctx context.Context, id string) error
+		Update(ctx context.Context, id string, version int, firstName *string, lastName *string, email *string, phone *string) error
 		Count(filters Fillters) (int, error)
+		// RotateAPIKey genera la api key con la que se identifica el usuario e invalida la anterior
+		RotateAPIKey(ctx context.Context, id string) (string, error)
 	}
 
 	service struct {
 		log  *log.Logger
 		repo Repository
+		bus  events.Publisher
+	}
+
+	// CreatedEvent se publica despues de crear un usuario
+	CreatedEvent struct {
+		User domain.User
 	}
 
 	Fillters struct {
 		FirstName string
 		LastName  string
+		Email     string
+		Phone     string
+		// Q busca en el nombre completo y el email a la vez
+		Q string
+		// solo los administradores pueden pedir los registros borrados
+		IncludeDeleted bool
+		OnlyDeleted    bool
 	}
 )
 
-func NewService(log *log.Logger, repo Repository) Service {
+func NewService(log *log.Logger, repo Repository, bus events.Publisher) Service {
 	return &service{
 		log:  log,
 		repo: repo,
+		bus:  bus,
 	}
 }
 
 // modificado luego video 65
-func (s service) Create(firstName, lastName, email, phone string) (*domain.User, error) {
+func (s service) Create(ctx context.Context, firstName, lastName, email, phone string) (*domain.User, error) {
 	s.log.Println("Create user service")
 	user := domain.User{
 		FirstName: firstName,
@@ -45,15 +78,25 @@ func (s service) Create(firstName, lastName, email, phone string) (*domain.User,
 		Phone:     phone,
 	}
 
-	if err := s.repo.Create(&user); err != nil {
+	err := s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		if err := repo.Create(&user); err != nil {
+			return err
+		}
+
+		return audit.Add(ctx, tx, audit.ActionCreate, audit.EntityUser, user.ID, nil, &user)
+	})
+	if err != nil {
 		return nil, err
 	}
 
+	if err := s.bus.Publish(ctx, CreatedEvent{User: user}); err != nil {
+		s.log.Println(err)
+	}
 	return &user, nil
 }
 
-func (s service) GetAll(filters Fillters, offset, limit int) ([]domain.User, error) {
-	users, err := s.repo.GetAll(filters, offset, limit)
+func (s service) GetAll(filters Fillters, sort sorting.Sort, offset, limit int) ([]domain.User, error) {
+	users, err := s.repo.GetAll(filters, sort, offset, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -61,6 +104,29 @@ func (s service) GetAll(filters Fillters, offset, limit int) ([]domain.User, err
 	return users, nil
 }
 
+// GetAllAfter devuelve la pagina siguiente al cursor y el cursor de la proxima pagina,
+// que es nil cuando no hay mas registros
+func (s service) GetAllAfter(filters Fillters, cursor *meta.Cursor, limit int) ([]domain.User, *meta.Cursor, error) {
+	// pido un registro de mas para saber si existe una pagina siguiente
+	users, err := s.repo.GetAllAfter(filters, cursor, limit+1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(users) <= limit {
+		return users, nil, nil
+	}
+
+	users = users[:limit]
+	last := users[limit-1]
+	next := &meta.Cursor{ID: last.ID}
+	if last.CreatedAt != nil {
+		next.CreatedAt = *last.CreatedAt
+	}
+
+	return users, next, nil
+}
+
 func (s service) Get(id string) (*domain.User, error) {
 	user, err := s.repo.Get(id)
 	if err != nil {
@@ -70,14 +136,112 @@ func (s service) Get(id string) (*domain.User, error) {
 	return user, nil
 }
 
-func (s service) Delete(id string) error {
-	return s.repo.Delete(id)
+func (s service) Delete(ctx context.Context, id string, version int) error {
+	before, err := s.repo.Get(id)
+	if err != nil {
+		return err
+	}
+
+	if version > 0 && before.Version != version {
+		return ErrVersionConflict
+	}
+
+	var changes []domain.EnrollmentStatusChange
+	err = s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		changes, err = repo.Delete(id, version)
+		if err != nil {
+			return err
+		}
+
+		// cada inscripcion cancelada por la politica de borrado queda auditada por separado
+		for _, change := range changes {
+			if err := audit.Add(ctx, tx, audit.ActionUpdate, audit.EntityEnrollment, change.ID,
+				map[string]string{"status": change.From}, map[string]string{"status": change.To}); err != nil {
+				return err
+			}
+		}
+
+		return audit.Add(ctx, tx, audit.ActionDelete, audit.EntityUser, id, before, nil)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		if err := s.bus.Publish(ctx, change); err != nil {
+			s.log.Println(err)
+		}
+	}
+
+	return nil
+}
+
+func (s service) Restore(ctx context.Context, id string) error {
+	return s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		if err := repo.Restore(id); err != nil {
+			return err
+		}
+
+		after, err := repo.Get(id)
+		if err != nil {
+			return err
+		}
+
+		return audit.Add(ctx, tx, audit.ActionRestore, audit.EntityUser, id, nil, after)
+	})
+}
+
+func (s service) Purge(ctx context.Context, id string) error {
+	return s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		if err := repo.Purge(id); err != nil {
+			return err
+		}
+
+		return audit.Add(ctx, tx, audit.ActionPurge, audit.EntityUser, id, nil, nil)
+	})
 }
 
-func (s service) Update(id string, firstName *string, lastName *string, email *string, phone *string) error {
-	return s.repo.Update(id, firstName, lastName, email, phone)
+func (s service) Update(ctx context.Context, id string, version int, firstName *string, lastName *string, email *string, phone *string) error {
+	before, err := s.repo.Get(id)
+	if err != nil {
+		return err
+	}
+
+	if version > 0 && before.Version != version {
+		return ErrVersionConflict
+	}
+
+	return s.repo.Transaction(func(repo Repository, tx *gorm.DB) error {
+		if err := repo.Update(id, version, firstName, lastName, email, phone); err != nil {
+			return err
+		}
+
+		after, err := repo.Get(id)
+		if err != nil {
+			return err
+		}
+
+		return audit.Add(ctx, tx, audit.ActionUpdate, audit.EntityUser, id, before, after)
+	})
 }
 
 func (s service) Count(filters Fillters) (int, error) {
 	return s.repo.Count(filters)
 }
+
+func (s service) RotateAPIKey(ctx context.Context, id string) (string, error) {
+	if _, err := s.repo.Get(id); err != nil {
+		return "", err
+	}
+
+	key, err := auth.NewKey()
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.repo.SaveAPIKey(&domain.UserAPIKey{UserID: id, KeyHash: auth.HashKey(key)}); err != nil {
+		return "", err
+	}
+
+	return key, nil
+}
@@ -0,0 +1,273 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+)
+
+const (
+	HeaderSignature = "X-Webhook-Signature"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderEventID   = "X-Webhook-Event-ID"
+	HeaderDelivery  = "X-Webhook-Delivery"
+)
+
+type (
+	DispatcherConfig struct {
+		Interval    time.Duration
+		MaxAttempts int
+		// Backoff es la espera despues del primer fallo, se duplica en cada intento hasta MaxBackoff
+		Backoff    time.Duration
+		MaxBackoff time.Duration
+		BatchSize  int
+	}
+
+	// Dispatcher reparte los eventos del outbox y los entrega a los webhooks
+	Dispatcher struct {
+		log    *log.Logger
+		repo   Repository
+		client *http.Client
+		config DispatcherConfig
+		now    func() time.Time
+	}
+
+	// Envelope es el cuerpo que recibe cada webhook
+	Envelope struct {
+		ID         string          `json:"id"`
+		Type       string          `json:"type"`
+		OccurredAt *time.Time      `json:"occurred_at"`
+		Data       json.RawMessage `json:"data"`
+	}
+)
+
+func NewDispatcher(l *log.Logger, r Repository, client *http.Client, config DispatcherConfig) *Dispatcher {
+	return &Dispatcher{
+		log:    l,
+		repo:   r,
+		client: client,
+		config: config,
+		now:    time.Now,
+	}
+}
+
+// ConfigFromEnv lee WEBHOOK_POLL_INTERVAL y WEBHOOK_MAX_ATTEMPTS
+func ConfigFromEnv() (DispatcherConfig, error) {
+	config := DispatcherConfig{
+		Interval:    5 * time.Second,
+		MaxAttempts: 8,
+		Backoff:     30 * time.Second,
+		MaxBackoff:  6 * time.Hour,
+		BatchSize:   50,
+	}
+
+	if v := os.Getenv("WEBHOOK_POLL_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval <= 0 {
+			return config, fmt.Errorf("invalid WEBHOOK_POLL_INTERVAL %q", v)
+		}
+		config.Interval = interval
+	}
+
+	if v := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); v != "" {
+		attempts, err := strconv.Atoi(v)
+		if err != nil || attempts < 1 {
+			return config, fmt.Errorf("invalid WEBHOOK_MAX_ATTEMPTS %q", v)
+		}
+		config.MaxAttempts = attempts
+	}
+
+	return config, nil
+}
+
+// Run procesa el outbox cada Interval hasta que se cancele ctx
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.RunOnce(ctx); err != nil {
+			d.log.Printf("webhook dispatcher error: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce reparte los eventos pendientes e intenta las entregas que ya vencieron
+func (d *Dispatcher) RunOnce(ctx context.Context) error {
+	if _, err := d.repo.FanOut(d.config.BatchSize, d.now()); err != nil {
+		return err
+	}
+
+	// las entregas se reservan de a una justo antes de enviarlas: el lease solo tiene que cubrir
+	// un envio, si se reservara todo el lote las ultimas vencerian mientras esperan su turno
+	// y otra instancia las volveria a mandar
+	lease := d.client.Timeout + time.Minute
+	for i := 0; i < d.config.BatchSize; i++ {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		deliveries, err := d.repo.ClaimDue(1, d.now(), lease)
+		if err != nil {
+			return err
+		}
+
+		if len(deliveries) == 0 {
+			return nil
+		}
+
+		d.attempt(ctx, &deliveries[0])
+		if err := d.repo.SaveAttempt(&deliveries[0]); err != nil {
+			d.log.Printf("webhook dispatcher error: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, delivery *domain.WebhookDelivery) {
+	delivery.Attempts++
+
+	if delivery.Webhook == nil || delivery.Webhook.Deleted.Valid || !delivery.Webhook.Active || delivery.Event == nil {
+		delivery.Status = domain.DeliveryDead
+		delivery.LastError = "webhook is no longer active"
+		return
+	}
+
+	status, err := d.send(ctx, delivery)
+	delivery.ResponseStatus = status
+	if err == nil {
+		now := d.now()
+		delivery.Status = domain.DeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.LastError = ""
+		return
+	}
+
+	delivery.LastError = truncate(err.Error(), 255)
+	if delivery.Attempts >= d.config.MaxAttempts {
+		delivery.Status = domain.DeliveryDead
+		return
+	}
+
+	delivery.NextAttemptAt = d.now().Add(d.backoff(delivery.Attempts))
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery *domain.WebhookDelivery) (int, error) {
+	body, err := json.Marshal(Envelope{
+		ID:         delivery.Event.ID,
+		Type:       delivery.Event.Type,
+		OccurredAt: delivery.Event.CreatedAt,
+		Data:       delivery.Event.Payload,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.Event.Type)
+	req.Header.Set(HeaderEventID, delivery.Event.ID)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderSignature, Sign(delivery.Webhook.Secret, d.now().Unix(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.config.Backoff
+	for i := 1; i < attempts && wait < d.config.MaxBackoff; i++ {
+		wait *= 2
+	}
+
+	if wait > d.config.MaxBackoff {
+		wait = d.config.MaxBackoff
+	}
+
+	return wait
+}
+
+// Sign firma el cuerpo con HMAC-SHA256 sobre "timestamp.body", con el formato t=<unix>,v1=<hex>
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// Verify es lo que tiene que hacer quien recibe el webhook para validar la firma
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var timestamp int64
+	var signature string
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		switch kv[0] {
+		case "t":
+			timestamp, _ = strconv.ParseInt(kv[1], 10, 64)
+		case "v1":
+			signature = kv[1]
+		}
+	}
+
+	if timestamp == 0 || signature == "" {
+		return errors.New("invalid signature header")
+	}
+
+	if diff := now.Sub(time.Unix(timestamp, 0)); diff > tolerance || diff < -tolerance {
+		return errors.New("signature timestamp out of tolerance")
+	}
+
+	expected := Sign(secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(fmt.Sprintf("t=%d,v1=%s", timestamp, signature))) {
+		return errors.New("invalid signature")
+	}
+
+	return nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
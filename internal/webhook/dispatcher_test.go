@@ -0,0 +1,164 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/queuetest"
+)
+
+// memoryRepo tiene las entregas en memoria para probar el Dispatcher sin base de datos
+type memoryRepo struct {
+	Repository
+
+	queue *queuetest.Queue[domain.WebhookDelivery]
+}
+
+func newMemoryRepo(deliveries ...domain.WebhookDelivery) *memoryRepo {
+	return &memoryRepo{queue: queuetest.New(queuetest.Fields[domain.WebhookDelivery]{
+		ID:      func(d domain.WebhookDelivery) string { return d.ID },
+		Pending: func(d domain.WebhookDelivery) bool { return d.Status == domain.DeliveryPending },
+		Next:    func(d *domain.WebhookDelivery) *time.Time { return &d.NextAttemptAt },
+	}, deliveries...)}
+}
+
+func (r *memoryRepo) FanOut(limit int, now time.Time) (int, error) {
+	return 0, nil
+}
+
+func (r *memoryRepo) ClaimDue(limit int, now time.Time, lease time.Duration) ([]domain.WebhookDelivery, error) {
+	return r.queue.ClaimDue(limit, now, lease)
+}
+
+func (r *memoryRepo) SaveAttempt(delivery *domain.WebhookDelivery) error {
+	return r.queue.SaveAttempt(delivery)
+}
+
+func newDelivery(url string, now time.Time) domain.WebhookDelivery {
+	return domain.WebhookDelivery{
+		ID:            "d1",
+		WebhookID:     "w1",
+		Webhook:       &domain.Webhook{ID: "w1", URL: url, Secret: "secret", Active: true},
+		EventID:       "e1",
+		Event:         &domain.OutboxEvent{ID: "e1", Type: "enrollment.status_changed", Payload: json.RawMessage(`{"id":"x"}`), CreatedAt: &now},
+		Status:        domain.DeliveryPending,
+		NextAttemptAt: now,
+	}
+}
+
+func newDispatcher(repo Repository, client *http.Client, config DispatcherConfig, now *time.Time) *Dispatcher {
+	d := NewDispatcher(log.New(io.Discard, "", 0), repo, client, config)
+	d.now = func() time.Time { return *now }
+	return d
+}
+
+func TestDeliveryIsSigned(t *testing.T) {
+	now := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+
+	received := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(HeaderEvent) != "enrollment.status_changed" || r.Header.Get(HeaderEventID) != "e1" || r.Header.Get(HeaderDelivery) != "d1" {
+			t.Errorf("unexpected headers %v", r.Header)
+		}
+
+		var envelope Envelope
+		if err := json.Unmarshal(body, &envelope); err != nil || envelope.ID != "e1" || string(envelope.Data) != `{"id":"x"}` {
+			t.Errorf("unexpected body %s", body)
+		}
+
+		received <- Verify("secret", r.Header.Get(HeaderSignature), body, 5*time.Minute, now)
+	}))
+	defer srv.Close()
+
+	repo := newMemoryRepo(newDelivery(srv.URL, now))
+	d := newDispatcher(repo, srv.Client(), DispatcherConfig{MaxAttempts: 3, Backoff: time.Minute, MaxBackoff: time.Hour, BatchSize: 10}, &now)
+
+	if err := d.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-received; err != nil {
+		t.Fatalf("signature: %v", err)
+	}
+
+	// con otro secreto la firma no tiene que validar
+	body, _ := json.Marshal(map[string]string{"id": "x"})
+	if err := Verify("other", Sign("secret", now.Unix(), body), body, 5*time.Minute, now); err == nil {
+		t.Fatal("signature with another secret was accepted")
+	}
+
+	got := repo.queue.Get("d1")
+	if got.Status != domain.DeliveryDelivered || got.Attempts != 1 || got.ResponseStatus != 200 || got.DeliveredAt == nil {
+		t.Fatalf("delivery = %+v", got)
+	}
+}
+
+func TestFailedDeliveryBacksOffThenDies(t *testing.T) {
+	now := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+
+	var mu sync.Mutex
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits++
+		mu.Unlock()
+		w.WriteHeader(500)
+	}))
+	defer srv.Close()
+
+	repo := newMemoryRepo(newDelivery(srv.URL, now))
+	d := newDispatcher(repo, srv.Client(), DispatcherConfig{MaxAttempts: 3, Backoff: time.Minute, MaxBackoff: 90 * time.Second, BatchSize: 10}, &now)
+
+	run := func(wantHits int) domain.WebhookDelivery {
+		t.Helper()
+		if err := d.RunOnce(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if hits != wantHits {
+			t.Fatalf("hits = %d, want %d", hits, wantHits)
+		}
+		return repo.queue.Get("d1")
+	}
+
+	start := now
+	got := run(1)
+	if got.Status != domain.DeliveryPending || got.Attempts != 1 || got.ResponseStatus != 500 || got.LastError != "unexpected status 500" {
+		t.Fatalf("after first attempt = %+v", got)
+	}
+	if !got.NextAttemptAt.Equal(start.Add(time.Minute)) {
+		t.Fatalf("next attempt = %v, want %v", got.NextAttemptAt, start.Add(time.Minute))
+	}
+
+	// antes de que venza el backoff no se vuelve a intentar
+	now = now.Add(30 * time.Second)
+	run(1)
+
+	// el segundo backoff se duplica pero queda limitado por MaxBackoff
+	now = start.Add(time.Minute)
+	got = run(2)
+	if got.Status != domain.DeliveryPending || got.Attempts != 2 || !got.NextAttemptAt.Equal(now.Add(90*time.Second)) {
+		t.Fatalf("after second attempt = %+v", got)
+	}
+
+	now = now.Add(90 * time.Second)
+	got = run(3)
+	if got.Status != domain.DeliveryDead || got.Attempts != 3 {
+		t.Fatalf("after last attempt = %+v", got)
+	}
+
+	// una entrega muerta no se vuelve a enviar
+	now = now.Add(time.Hour)
+	run(3)
+}
@@ -0,0 +1,241 @@
+package webhook
+
+import (
+	"log"
+	"time"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type (
+	Repository interface {
+		Create(webhook *domain.Webhook) error
+		GetAll(offset, limit int) ([]domain.Webhook, error)
+		Get(id string) (*domain.Webhook, error)
+		Delete(id string) error
+		Count() (int, error)
+		GetDeliveries(filters DeliveryFillters, offset, limit int) ([]domain.WebhookDelivery, error)
+		CountDeliveries(filters DeliveryFillters) (int, error)
+		RetryDelivery(id string, now time.Time) error
+		FanOut(limit int, now time.Time) (int, error)
+		ClaimDue(limit int, now time.Time, lease time.Duration) ([]domain.WebhookDelivery, error)
+		SaveAttempt(delivery *domain.WebhookDelivery) error
+	}
+
+	repo struct {
+		log *log.Logger
+		db  *gorm.DB
+	}
+)
+
+func NewRepo(l *log.Logger, db *gorm.DB) Repository {
+	return &repo{
+		log: l,
+		db:  db,
+	}
+}
+
+func (r *repo) Create(webhook *domain.Webhook) error {
+	if err := r.db.Create(webhook).Error; err != nil {
+		r.log.Printf("error: %v", err)
+		return err
+	}
+
+	r.log.Println("webhook created with id: ", webhook.ID)
+	return nil
+}
+
+func (r *repo) GetAll(offset, limit int) ([]domain.Webhook, error) {
+	var webhooks []domain.Webhook
+
+	if err := r.db.Order("created_at desc, id desc").Limit(limit).Offset(offset).Find(&webhooks).Error; err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func (r *repo) Get(id string) (*domain.Webhook, error) {
+	webhook := domain.Webhook{ID: id}
+
+	if err := r.db.First(&webhook).Error; err != nil {
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+func (r *repo) Delete(id string) error {
+	result := r.db.Delete(&domain.Webhook{ID: id})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r *repo) Count() (int, error) {
+	var count int64
+
+	if err := r.db.Model(&domain.Webhook{}).Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	return int(count), nil
+}
+
+func (r *repo) GetDeliveries(filters DeliveryFillters, offset, limit int) ([]domain.WebhookDelivery, error) {
+	var deliveries []domain.WebhookDelivery
+
+	tx := r.db.Model(&deliveries).Preload("Event")
+	tx = applyDeliveryFilters(tx, filters)
+
+	if err := tx.Order("created_at desc, id desc").Limit(limit).Offset(offset).Find(&deliveries).Error; err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func (r *repo) CountDeliveries(filters DeliveryFillters) (int, error) {
+	var count int64
+	tx := r.db.Model(&domain.WebhookDelivery{})
+	tx = applyDeliveryFilters(tx, filters)
+
+	if err := tx.Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	return int(count), nil
+}
+
+// RetryDelivery vuelve a poner en cola una entrega, sirve para las que quedaron en dead
+func (r *repo) RetryDelivery(id string, now time.Time) error {
+	result := r.db.Model(&domain.WebhookDelivery{}).Where("id = ? AND status <> ?", id, domain.DeliveryDelivered).
+		Updates(map[string]interface{}{
+			"status":          domain.DeliveryPending,
+			"attempts":        0,
+			"next_attempt_at": now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// FanOut toma los eventos del outbox que todavia no se repartieron y crea una entrega
+// por cada webhook activo suscripto a ese tipo de evento
+func (r *repo) FanOut(limit int, now time.Time) (int, error) {
+	var events []domain.OutboxEvent
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// SKIP LOCKED permite que varias instancias repartan eventos distintos al mismo tiempo
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("dispatched_at IS NULL").Order("created_at, id").Limit(limit).Find(&events).Error; err != nil {
+			return err
+		}
+
+		if len(events) == 0 {
+			return nil
+		}
+
+		var webhooks []domain.Webhook
+		if err := tx.Where("active = ?", true).Find(&webhooks).Error; err != nil {
+			return err
+		}
+
+		ids := make([]string, 0, len(events))
+		for _, e := range events {
+			ids = append(ids, e.ID)
+			for _, w := range webhooks {
+				if !subscribed(w.Events, e.Type) {
+					continue
+				}
+
+				delivery := &domain.WebhookDelivery{
+					WebhookID:     w.ID,
+					EventID:       e.ID,
+					Status:        domain.DeliveryPending,
+					NextAttemptAt: now,
+				}
+				if err := tx.Create(delivery).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		return tx.Model(&domain.OutboxEvent{}).Where("id IN ?", ids).Update("dispatched_at", now).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(events), nil
+}
+
+// ClaimDue reserva las entregas pendientes que ya se pueden intentar corriendo su proximo
+// intento lease hacia adelante, asi otra instancia no las toma mientras se envian
+func (r *repo) ClaimDue(limit int, now time.Time, lease time.Duration) ([]domain.WebhookDelivery, error) {
+	var ids []string
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&domain.WebhookDelivery{}).Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", domain.DeliveryPending, now).
+			Order("next_attempt_at, id").Limit(limit).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		return tx.Model(&domain.WebhookDelivery{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(lease)).Error
+	})
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	// el webhook se carga aunque este borrado para poder marcar la entrega como dead
+	var deliveries []domain.WebhookDelivery
+	if err := r.db.Preload("Event").Preload("Webhook", func(tx *gorm.DB) *gorm.DB {
+		return tx.Unscoped()
+	}).Where("id IN ?", ids).Find(&deliveries).Error; err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func (r *repo) SaveAttempt(delivery *domain.WebhookDelivery) error {
+	return r.db.Model(delivery).Updates(map[string]interface{}{
+		"status":          delivery.Status,
+		"attempts":        delivery.Attempts,
+		"next_attempt_at": delivery.NextAttemptAt,
+		"response_status": delivery.ResponseStatus,
+		"last_error":      delivery.LastError,
+		"delivered_at":    delivery.DeliveredAt,
+	}).Error
+}
+
+func applyDeliveryFilters(tx *gorm.DB, filters DeliveryFillters) *gorm.DB {
+	if filters.WebhookID != "" {
+		tx = tx.Where("webhook_id = ?", filters.WebhookID)
+	}
+
+	if filters.Status != "" {
+		tx = tx.Where("status = ?", filters.Status)
+	}
+
+	return tx
+}
@@ -0,0 +1,160 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"github.com/MartinZitterkopf/gocurse_web/internal/outbox"
+)
+
+type (
+	Service interface {
+		Create(rawURL string, events []string, secret string) (*domain.Webhook, error)
+		GetAll(offset, limit int) ([]domain.Webhook, error)
+		Get(id string) (*domain.Webhook, error)
+		Delete(id string) error
+		Count() (int, error)
+		GetDeliveries(filters DeliveryFillters, offset, limit int) ([]domain.WebhookDelivery, error)
+		CountDeliveries(filters DeliveryFillters) (int, error)
+		RetryDelivery(id string) error
+	}
+
+	service struct {
+		log  *log.Logger
+		repo Repository
+	}
+
+	DeliveryFillters struct {
+		WebhookID string
+		Status    string
+	}
+)
+
+// EventTypes son los eventos a los que se puede suscribir un webhook
+var EventTypes = []string{
+	outbox.UserCreated,
+	outbox.CurseUpdated,
+	outbox.EnrollmentCreated,
+	outbox.EnrollmentStatusChanged,
+}
+
+func NewService(l *log.Logger, r Repository) Service {
+	return &service{
+		log:  l,
+		repo: r,
+	}
+}
+
+func (s service) Create(rawURL string, events []string, secret string) (*domain.Webhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("url must be an absolute http or https url")
+	}
+
+	if len(events) == 0 {
+		return nil, errors.New("events is required")
+	}
+
+	for _, e := range events {
+		if e != "*" && !contains(EventTypes, e) {
+			return nil, fmt.Errorf("invalid event %q, allowed events: %s", e, strings.Join(EventTypes, ", "))
+		}
+	}
+
+	if secret == "" {
+		secret, err = newSecret()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	webhook := &domain.Webhook{
+		URL:    rawURL,
+		Secret: secret,
+		Events: strings.Join(events, ","),
+		Active: true,
+	}
+
+	if err := s.repo.Create(webhook); err != nil {
+		return nil, err
+	}
+
+	return webhook, nil
+}
+
+func (s service) GetAll(offset, limit int) ([]domain.Webhook, error) {
+	webhooks, err := s.repo.GetAll(offset, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// el secreto solo se devuelve al crear el webhook
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+
+	return webhooks, nil
+}
+
+func (s service) Get(id string) (*domain.Webhook, error) {
+	webhook, err := s.repo.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook.Secret = ""
+	return webhook, nil
+}
+
+func (s service) Delete(id string) error {
+	return s.repo.Delete(id)
+}
+
+func (s service) Count() (int, error) {
+	return s.repo.Count()
+}
+
+func (s service) GetDeliveries(filters DeliveryFillters, offset, limit int) ([]domain.WebhookDelivery, error) {
+	return s.repo.GetDeliveries(filters, offset, limit)
+}
+
+func (s service) CountDeliveries(filters DeliveryFillters) (int, error) {
+	return s.repo.CountDeliveries(filters)
+}
+
+func (s service) RetryDelivery(id string) error {
+	return s.repo.RetryDelivery(id, time.Now())
+}
+
+func subscribed(events, eventType string) bool {
+	for _, e := range strings.Split(events, ",") {
+		if e == "*" || e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
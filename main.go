@@ -1,16 +1,39 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/MartinZitterkopf/gocurse_web/internal/attendance"
+	"github.com/MartinZitterkopf/gocurse_web/internal/audit"
+	"github.com/MartinZitterkopf/gocurse_web/internal/calendar"
+	"github.com/MartinZitterkopf/gocurse_web/internal/category"
+	"github.com/MartinZitterkopf/gocurse_web/internal/certificate"
 	"github.com/MartinZitterkopf/gocurse_web/internal/curse"
 	"github.com/MartinZitterkopf/gocurse_web/internal/enrollment"
+	"github.com/MartinZitterkopf/gocurse_web/internal/grade"
+	"github.com/MartinZitterkopf/gocurse_web/internal/instructor"
+	"github.com/MartinZitterkopf/gocurse_web/internal/job"
+	"github.com/MartinZitterkopf/gocurse_web/internal/notification"
+	"github.com/MartinZitterkopf/gocurse_web/internal/prerequisite"
+	"github.com/MartinZitterkopf/gocurse_web/internal/session"
 	"github.com/MartinZitterkopf/gocurse_web/internal/user"
+	"github.com/MartinZitterkopf/gocurse_web/internal/webhook"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/auth"
 	"github.com/MartinZitterkopf/gocurse_web/pkg/bootstrap"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/events"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/idempotency"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/mailer"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/ratelimit"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/requestid"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/scheduler"
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 )
@@ -26,31 +49,216 @@ func main() {
 		l.Fatal(err)
 	}
 
+	rateLimitConfig, err := ratelimit.ConfigFromEnv()
+	if err != nil {
+		l.Fatal(err)
+	}
+	limiter := ratelimit.New(rateLimitConfig, ratelimit.NewMemoryStore(10*time.Minute, rateLimitConfig.MaxBuckets))
+	idempotencyTTL, err := idempotency.TTLFromEnv()
+	if err != nil {
+		l.Fatal(err)
+	}
+	idempotent := idempotency.New(l, idempotency.NewDBStore(instanceDB), idempotencyTTL)
+
+	bus := events.New(l)
+	events.Subscribe(bus, func(ctx context.Context, e enrollment.CreatedEvent) error {
+		l.Printf("user %s enrolled in curse %s", e.Enrollment.UserID, e.Enrollment.CurseID)
+		return nil
+	}, events.Name("log enrollment"), events.Async())
+
+	auditRepo := audit.NewRepo(l, instanceDB)
+	auditService := audit.NewService(l, auditRepo)
+	auditEndpoint := audit.MakeEndpoints(auditService)
+
 	userRepo := user.NewRepo(l, instanceDB)
-	userService := user.NewService(l, userRepo)
+	router.Use(requestid.Middleware, limiter.PreAuth, auth.Middleware(userRepo), limiter.Middleware, idempotent.Handler)
+	userService := user.NewService(l, userRepo, bus)
 	userEndpoint := user.MakeEndpoints(userService)
 
 	curseRepo := curse.NewRepo(l, instanceDB)
-	curseService := curse.NewService(l, curseRepo)
+	curseService := curse.NewService(l, curseRepo, bus)
 	curseEndpoint := curse.MakeEndpoints(curseService)
 
+	instructorRepo := instructor.NewRepo(l, instanceDB)
+	instructorService := instructor.NewService(l, instructorRepo, userService, curseService)
+	instructorEndpoint := instructor.MakeEndpoints(instructorService)
+
+	sessionRepo := session.NewRepo(l, instanceDB)
+	sessionService := session.NewService(l, sessionRepo, curseService)
+	sessionEndpoint := session.MakeEndpoints(sessionService)
+
+	calendarRepo := calendar.NewRepo(l, instanceDB)
+	calendarService := calendar.NewService(l, calendarRepo, userService, curseService, sessionService)
+	calendarEndpoint := calendar.MakeEndpoints(calendarService)
+
+	attendanceRule, err := attendance.RuleFromEnv()
+	if err != nil {
+		l.Fatal(err)
+	}
+	attendanceRepo := attendance.NewRepo(l, instanceDB)
+	attendanceService := attendance.NewService(l, attendanceRepo, sessionService, instructorService, attendanceRule)
+	attendanceEndpoint := attendance.MakeEndpoints(attendanceService)
+
+	gradeRepo := grade.NewRepo(l, instanceDB)
+	gradeService := grade.NewService(l, gradeRepo, curseService, instructorService, attendanceService, bus)
+	gradeEndpoint := grade.MakeEndpoints(gradeService)
+
+	certificateSecret, err := certificate.SecretFromEnv()
+	if err != nil {
+		l.Fatal(err)
+	}
+	var certificateEndpoint *certificate.Endpoints
+	if certificateSecret == nil {
+		l.Println("warning: CERTIFICATE_SECRET is not set, certificates are disabled")
+	} else {
+		certificateRepo := certificate.NewRepo(l, instanceDB)
+		certificateService := certificate.NewService(l, certificateRepo, certificateSecret)
+		endpoints := certificate.MakeEndpoints(certificateService)
+		certificateEndpoint = &endpoints
+		events.Subscribe(bus, certificateService.OnStatusChanged, events.Name("issue certificate"), events.Async())
+	}
+
+	categoryRepo := category.NewRepo(l, instanceDB)
+	categoryService := category.NewService(l, categoryRepo)
+	categoryEndpoint := category.MakeEndpoints(categoryService)
+
+	prerequisiteRepo := prerequisite.NewRepo(l, instanceDB)
+	prerequisiteService := prerequisite.NewService(l, prerequisiteRepo, curseService)
+	prerequisiteEndpoint := prerequisite.MakeEndpoints(prerequisiteService)
+
 	enrollmentRepo := enrollment.NewRepo(l, instanceDB)
-	enrollmentService := enrollment.NewService(l, userService, curseService, enrollmentRepo)
+	enrollmentService := enrollment.NewService(l, userService, curseService, sessionService, prerequisiteService, enrollmentRepo, bus)
 	enrollmentEndpoint := enrollment.MakeEndpoints(enrollmentService)
 
+	webhookRepo := webhook.NewRepo(l, instanceDB)
+	webhookService := webhook.NewService(l, webhookRepo)
+	webhookEndpoint := webhook.MakeEndpoints(webhookService)
+
+	webhookConfig, err := webhook.ConfigFromEnv()
+	if err != nil {
+		l.Fatal(err)
+	}
+	// ctx se cancela al recibir SIGINT o SIGTERM y frena los procesos en segundo plano
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	dispatcher := webhook.NewDispatcher(l, webhookRepo, &http.Client{Timeout: 10 * time.Second}, webhookConfig)
+	go dispatcher.Run(ctx)
+
+	renderer, err := notification.NewRenderer()
+	if err != nil {
+		l.Fatal(err)
+	}
+	mail, err := mailer.FromEnv()
+	if err != nil {
+		l.Fatal(err)
+	}
+	notificationConfig, err := notification.ConfigFromEnv()
+	if err != nil {
+		l.Fatal(err)
+	}
+	notificationRepo := notification.NewRepo(l, instanceDB)
+	notificationService := notification.NewService(l, notificationRepo, renderer, userService)
+	notificationEndpoint := notification.MakeEndpoints(notificationService)
+	events.Subscribe(bus, notificationService.OnEnrollmentCreated, events.Name("notify enrollment created"), events.Async())
+	events.Subscribe(bus, notificationService.OnStatusChanged, events.Name("notify enrollment status"), events.Async())
+	go notification.NewWorker(l, notificationRepo, mail, notificationConfig).Run(ctx)
+
+	schedulerConfig, err := scheduler.ConfigFromEnv()
+	if err != nil {
+		l.Fatal(err)
+	}
+	reminderConfig, err := notification.ReminderConfigFromEnv()
+	if err != nil {
+		l.Fatal(err)
+	}
+	jobs := scheduler.New(l, scheduler.NewDBStore(instanceDB), schedulerConfig)
+	if err := jobs.Register("curse_reminders", reminderConfig.Schedule, notification.ReminderJob(notificationService, reminderConfig.Offsets())); err != nil {
+		l.Fatal(err)
+	}
+	jobEndpoint := job.MakeEndpoints(jobs)
+	go jobs.Run(ctx)
+
 	router.HandleFunc("/users", userEndpoint.Create).Methods("POST")
 	router.HandleFunc("/users", userEndpoint.GetAll).Methods("GET")
 	router.HandleFunc("/users/{id}", userEndpoint.Get).Methods("GET")
 	router.HandleFunc("/users/{id}", userEndpoint.Update).Methods("PATCH")
 	router.HandleFunc("/users/{id}", userEndpoint.Delete).Methods("DELETE")
+	router.HandleFunc("/users/{id}/restore", userEndpoint.Restore).Methods("POST")
+	router.HandleFunc("/users/{id}/purge", userEndpoint.Purge).Methods("DELETE")
+	router.HandleFunc("/users/{id}/api-key", userEndpoint.RotateAPIKey).Methods("POST")
+	router.HandleFunc("/users/{id}/teaching", instructorEndpoint.GetTeaching).Methods("GET")
+	router.HandleFunc("/users/{id}/calendar.ics", calendarEndpoint.UserFeed).Methods("GET")
+	router.HandleFunc("/users/{id}/calendar-token", calendarEndpoint.RotateToken).Methods("POST")
+	router.HandleFunc("/users/{id}/notification-preferences", notificationEndpoint.GetPreference).Methods("GET")
+	router.HandleFunc("/users/{id}/notification-preferences", notificationEndpoint.UpdatePreference).Methods("PUT")
 
 	router.HandleFunc("/curses", curseEndpoint.Create).Methods("POST")
 	router.HandleFunc("/curses", curseEndpoint.GetAll).Methods("GET")
 	router.HandleFunc("/curses/{id}", curseEndpoint.GetByID).Methods("GET")
 	router.HandleFunc("/curses/{id}", curseEndpoint.Update).Methods("PATCH")
 	router.HandleFunc("/curses/{id}", curseEndpoint.Delete).Methods("DELETE")
+	router.HandleFunc("/curses/{id}/restore", curseEndpoint.Restore).Methods("POST")
+	router.HandleFunc("/curses/{id}/purge", curseEndpoint.Purge).Methods("DELETE")
+	router.HandleFunc("/curses/{id}/history", curse.HideDrafts(curseService, curseEndpoint.History)).Methods("GET")
+	router.HandleFunc("/curses/{id}/history/{version}", curse.HideDrafts(curseService, curseEndpoint.Version)).Methods("GET")
+	router.HandleFunc("/curses/{id}/revert/{version}", curseEndpoint.Revert).Methods("POST")
+	router.HandleFunc("/curses/{id}/publish", curseEndpoint.Publish).Methods("POST")
+	router.HandleFunc("/curses/{id}/close-enrollment", curseEndpoint.CloseEnrollment).Methods("POST")
+	router.HandleFunc("/curses/{id}/reopen-enrollment", curseEndpoint.ReopenEnrollment).Methods("POST")
+	router.HandleFunc("/curses/{id}/archive", curseEndpoint.Archive).Methods("POST")
+	router.HandleFunc("/curses/{id}/instructors", curse.HideDrafts(curseService, instructorEndpoint.GetByCurse)).Methods("GET")
+	router.HandleFunc("/curses/{id}/instructors", instructorEndpoint.Assign).Methods("POST")
+	router.HandleFunc("/curses/{id}/instructors", instructorEndpoint.Remove).Methods("DELETE")
+	router.HandleFunc("/categories", categoryEndpoint.Create).Methods("POST")
+	router.HandleFunc("/categories", categoryEndpoint.GetAll).Methods("GET")
+	router.HandleFunc("/categories/{id}", categoryEndpoint.Get).Methods("GET")
+	router.HandleFunc("/categories/{id}", categoryEndpoint.Update).Methods("PATCH")
+	router.HandleFunc("/categories/{id}", categoryEndpoint.Delete).Methods("DELETE")
+	router.HandleFunc("/curses/{id}/prerequisites", curse.HideDrafts(curseService, prerequisiteEndpoint.Get)).Methods("GET")
+	router.HandleFunc("/curses/{id}/prerequisites", prerequisiteEndpoint.Set).Methods("PUT")
+	router.HandleFunc("/curses/{id}/schedules", curse.HideDrafts(curseService, sessionEndpoint.GetSchedules)).Methods("GET")
+	router.HandleFunc("/curses/{id}/schedules", sessionEndpoint.AddSchedule).Methods("POST")
+	router.HandleFunc("/curses/{id}/schedules/{schedule}", sessionEndpoint.DeleteSchedule).Methods("DELETE")
+	router.HandleFunc("/curses/{id}/sessions", curse.HideDrafts(curseService, sessionEndpoint.GetSessions)).Methods("GET")
+	router.HandleFunc("/curses/{id}/sessions", sessionEndpoint.AddSession).Methods("POST")
+	router.HandleFunc("/curses/{id}/sessions/{session}", sessionEndpoint.UpdateSession).Methods("PATCH")
+	router.HandleFunc("/curses/{id}/sessions/{session}", sessionEndpoint.DeleteSession).Methods("DELETE")
+	router.HandleFunc("/curses/{id}/sessions/{session}/attendance", attendanceEndpoint.Mark).Methods("PUT")
+	router.HandleFunc("/curses/{id}/attendance", attendanceEndpoint.GetMatrix).Methods("GET")
+	router.HandleFunc("/curses/{id}/grading", gradeEndpoint.GetPolicy).Methods("GET")
+	router.HandleFunc("/curses/{id}/grading", gradeEndpoint.UpdatePolicy).Methods("PUT")
+	router.HandleFunc("/curses/{id}/assessments", gradeEndpoint.GetAssessments).Methods("GET")
+	router.HandleFunc("/curses/{id}/assessments", gradeEndpoint.AddAssessment).Methods("POST")
+	router.HandleFunc("/curses/{id}/assessments/{assessment}", gradeEndpoint.UpdateAssessment).Methods("PATCH")
+	router.HandleFunc("/curses/{id}/assessments/{assessment}", gradeEndpoint.DeleteAssessment).Methods("DELETE")
+	router.HandleFunc("/curses/{id}/assessments/{assessment}/scores", gradeEndpoint.SetScores).Methods("PUT")
+	router.HandleFunc("/curses/{id}/gradebook", gradeEndpoint.GetGradebook).Methods("GET")
+	router.HandleFunc("/curses/{id}/gradebook/finalize", gradeEndpoint.Finalize).Methods("POST")
+	router.HandleFunc("/curses/{id}/calendar.ics", curse.HideDrafts(curseService, calendarEndpoint.CurseFeed)).Methods("GET")
 
 	router.HandleFunc("/enrollments", enrollmentEndpoint.Create).Methods("POST")
+	router.HandleFunc("/enrollments/{id}/attendance", attendanceEndpoint.GetEnrollment).Methods("GET")
+	router.HandleFunc("/enrollments/{id}/grade", gradeEndpoint.GetEnrollment).Methods("GET")
+
+	if certificateEndpoint != nil {
+		router.HandleFunc("/enrollments/{id}/certificate.pdf", certificateEndpoint.Download).Methods("GET")
+		router.HandleFunc("/certificates/{code}/verify", certificateEndpoint.Verify).Methods("GET")
+	}
+
+	router.HandleFunc("/audit", auditEndpoint.GetAll).Methods("GET")
+
+	router.HandleFunc("/notifications", notificationEndpoint.GetAll).Methods("GET")
+
+	router.HandleFunc("/jobs", jobEndpoint.GetAll).Methods("GET")
+	router.HandleFunc("/jobs/{name}/trigger", jobEndpoint.Trigger).Methods("POST")
+
+	router.HandleFunc("/webhooks", webhookEndpoint.Create).Methods("POST")
+	router.HandleFunc("/webhooks", webhookEndpoint.GetAll).Methods("GET")
+	router.HandleFunc("/webhooks/{id}", webhookEndpoint.Get).Methods("GET")
+	router.HandleFunc("/webhooks/{id}", webhookEndpoint.Delete).Methods("DELETE")
+	router.HandleFunc("/webhooks/{id}/deliveries", webhookEndpoint.GetDeliveries).Methods("GET")
+	router.HandleFunc("/webhooks/deliveries/{id}/retry", webhookEndpoint.RetryDelivery).Methods("POST")
 
 	srv := &http.Server{
 		// Handler:      http.TimeoutHandler(router, 5*time.Second, "Timeout"), // http.TimeoutHandler() se utiliza para forzar una respues en el tiempo previsto por nosotros, para que no se quede esperando
@@ -60,7 +268,22 @@ func main() {
 		WriteTimeout: 5 * time.Second,
 	}
 
-	log.Fatal(srv.ListenAndServe())
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		l.Println(err)
+	}
+
+	// los handlers asincronicos del bus (certificados, notificaciones) pueden seguir
+	// corriendo despues de responder, espero a que terminen antes de salir
+	bus.Wait()
 
 	// MANERA DE COMUNICARNOS POR MEDIO DEL PAQUETE ESTANDAR HTTP/NET
 	// port := ":3333"												// para http
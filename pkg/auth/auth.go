@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+)
+
+const HeaderAPIKey = "X-API-Key"
+
+// Anonymous es el Actor de las peticiones sin api key
+const Anonymous = "anonymous"
+
+// KeyStore busca el usuario al que pertenece una api key a partir de su hash,
+// devuelve un id vacio si ninguna coincide
+type KeyStore interface {
+	UserIDByKeyHash(hash string) (string, error)
+}
+
+type (
+	ctxKey struct{}
+
+	identity struct {
+		userID string
+		admin  bool
+	}
+
+	response struct {
+		Status int    `json:"status"`
+		Err    string `json:"error,omitempty"`
+	}
+)
+
+// IsAdmin indica si la peticion trae la api key de administrador configurada en ADMIN_API_KEY
+func IsAdmin(r *http.Request) bool {
+	key := os.Getenv("ADMIN_API_KEY")
+	if key == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get(HeaderAPIKey)), []byte(key)) == 1
+}
+
+// UserID devuelve el usuario autenticado por su api key, vacio si la peticion es anonima.
+// Solo tiene valor despues de pasar por Middleware
+func UserID(r *http.Request) string {
+	id, _ := r.Context().Value(ctxKey{}).(identity)
+	return id.userID
+}
+
+// Middleware identifica a quien hace la peticion con el header X-API-Key: la api key de
+// administrador o la de un usuario. Una key que no existe se rechaza en lugar de tratarla como anonima
+func Middleware(store KeyStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var id identity
+
+			key := r.Header.Get(HeaderAPIKey)
+			switch {
+			case key == "":
+			case IsAdmin(r):
+				id.admin = true
+			default:
+				userID, err := store.UserIDByKeyHash(HashKey(key))
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					json.NewEncoder(w).Encode(&response{Status: http.StatusInternalServerError, Err: err.Error()})
+					return
+				}
+
+				if userID == "" {
+					w.WriteHeader(http.StatusUnauthorized)
+					json.NewEncoder(w).Encode(&response{Status: http.StatusUnauthorized, Err: "invalid api key"})
+					return
+				}
+				id.userID = userID
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKey{}, id)))
+		})
+	}
+}
+
+// IsInstructor indica si el usuario da el curso, lo implementa el CanManage de cada servicio
+type IsInstructor func(curseID, userID string) (bool, error)
+
+// CanManage deja pasar a los administradores y a los instructores del curso
+func CanManage(r *http.Request, curseID string, isInstructor IsInstructor) bool {
+	if IsAdmin(r) {
+		return true
+	}
+
+	userID := UserID(r)
+	if userID == "" {
+		return false
+	}
+
+	ok, err := isInstructor(curseID, userID)
+	return err == nil && ok
+}
+
+// StaffOnly responde 403 con msg si quien hace la peticion no puede manejar el curso de la ruta {id}
+func StaffOnly(isInstructor IsInstructor, msg string, next func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !CanManage(r, mux.Vars(r)["id"], isInstructor) {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(&response{Status: http.StatusForbidden, Err: msg})
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// Actor devuelve quien hizo la peticion, Anonymous si no se identifico
+func Actor(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(identity)
+	switch {
+	case id.userID != "":
+		return id.userID
+	case id.admin:
+		return "admin"
+	}
+	return Anonymous
+}
+
+// NewKey genera una api key; solo se guarda su hash, la key se muestra una vez
+func NewKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -6,6 +6,8 @@ import (
 	"os"
 
 	"github.com/MartinZitterkopf/gocurse_web/internal/domain"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/idempotency"
+	"github.com/MartinZitterkopf/gocurse_web/pkg/scheduler"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
@@ -32,17 +34,73 @@ func DBConnection() (*gorm.DB, error) {
 	}
 
 	if os.Getenv("DATABASE_MIGRATE") == "true" {
-		if err := instanceDB.AutoMigrate(&domain.User{}); err != nil {
+		if err := instanceDB.AutoMigrate(&domain.User{}, &domain.UserAPIKey{}); err != nil {
 			return nil, err
 		}
 
-		if err := instanceDB.AutoMigrate(&domain.Curse{}); err != nil {
+		if err := instanceDB.AutoMigrate(&domain.Category{}); err != nil {
+			return nil, err
+		}
+
+		if err := instanceDB.AutoMigrate(&domain.Curse{}, &domain.CurseTag{}); err != nil {
+			return nil, err
+		}
+
+		if err := instanceDB.AutoMigrate(&domain.CurseVersion{}); err != nil {
 			return nil, err
 		}
 
 		if err := instanceDB.AutoMigrate(&domain.Enrollment{}); err != nil {
 			return nil, err
 		}
+
+		if err := instanceDB.AutoMigrate(&domain.CursePrerequisite{}); err != nil {
+			return nil, err
+		}
+
+		if err := instanceDB.AutoMigrate(&domain.CurseInstructor{}); err != nil {
+			return nil, err
+		}
+
+		if err := instanceDB.AutoMigrate(&domain.CurseSchedule{}, &domain.CurseSession{}); err != nil {
+			return nil, err
+		}
+
+		if err := instanceDB.AutoMigrate(&domain.Attendance{}); err != nil {
+			return nil, err
+		}
+
+		if err := instanceDB.AutoMigrate(&domain.GradingPolicy{}, &domain.Assessment{}, &domain.Score{}, &domain.FinalGrade{}); err != nil {
+			return nil, err
+		}
+
+		if err := instanceDB.AutoMigrate(&domain.Certificate{}); err != nil {
+			return nil, err
+		}
+
+		if err := instanceDB.AutoMigrate(&domain.CalendarToken{}); err != nil {
+			return nil, err
+		}
+
+		if err := instanceDB.AutoMigrate(&domain.AuditLog{}); err != nil {
+			return nil, err
+		}
+
+		if err := instanceDB.AutoMigrate(&idempotency.Record{}); err != nil {
+			return nil, err
+		}
+
+		if err := instanceDB.AutoMigrate(&domain.OutboxEvent{}, &domain.Webhook{}, &domain.WebhookDelivery{}); err != nil {
+			return nil, err
+		}
+
+		if err := instanceDB.AutoMigrate(&domain.Notification{}, &domain.NotificationPreference{}); err != nil {
+			return nil, err
+		}
+
+		if err := instanceDB.AutoMigrate(&scheduler.JobState{}, &scheduler.Lock{}); err != nil {
+			return nil, err
+		}
 	}
 
 	return instanceDB, nil
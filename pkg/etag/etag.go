@@ -0,0 +1,83 @@
+package etag
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Format arma el ETag a partir de la version del registro
+func Format(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// Set agrega el header ETag a la respuesta
+func Set(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", Format(version))
+}
+
+var (
+	// ErrMissing se devuelve cuando la peticion no trae If-Match
+	ErrMissing = errors.New("If-Match header is required")
+	// ErrInvalid se devuelve cuando If-Match no es un ETag fuerte de este servicio
+	ErrInvalid = errors.New("invalid If-Match header")
+)
+
+// IfMatch devuelve la version que manda el cliente en If-Match, o ErrMissing si no vino
+// y ErrInvalid si no se puede leer. Con "*" devuelve version 0, que significa cualquier version.
+// If-Match usa la comparacion fuerte (RFC 7232 3.1), por eso un ETag W/ es invalido
+func IfMatch(r *http.Request) (int, error) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" {
+		return 0, ErrMissing
+	}
+
+	if value == "*" {
+		return 0, nil
+	}
+
+	if strings.HasPrefix(value, "W/") {
+		return 0, ErrInvalid
+	}
+
+	version, ok := parse(value)
+	if !ok {
+		return 0, ErrInvalid
+	}
+
+	return version, nil
+}
+
+// NotModified indica si alguno de los ETag de If-None-Match coincide con la version actual
+func NotModified(r *http.Request, version int) bool {
+	for _, value := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		value = strings.TrimSpace(value)
+		if value == "*" {
+			return true
+		}
+
+		if v, ok := parse(value); ok && v == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parse(value string) (int, bool) {
+	// para la comparacion debil se ignora el prefijo W/
+	value = strings.TrimPrefix(value, "W/")
+
+	unquoted, err := strconv.Unquote(value)
+	if err != nil {
+		return 0, false
+	}
+
+	version, err := strconv.Atoi(unquoted)
+	if err != nil || version < 1 {
+		return 0, false
+	}
+
+	return version, true
+}
@@ -0,0 +1,139 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+type (
+	// Event es cualquier valor que se publica en el bus; los suscriptores se
+	// registran por el tipo concreto del evento
+	Event interface{}
+
+	// Publisher es lo que necesitan los servicios, asi en las pruebas se puede usar un Recorder
+	Publisher interface {
+		Publish(ctx context.Context, e Event) error
+	}
+
+	Bus struct {
+		log      *log.Logger
+		mu       sync.RWMutex
+		handlers map[reflect.Type][]handler
+		wg       sync.WaitGroup
+	}
+
+	handler struct {
+		name  string
+		async bool
+		fn    func(ctx context.Context, e Event) error
+	}
+
+	Option func(*handler)
+)
+
+func New(l *log.Logger) *Bus {
+	return &Bus{
+		log:      l,
+		handlers: make(map[reflect.Type][]handler),
+	}
+}
+
+// Async hace que el handler se ejecute en otra goroutine; sus errores solo se registran en el log
+func Async() Option {
+	return func(h *handler) {
+		h.async = true
+	}
+}
+
+// Name identifica al handler en los logs
+func Name(name string) Option {
+	return func(h *handler) {
+		h.name = name
+	}
+}
+
+// Subscribe registra fn para los eventos de tipo E
+func Subscribe[E Event](b *Bus, fn func(ctx context.Context, e E) error, opts ...Option) {
+	var zero E
+	t := reflect.TypeOf(zero)
+
+	h := handler{
+		name: fmt.Sprintf("%T", fn),
+		fn: func(ctx context.Context, e Event) error {
+			return fn(ctx, e.(E))
+		},
+	}
+	for _, opt := range opts {
+		opt(&h)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[t] = append(b.handlers[t], h)
+}
+
+// Publish ejecuta en orden los handlers sincronicos y devuelve sus errores juntos.
+// Un panic en un handler se convierte en error y no afecta a los demas.
+func (b *Bus) Publish(ctx context.Context, e Event) error {
+	b.mu.RLock()
+	handlers := b.handlers[reflect.TypeOf(e)]
+	b.mu.RUnlock()
+
+	var errs []error
+	for _, h := range handlers {
+		if h.async {
+			b.wg.Add(1)
+			go func(h handler) {
+				defer b.wg.Done()
+				// el contexto de la peticion se cancela al responder, el handler asincronico no depende de el
+				if err := b.call(context.Background(), h, e); err != nil {
+					b.log.Printf("event handler %s: %v", h.name, err)
+				}
+			}(h)
+			continue
+		}
+
+		if err := b.call(ctx, h, e); err != nil {
+			errs = append(errs, fmt.Errorf("event handler %s: %w", h.name, err))
+		}
+	}
+
+	return join(errs)
+}
+
+// Wait espera a que terminen los handlers asincronicos, por ejemplo al apagar el servidor
+func (b *Bus) Wait() {
+	b.wg.Wait()
+}
+
+func (b *Bus) call(ctx context.Context, h handler, e Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+			b.log.Printf("event handler %s panic: %v\n%s", h.name, r, debug.Stack())
+		}
+	}()
+
+	return h.fn(ctx, e)
+}
+
+func join(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return errors.New(strings.Join(msgs, "; "))
+}
@@ -0,0 +1,52 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// Recorder es un Publisher para pruebas que guarda los eventos publicados
+type Recorder struct {
+	mu     sync.Mutex
+	events []Event
+	// Err, si se define, se devuelve en cada Publish
+	Err error
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) Publish(ctx context.Context, e Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, e)
+	return r.Err
+}
+
+// Events devuelve una copia de los eventos publicados en orden
+func (r *Recorder) Events() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Event(nil), r.events...)
+}
+
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = nil
+}
+
+// Published devuelve los eventos de tipo E que se publicaron
+func Published[E Event](r *Recorder) []E {
+	var out []E
+	for _, e := range r.Events() {
+		if typed, ok := e.(E); ok {
+			out = append(out, typed)
+		}
+	}
+	return out
+}
@@ -0,0 +1,278 @@
+package ical
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	ContentType = "text/calendar; charset=utf-8"
+
+	StatusConfirmed = "CONFIRMED"
+	StatusCancelled = "CANCELLED"
+
+	dateTimeUTC   = "20060102T150405Z"
+	dateTimeLocal = "20060102T150405"
+	dateOnly      = "20060102"
+
+	// las lineas se cortan a los 75 octetos como pide la RFC 5545
+	maxLineOctets = 75
+)
+
+type (
+	Calendar struct {
+		ProdID string
+		Name   string
+		Events []Event
+	}
+
+	Event struct {
+		// UID tiene que ser estable para que los calendarios actualicen el evento en lugar de duplicarlo
+		UID         string
+		Summary     string
+		Description string
+		Location    string
+		Start       time.Time
+		End         time.Time
+		// AllDay usa solo las fechas de Start y End, End es el dia siguiente al ultimo
+		AllDay   bool
+		Status   string
+		Sequence int
+		Modified *time.Time
+	}
+)
+
+// Encode escribe el calendario con un VTIMEZONE por cada zona horaria que usan los eventos
+func (c Calendar) Encode(w io.Writer) error {
+	var b bytes.Buffer
+	line := func(name, value string) {
+		fold(&b, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", c.ProdID)
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		line("X-WR-CALNAME", escape(c.Name))
+	}
+
+	for _, tz := range timezones(c.Events) {
+		writeTimezone(&b, tz.loc, tz.from, tz.to)
+	}
+
+	now := time.Now().UTC()
+	for _, e := range c.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", e.UID)
+		line("DTSTAMP", now.Format(dateTimeUTC))
+
+		if e.AllDay {
+			line("DTSTART;VALUE=DATE", e.Start.Format(dateOnly))
+			line("DTEND;VALUE=DATE", e.End.Format(dateOnly))
+		} else {
+			fold(&b, "DTSTART"+dateTime(e.Start))
+			fold(&b, "DTEND"+dateTime(e.End))
+		}
+
+		line("SUMMARY", escape(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION", escape(e.Description))
+		}
+		if e.Location != "" {
+			line("LOCATION", escape(e.Location))
+		}
+
+		status := e.Status
+		if status == "" {
+			status = StatusConfirmed
+		}
+		line("STATUS", status)
+		line("SEQUENCE", fmt.Sprint(e.Sequence))
+
+		if e.Modified != nil {
+			line("LAST-MODIFIED", e.Modified.UTC().Format(dateTimeUTC))
+		}
+		line("END", "VEVENT")
+	}
+
+	line("END", "VCALENDAR")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// dateTime devuelve ";TZID=<zona>:<hora local>" o ":<hora UTC>Z" para las fechas en UTC
+func dateTime(t time.Time) string {
+	if t.Location() == time.UTC || t.Location().String() == "" {
+		return ":" + t.UTC().Format(dateTimeUTC)
+	}
+
+	return ";TZID=" + t.Location().String() + ":" + t.Format(dateTimeLocal)
+}
+
+type tzRange struct {
+	loc      *time.Location
+	from, to time.Time
+}
+
+// timezones junta las zonas horarias de los eventos con el rango de fechas que cubren
+func timezones(events []Event) []tzRange {
+	ranges := map[string]*tzRange{}
+
+	for _, e := range events {
+		loc := e.Start.Location()
+		if e.AllDay || loc == time.UTC || loc.String() == "" || loc.String() == "Local" {
+			continue
+		}
+
+		r, ok := ranges[loc.String()]
+		if !ok {
+			ranges[loc.String()] = &tzRange{loc: loc, from: e.Start, to: e.End}
+			continue
+		}
+
+		if e.Start.Before(r.from) {
+			r.from = e.Start
+		}
+		if e.End.After(r.to) {
+			r.to = e.End
+		}
+	}
+
+	out := make([]tzRange, 0, len(ranges))
+	for _, r := range ranges {
+		out = append(out, *r)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].loc.String() < out[j].loc.String()
+	})
+
+	return out
+}
+
+// writeTimezone arma el VTIMEZONE con las transiciones reales de la base de zonas de Go
+// entre from y to, cada una como un STANDARD o DAYLIGHT sin regla de repeticion
+func writeTimezone(b *bytes.Buffer, loc *time.Location, from, to time.Time) {
+	fold(b, "BEGIN:VTIMEZONE")
+	fold(b, "TZID:"+loc.String())
+
+	// se arranca un año antes para que los clientes tengan el offset vigente al primer evento
+	start := from.AddDate(-1, 0, 0)
+	name, offset := start.In(loc).Zone()
+	writeObservance(b, start.In(loc), name, offset, offset, isDaylight(loc, start, offset))
+
+	for t := start; t.Before(to); {
+		next := nextTransition(loc, t, to)
+		if next.IsZero() {
+			break
+		}
+
+		newName, newOffset := next.In(loc).Zone()
+		writeObservance(b, next.In(loc), newName, offset, newOffset, isDaylight(loc, next, newOffset))
+		offset, t = newOffset, next
+	}
+
+	fold(b, "END:VTIMEZONE")
+}
+
+func writeObservance(b *bytes.Buffer, at time.Time, name string, from, to int, daylight bool) {
+	kind := "STANDARD"
+	if daylight {
+		kind = "DAYLIGHT"
+	}
+
+	// DTSTART va en la hora local anterior al cambio, o sea con el offset de origen
+	local := at.UTC().Add(time.Duration(from) * time.Second)
+
+	fold(b, "BEGIN:"+kind)
+	fold(b, "DTSTART:"+local.Format(dateTimeLocal))
+	fold(b, "TZOFFSETFROM:"+formatOffset(from))
+	fold(b, "TZOFFSETTO:"+formatOffset(to))
+	if name != "" {
+		fold(b, "TZNAME:"+name)
+	}
+	fold(b, "END:"+kind)
+}
+
+// nextTransition busca el proximo cambio de offset despues de t, hasta limit
+func nextTransition(loc *time.Location, t, limit time.Time) time.Time {
+	_, offset := t.In(loc).Zone()
+
+	// se avanza de a dias y despues se busca el instante exacto por biseccion
+	for day := t.Add(24 * time.Hour); !day.After(limit.Add(24 * time.Hour)); day = day.Add(24 * time.Hour) {
+		if _, o := day.In(loc).Zone(); o == offset {
+			continue
+		}
+
+		lo, hi := day.Add(-24*time.Hour), day
+		for hi.Sub(lo) > time.Second {
+			mid := lo.Add(hi.Sub(lo) / 2)
+			if _, o := mid.In(loc).Zone(); o == offset {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		return hi.Truncate(time.Second)
+	}
+
+	return time.Time{}
+}
+
+// isDaylight compara con el offset de enero y julio: el horario de verano es el mayor de los dos
+func isDaylight(loc *time.Location, t time.Time, offset int) bool {
+	_, jan := time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, loc).Zone()
+	_, jul := time.Date(t.Year(), time.July, 1, 0, 0, 0, 0, loc).Zone()
+
+	if jan == jul {
+		return false
+	}
+
+	max := jan
+	if jul > max {
+		max = jul
+	}
+	return offset == max
+}
+
+func formatOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+
+	return fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds%3600/60)
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// fold escribe la linea cortandola en 75 octetos sin partir caracteres UTF-8
+func fold(b *bytes.Buffer, s string) {
+	limit := maxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		// las lineas siguientes empiezan con un espacio que tambien cuenta
+		limit = maxLineOctets - 1
+	}
+
+	b.WriteString(s)
+	b.WriteString("\r\n")
+}
@@ -0,0 +1,192 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/MartinZitterkopf/gocurse_web/pkg/auth"
+)
+
+const (
+	Header         = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+
+	maxKeyLength = 200
+
+	// lease es cuanto se reserva la clave mientras se procesa la peticion original, tiene que
+	// ser mayor que el WriteTimeout del servidor
+	lease = time.Minute
+)
+
+type (
+	Middleware struct {
+		log   *log.Logger
+		store Store
+		ttl   time.Duration
+	}
+
+	response struct {
+		Status int    `json:"status"`
+		Err    string `json:"error,omitempty"`
+	}
+
+	// recorder copia lo que escribe el handler para poder guardarlo
+	recorder struct {
+		http.ResponseWriter
+		status int
+		body   bytes.Buffer
+	}
+)
+
+func New(l *log.Logger, store Store, ttl time.Duration) *Middleware {
+	return &Middleware{
+		log:   l,
+		store: store,
+		ttl:   ttl,
+	}
+}
+
+// TTLFromEnv lee IDEMPOTENCY_TTL (duracion de Go, por ejemplo 24h), por defecto 24 horas
+func TTLFromEnv() (time.Duration, error) {
+	value := os.Getenv("IDEMPOTENCY_TTL")
+	if value == "" {
+		return 24 * time.Hour, nil
+	}
+
+	return time.ParseDuration(value)
+}
+
+// Handler solo actua sobre los POST que traen el header Idempotency-Key
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(Header)
+		if r.Method != http.MethodPost || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > maxKeyLength {
+			writeError(w, 400, "Idempotency-Key is too long")
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, 400, "invalid request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// la clave es por cliente y por ruta, asi dos clientes no comparten respuestas
+		scoped := scope(client(r), r.URL.Path, key)
+		fingerprint := fingerprint(r, body)
+
+		rec, created, err := m.store.Begin(scoped, fingerprint, m.ttl, lease)
+		if err != nil {
+			m.log.Printf("idempotency error: %v", err)
+			writeError(w, 500, "idempotency store unavailable")
+			return
+		}
+
+		if !created {
+			m.replay(w, rec, fingerprint)
+			return
+		}
+
+		// si el handler entra en panico se libera la clave antes de propagarlo
+		defer func() {
+			if p := recover(); p != nil {
+				if err := m.store.Release(scoped); err != nil {
+					m.log.Printf("idempotency error: %v", err)
+				}
+				panic(p)
+			}
+		}()
+
+		rw := &recorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, r)
+
+		// los errores del servidor no se guardan para que el cliente pueda reintentar
+		if rw.status >= 500 {
+			if err := m.store.Release(scoped); err != nil {
+				m.log.Printf("idempotency error: %v", err)
+			}
+			return
+		}
+
+		if err := m.store.Complete(scoped, rw.status, rw.Header().Get("Content-Type"), rw.body.Bytes()); err != nil {
+			m.log.Printf("idempotency error: %v", err)
+		}
+	})
+}
+
+func (m *Middleware) replay(w http.ResponseWriter, rec *Record, fingerprint string) {
+	if rec.Fingerprint != fingerprint {
+		writeError(w, 422, "Idempotency-Key was already used with a different request")
+		return
+	}
+
+	if rec.Status == 0 {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, 409, "a request with this Idempotency-Key is still in progress")
+		return
+	}
+
+	if rec.ContentType != "" {
+		w.Header().Set("Content-Type", rec.ContentType)
+	}
+	w.Header().Set(HeaderReplayed, "true")
+	w.WriteHeader(rec.Status)
+	w.Write(rec.Body)
+}
+
+func (rw *recorder) WriteHeader(status int) {
+	rw.status = status
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recorder) Write(b []byte) (int, error) {
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+// scope arma la clave que se guarda; va hasheada porque el actor y la ruta no tienen
+// largo maximo y la columna es varchar(255)
+// client es el usuario autenticado; los anonimos no tienen identidad y se separan por IP
+func client(r *http.Request) string {
+	actor := auth.Actor(r.Context())
+	if actor != auth.Anonymous {
+		return actor
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return actor + ":" + host
+}
+
+func scope(actor, path, key string) string {
+	sum := sha256.Sum256([]byte(actor + ":" + path + ":" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&response{Status: status, Err: msg})
+}
@@ -0,0 +1,147 @@
+package idempotency
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type (
+	// Record guarda la respuesta de una peticion con Idempotency-Key. Status en 0
+	// indica que la peticion original todavia se esta procesando.
+	Record struct {
+		Key         string    `gorm:"type:varchar(255);primary_key"`
+		Fingerprint string    `gorm:"type:char(64);not null"`
+		Status      int       `gorm:"not null"`
+		ContentType string    `gorm:"type:varchar(100)"`
+		Body        []byte    `gorm:"type:mediumblob"`
+		ExpiresAt   time.Time `gorm:"not null;index"`
+
+		// LockedUntil vence la reserva de una peticion en curso; si el proceso murio sin
+		// completarla, pasado ese momento otra peticion puede tomar la clave
+		LockedUntil *time.Time
+	}
+
+	Store interface {
+		// Begin reserva la clave por lease. Si ya existia un registro vigente lo devuelve con created en false.
+		Begin(key, fingerprint string, ttl, lease time.Duration) (rec *Record, created bool, err error)
+		// Complete guarda la respuesta para repetirla en los reintentos
+		Complete(key string, status int, contentType string, body []byte) error
+		// Release libera la clave para que se pueda volver a intentar
+		Release(key string) error
+	}
+
+	dbStore struct {
+		db *gorm.DB
+	}
+
+	memoryStore struct {
+		mu      sync.Mutex
+		records map[string]*Record
+	}
+)
+
+func (Record) TableName() string {
+	return "idempotency_keys"
+}
+
+func NewDBStore(db *gorm.DB) Store {
+	return &dbStore{db: db}
+}
+
+func (s *dbStore) Begin(key, fingerprint string, ttl, lease time.Duration) (*Record, bool, error) {
+	now := time.Now()
+	lockedUntil := now.Add(lease)
+	rec := &Record{Key: key, Fingerprint: fingerprint, ExpiresAt: now.Add(ttl), LockedUntil: &lockedUntil}
+
+	// si la clave ya vencio, o quedo reservada por una peticion que nunca termino, se borra
+	// para que la nueva peticion la pueda usar
+	err := s.db.Where("`key` = ? AND (expires_at < ? OR (status = 0 AND locked_until < ?))", key, now, now).
+		Delete(&Record{}).Error
+	if err != nil {
+		return nil, false, err
+	}
+
+	// el insert es atomico: solo una de las peticiones concurrentes con la misma clave lo logra
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(rec)
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+
+	if result.RowsAffected == 1 {
+		return rec, true, nil
+	}
+
+	var existing Record
+	if err := s.db.Where("`key` = ?", key).First(&existing).Error; err != nil {
+		return nil, false, err
+	}
+
+	return &existing, false, nil
+}
+
+func (s *dbStore) Complete(key string, status int, contentType string, body []byte) error {
+	return s.db.Model(&Record{}).Where("`key` = ?", key).Updates(map[string]interface{}{
+		"status":       status,
+		"content_type": contentType,
+		"body":         body,
+	}).Error
+}
+
+func (s *dbStore) Release(key string) error {
+	return s.db.Where("`key` = ?", key).Delete(&Record{}).Error
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{records: make(map[string]*Record)}
+}
+
+func (s *memoryStore) Begin(key, fingerprint string, ttl, lease time.Duration) (*Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for k, rec := range s.records {
+		if rec.ExpiresAt.Before(now) || (rec.Status == 0 && rec.LockedUntil != nil && rec.LockedUntil.Before(now)) {
+			delete(s.records, k)
+		}
+	}
+
+	if rec, ok := s.records[key]; ok {
+		copied := *rec
+		return &copied, false, nil
+	}
+
+	lockedUntil := now.Add(lease)
+	rec := &Record{Key: key, Fingerprint: fingerprint, ExpiresAt: now.Add(ttl), LockedUntil: &lockedUntil}
+	s.records[key] = rec
+
+	copied := *rec
+	return &copied, true, nil
+}
+
+func (s *memoryStore) Complete(key string, status int, contentType string, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[key]
+	if !ok {
+		return errors.New("idempotency key not found")
+	}
+
+	rec.Status = status
+	rec.ContentType = contentType
+	rec.Body = body
+	return nil
+}
+
+func (s *memoryStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
@@ -0,0 +1,288 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	Message struct {
+		From    string
+		To      []string
+		Subject string
+		Text    string
+		HTML    string
+	}
+
+	// Mailer envia un mensaje; hay implementaciones por SMTP, a archivos y en memoria
+	Mailer interface {
+		Send(ctx context.Context, msg Message) error
+	}
+
+	SMTPConfig struct {
+		Host     string
+		Port     string
+		Username string
+		Password string
+		// Timeout limita toda la conversacion con el servidor, desde que se conecta hasta el QUIT
+		Timeout time.Duration
+	}
+
+	smtpMailer struct {
+		config SMTPConfig
+	}
+
+	fileMailer struct {
+		dir string
+	}
+
+	// Memory guarda los mensajes enviados, sirve para pruebas
+	Memory struct {
+		mu   sync.Mutex
+		sent []Message
+	}
+)
+
+// DefaultTimeout es el limite de un envio por SMTP si no se configura SMTP_TIMEOUT
+const DefaultTimeout = 30 * time.Second
+
+func NewSMTP(config SMTPConfig) Mailer {
+	return &smtpMailer{config: config}
+}
+
+// Send hace lo mismo que smtp.SendMail pero respeta ctx y Timeout, asi un servidor
+// que no responde no deja trabado al worker
+func (m *smtpMailer) Send(ctx context.Context, msg Message) error {
+	data, err := Build(msg)
+	if err != nil {
+		return err
+	}
+
+	timeout := m.config.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	dialer := net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(m.config.Host, m.config.Port))
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+
+	// si se cancela ctx se cierra la conexion para cortar la lectura o escritura en curso
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	c, err := smtp.NewClient(conn, m.config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: m.config.Host}); err != nil {
+			return err
+		}
+	}
+
+	if m.config.Username != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := c.Auth(smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(msg.From); err != nil {
+		return err
+	}
+	for _, to := range msg.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// NewFile guarda cada mensaje como un archivo .eml en dir, util en desarrollo
+func NewFile(dir string) (Mailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &fileMailer{dir: dir}, nil
+}
+
+func (m *fileMailer) Send(ctx context.Context, msg Message) error {
+	data, err := Build(msg)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405"), randomID(4))
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0o644)
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// Sent devuelve una copia de los mensajes enviados
+func (m *Memory) Sent() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Message(nil), m.sent...)
+}
+
+// Build arma el mensaje RFC 5322; si tiene texto y html los envia como multipart/alternative
+func Build(msg Message) ([]byte, error) {
+	if msg.From == "" || len(msg.To) == 0 {
+		return nil, fmt.Errorf("from and to are required")
+	}
+
+	var b bytes.Buffer
+	header := func(k, v string) {
+		fmt.Fprintf(&b, "%s: %s\r\n", k, v)
+	}
+
+	header("From", msg.From)
+	header("To", strings.Join(msg.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", fmt.Sprintf("<%s@%s>", randomID(16), domainOf(msg.From)))
+	header("MIME-Version", "1.0")
+
+	switch {
+	case msg.Text != "" && msg.HTML != "":
+		boundary := randomID(12)
+		header("Content-Type", fmt.Sprintf("multipart/alternative; boundary=%q", boundary))
+		b.WriteString("\r\n")
+		writePart(&b, boundary, "text/plain", msg.Text)
+		writePart(&b, boundary, "text/html", msg.HTML)
+		fmt.Fprintf(&b, "--%s--\r\n", boundary)
+	case msg.HTML != "":
+		writeBody(&b, "text/html", msg.HTML)
+	default:
+		writeBody(&b, "text/plain", msg.Text)
+	}
+
+	return b.Bytes(), nil
+}
+
+func writePart(b *bytes.Buffer, boundary, contentType, body string) {
+	fmt.Fprintf(b, "--%s\r\n", boundary)
+	writeBody(b, contentType, body)
+	b.WriteString("\r\n")
+}
+
+func writeBody(b *bytes.Buffer, contentType, body string) {
+	fmt.Fprintf(b, "Content-Type: %s; charset=utf-8\r\n", contentType)
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	w := quotedprintable.NewWriter(b)
+	w.Write([]byte(body))
+	w.Close()
+}
+
+func domainOf(address string) string {
+	address = strings.TrimSuffix(address, ">")
+	if i := strings.LastIndex(address, "@"); i >= 0 {
+		return address[i+1:]
+	}
+	return "localhost"
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// FromEnv arma el mailer segun MAILER: smtp, file o memory (por defecto file en MAIL_DUMP_DIR)
+func FromEnv() (Mailer, error) {
+	switch kind := os.Getenv("MAILER"); kind {
+	case "smtp":
+		config := SMTPConfig{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USER"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}
+		if config.Host == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required when MAILER=smtp")
+		}
+		if config.Port == "" {
+			config.Port = "25"
+		}
+		if v := os.Getenv("SMTP_TIMEOUT"); v != "" {
+			timeout, err := time.ParseDuration(v)
+			if err != nil || timeout <= 0 {
+				return nil, fmt.Errorf("invalid SMTP_TIMEOUT %q", v)
+			}
+			config.Timeout = timeout
+		}
+		return NewSMTP(config), nil
+	case "memory":
+		return NewMemory(), nil
+	case "", "file":
+		dir := os.Getenv("MAIL_DUMP_DIR")
+		if dir == "" {
+			dir = "mails"
+		}
+		return NewFile(dir)
+	default:
+		return nil, fmt.Errorf("invalid MAILER %q, must be smtp, file or memory", kind)
+	}
+}
@@ -0,0 +1,146 @@
+package mailer
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+)
+
+type (
+	// Sink es un servidor SMTP minimo que acepta cualquier mensaje y lo guarda en memoria.
+	// Sirve para probar el envio real por SMTP sin depender de un servidor externo.
+	Sink struct {
+		listener net.Listener
+		mu       sync.Mutex
+		received []Received
+		wg       sync.WaitGroup
+	}
+
+	Received struct {
+		From string
+		To   []string
+		Data string
+	}
+)
+
+// NewSink escucha en addr, por ejemplo "127.0.0.1:0" para un puerto libre
+func NewSink(addr string) (*Sink, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Sink{listener: l}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Config devuelve la configuracion SMTP para conectarse al sink
+func (s *Sink) Config() SMTPConfig {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return SMTPConfig{Host: host, Port: port}
+}
+
+func (s *Sink) Received() []Received {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Received(nil), s.received...)
+}
+
+func (s *Sink) Close() error {
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Sink) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *Sink) handle(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+
+	reply("220 localhost sink ready")
+
+	var msg Received
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			msg = Received{From: address(line[len("MAIL FROM:"):])}
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			msg.To = append(msg.To, address(line[len("RCPT TO:"):]))
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 end data with <CR><LF>.<CR><LF>")
+
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" || l == ".\n" {
+					break
+				}
+				// se quita el punto que agrega el cliente al inicio de las lineas (dot-stuffing)
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+
+			msg.Data = data.String()
+			s.mu.Lock()
+			s.received = append(s.received, msg)
+			s.mu.Unlock()
+			reply("250 OK")
+		case cmd == "RSET":
+			msg = Received{}
+			reply("250 OK")
+		case cmd == "NOOP":
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 command not implemented")
+		}
+	}
+}
+
+func address(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.Index(s, " "); i >= 0 {
+		s = s[:i]
+	}
+	return strings.Trim(s, "<>")
+}
@@ -1,16 +1,71 @@
 package meta
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
-type Meta struct {
-	Page       int `json:"page"`
-	PerPage    int `json:"per_page"`
-	TotalCount int `json:"total_count"`
-	PageCount  int `json:"page_count"`
+type (
+	Meta struct {
+		Page       int `json:"page"`
+		PerPage    int `json:"per_page"`
+		TotalCount int `json:"total_count"`
+		PageCount  int `json:"page_count"`
+		// Cursor y NextCursor solo se usan en el modo de paginacion por cursor
+		Cursor     string `json:"cursor,omitempty"`
+		NextCursor string `json:"next_cursor,omitempty"`
+
+		cursorMode bool
+	}
+
+	// Cursor apunta al ultimo registro devuelto, ordenado por created_at desc, id desc
+	Cursor struct {
+		CreatedAt time.Time `json:"c"`
+		ID        string    `json:"i"`
+	}
+)
+
+var (
+	ErrInvalidPage   = errors.New("page must be a positive number")
+	ErrInvalidLimit  = errors.New("limit must be a positive number")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Params valida los parametros page y limit del query string. Si no vienen
+// devuelve 0 para que New use los valores por defecto.
+func Params(v url.Values) (page, perPage int, err error) {
+	if s := v.Get("page"); s != "" {
+		page, err = strconv.Atoi(s)
+		if err != nil || page < 1 {
+			return 0, 0, ErrInvalidPage
+		}
+	}
+
+	if s := v.Get("limit"); s != "" {
+		perPage, err = strconv.Atoi(s)
+		if err != nil || perPage < 1 {
+			return 0, 0, ErrInvalidLimit
+		}
+
+		max, err := maxPerPage()
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if max > 0 && perPage > max {
+			return 0, 0, fmt.Errorf("limit must be less than or equal to %d", max)
+		}
+	}
+
+	return page, perPage, nil
 }
 
 func New(page, perPage, total int) (*Meta, error) {
@@ -23,6 +78,15 @@ func New(page, perPage, total int) (*Meta, error) {
 		}
 	}
 
+	// aunque Params ya lo valida, nunca devuelvo mas registros que el maximo configurado
+	max, err := maxPerPage()
+	if err != nil {
+		return nil, err
+	}
+	if max > 0 && perPage > max {
+		perPage = max
+	}
+
 	pageCount := 0
 	if total >= 0 {
 		pageCount = (total + perPage - 1) / perPage
@@ -44,6 +108,73 @@ func New(page, perPage, total int) (*Meta, error) {
 	}, nil
 }
 
+// NewCursor arma el meta para el modo cursor. total es -1 cuando no se pidio el conteo.
+func NewCursor(cursor string, perPage, total int) (*Meta, error) {
+	m, err := New(1, perPage, total)
+	if err != nil {
+		return nil, err
+	}
+
+	m.cursorMode = true
+	m.Cursor = cursor
+
+	return m, nil
+}
+
+// IsCursor indica si el cliente pidio paginacion por cursor (?cursor= , vacio para la primera pagina)
+func IsCursor(v url.Values) bool {
+	_, ok := v["cursor"]
+	return ok
+}
+
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor devuelve nil si el cursor esta vacio (primera pagina)
+func DecodeCursor(s string) (*Cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+// en modo cursor no tiene sentido devolver page ni page_count, y el total solo si se conto
+func (p Meta) MarshalJSON() ([]byte, error) {
+	type meta Meta
+	if !p.cursorMode {
+		return json.Marshal(meta(p))
+	}
+
+	out := struct {
+		PerPage    int    `json:"per_page"`
+		TotalCount *int   `json:"total_count,omitempty"`
+		Cursor     string `json:"cursor,omitempty"`
+		NextCursor string `json:"next_cursor,omitempty"`
+	}{
+		PerPage:    p.PerPage,
+		Cursor:     p.Cursor,
+		NextCursor: p.NextCursor,
+	}
+	if p.TotalCount >= 0 {
+		out.TotalCount = &p.TotalCount
+	}
+
+	return json.Marshal(out)
+}
+
 func (p *Meta) Offset() int {
 	fmt.Println(p)
 	return (p.Page - 1) * p.PerPage
@@ -52,3 +183,83 @@ func (p *Meta) Offset() int {
 func (p *Meta) Limit() int {
 	return p.PerPage
 }
+
+// Links arma el header Link (RFC 8288) con las paginas first, prev, next y last
+// a partir de la url de la peticion, conservando el resto de los parametros.
+func (p *Meta) Links(r *http.Request) string {
+	if p.cursorMode {
+		links := []string{p.cursorLink(r, "", "first")}
+		if p.NextCursor != "" {
+			links = append(links, p.cursorLink(r, p.NextCursor, "next"))
+		}
+		return strings.Join(links, ", ")
+	}
+
+	lastPage := p.PageCount
+	if lastPage < 1 {
+		lastPage = 1
+	}
+
+	links := []string{p.link(r, 1, "first")}
+	if p.Page > 1 {
+		links = append(links, p.link(r, p.Page-1, "prev"))
+	}
+	if p.Page < lastPage {
+		links = append(links, p.link(r, p.Page+1, "next"))
+	}
+	links = append(links, p.link(r, lastPage, "last"))
+
+	return strings.Join(links, ", ")
+}
+
+// SetLinkHeader agrega el header Link a la respuesta
+func (p *Meta) SetLinkHeader(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Link", p.Links(r))
+}
+
+func (p *Meta) link(r *http.Request, page int, rel string) string {
+	q := r.URL.Query()
+	q.Set("page", strconv.Itoa(page))
+	q.Set("limit", strconv.Itoa(p.PerPage))
+
+	return formatLink(r, q, rel)
+}
+
+func (p *Meta) cursorLink(r *http.Request, cursor, rel string) string {
+	q := r.URL.Query()
+	q.Del("page")
+	q.Set("cursor", cursor)
+	q.Set("limit", strconv.Itoa(p.PerPage))
+
+	return formatLink(r, q, rel)
+}
+
+func formatLink(r *http.Request, q url.Values, rel string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	u := url.URL{
+		Scheme:   scheme,
+		Host:     r.Host,
+		Path:     r.URL.Path,
+		RawQuery: q.Encode(),
+	}
+
+	return fmt.Sprintf("<%s>; rel=\"%s\"", u.String(), rel)
+}
+
+func maxPerPage() (int, error) {
+	s := os.Getenv("PAGINATOR_LIMIT_MAX")
+	if s == "" {
+		return 0, nil
+	}
+
+	max, err := strconv.Atoi(s)
+	if err != nil || max < 0 {
+		return 0, fmt.Errorf("invalid PAGINATOR_LIMIT_MAX %q", s)
+	}
+
+	return max, nil
+}
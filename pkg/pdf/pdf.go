@@ -0,0 +1,240 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const ContentType = "application/pdf"
+
+// medidas en puntos (1/72 de pulgada)
+const (
+	A4Width  = 595.28
+	A4Height = 841.89
+)
+
+// las tres fuentes base de Helvetica, todos los lectores de PDF las traen asi que no hace falta embeberlas
+const (
+	Helvetica        Font = "Helvetica"
+	HelveticaBold    Font = "Helvetica-Bold"
+	HelveticaOblique Font = "Helvetica-Oblique"
+)
+
+var fonts = []Font{Helvetica, HelveticaBold, HelveticaOblique}
+
+type (
+	Font string
+
+	Color struct {
+		R, G, B float64
+	}
+
+	// Document es un PDF de paginas del mismo tamaño con texto y lineas, sin imagenes
+	Document struct {
+		Title  string
+		Width  float64
+		Height float64
+		pages  []*Page
+	}
+
+	// Page acumula las operaciones de dibujo, el origen (0, 0) es la esquina inferior izquierda
+	Page struct {
+		doc     *Document
+		content bytes.Buffer
+	}
+)
+
+func New(width, height float64) *Document {
+	return &Document{Width: width, Height: height}
+}
+
+func (d *Document) AddPage() *Page {
+	p := &Page{doc: d}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+// Text escribe s con la base de la linea en (x, y)
+func (p *Page) Text(x, y float64, font Font, size float64, color Color, s string) {
+	fmt.Fprintf(&p.content, "BT /%s %s Tf %s rg %s %s Td (%s) Tj ET\n",
+		fontName(font), num(size), rgb(color), num(x), num(y), escape(s))
+}
+
+// TextCenter escribe s centrado horizontalmente en la pagina
+func (p *Page) TextCenter(y float64, font Font, size float64, color Color, s string) {
+	p.Text((p.doc.Width-TextWidth(font, size, s))/2, y, font, size, color, s)
+}
+
+func (p *Page) Line(x1, y1, x2, y2, width float64, color Color) {
+	fmt.Fprintf(&p.content, "%s w %s RG %s %s m %s %s l S\n",
+		num(width), rgb(color), num(x1), num(y1), num(x2), num(y2))
+}
+
+func (p *Page) Rect(x, y, w, h, width float64, color Color) {
+	fmt.Fprintf(&p.content, "%s w %s RG %s %s %s %s re S\n",
+		num(width), rgb(color), num(x), num(y), num(w), num(h))
+}
+
+// Write genera el archivo; los streams van comprimidos y la tabla xref con los offsets de cada objeto
+func (d *Document) Write(w io.Writer) error {
+	var b bytes.Buffer
+	var offsets []int
+
+	object := func(body string) int {
+		offsets = append(offsets, b.Len())
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+		return len(offsets)
+	}
+
+	b.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// los objetos 1 y 2 son el catalogo y el arbol de paginas, que necesitan los IDs de las paginas
+	offsets = append(offsets, 0, 0)
+
+	var fontRefs []string
+	for i, f := range fonts {
+		id := object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", f))
+		fontRefs = append(fontRefs, fmt.Sprintf("/F%d %d 0 R", i+1, id))
+	}
+	resources := "<< /Font << " + strings.Join(fontRefs, " ") + " >> >>"
+
+	var kids []string
+	for _, p := range d.pages {
+		stream, err := compress(p.content.Bytes())
+		if err != nil {
+			return err
+		}
+
+		content := object(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", len(stream), stream))
+		page := object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources %s /Contents %d 0 R >>",
+			num(d.Width), num(d.Height), resources, content))
+		kids = append(kids, fmt.Sprintf("%d 0 R", page))
+	}
+
+	info := object(fmt.Sprintf("<< /Title (%s) /Producer (gocurse_web) >>", escape(d.Title)))
+
+	offsets[0] = b.Len()
+	b.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+
+	offsets[1] = b.Len()
+	fmt.Fprintf(&b, "2 0 obj\n<< /Type /Pages /Kids [%s] /Count %d >>\nendobj\n", strings.Join(kids, " "), len(kids))
+
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, info, xref)
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// TextWidth devuelve el ancho en puntos de s con la fuente y el tamaño indicados
+func TextWidth(font Font, size float64, s string) float64 {
+	table := helveticaWidths
+	if font == HelveticaBold {
+		table = helveticaBoldWidths
+	}
+
+	var units int
+	for _, r := range s {
+		r = unaccent(r)
+		if r >= 32 && r <= 126 {
+			units += table[r-32]
+		} else {
+			units += 556
+		}
+	}
+
+	return float64(units) * size / 1000
+}
+
+func fontName(font Font) string {
+	for i, f := range fonts {
+		if f == font {
+			return fmt.Sprintf("F%d", i+1)
+		}
+	}
+	return "F1"
+}
+
+// escape pasa el texto a WinAnsi, que coincide con Latin-1 para los acentos, y escapa los parentesis
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteByte(byte(r))
+		case r == '\n' || r == '\r' || r == '\t':
+			b.WriteByte(' ')
+		case r < 32 || r > 255 || (r > 126 && r < 160):
+			b.WriteByte('?')
+		default:
+			b.WriteByte(byte(r))
+		}
+	}
+	return b.String()
+}
+
+func compress(data []byte) ([]byte, error) {
+	var b bytes.Buffer
+	zw := zlib.NewWriter(&b)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func rgb(c Color) string {
+	return num(c.R) + " " + num(c.G) + " " + num(c.B)
+}
+
+func num(f float64) string {
+	s := fmt.Sprintf("%.3f", f)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+const (
+	accented = "ÀÁÂÃÄÅÇÈÉÊËÌÍÎÏÑÒÓÔÕÖÙÚÛÜÝàáâãäåçèéêëìíîïñòóôõöùúûüýÿ"
+	plain    = "AAAAAACEEEEIIIINOOOOOUUUUYaaaaaaceeeeiiiinooooouuuuyy"
+)
+
+// unaccent devuelve la letra sin acento, que tiene el mismo ancho en Helvetica
+func unaccent(r rune) rune {
+	if i := strings.IndexRune(accented, r); i >= 0 {
+		return []rune(plain)[len([]rune(accented[:i]))]
+	}
+	return r
+}
+
+// anchos de los caracteres 32 a 126 en milesimas del tamaño de la fuente, de los AFM de Adobe
+var (
+	helveticaWidths = [95]int{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	}
+
+	helveticaBoldWidths = [95]int{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	}
+)
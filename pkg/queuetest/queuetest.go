@@ -0,0 +1,87 @@
+// Package queuetest tiene una cola en memoria con el contrato de ClaimDue y SaveAttempt de las
+// colas de notificaciones y webhooks, para probar sus workers sin base de datos
+package queuetest
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// Fields dice como leer los elementos de la cola
+	Fields[T any] struct {
+		ID      func(item T) string
+		Pending func(item T) bool
+		// Next devuelve el NextAttemptAt del elemento, ClaimDue lo corre por el lease
+		Next func(item *T) *time.Time
+	}
+
+	Queue[T any] struct {
+		mu     sync.Mutex
+		fields Fields[T]
+		items  []T
+	}
+)
+
+func New[T any](fields Fields[T], items ...T) *Queue[T] {
+	return &Queue[T]{fields: fields, items: items}
+}
+
+func (q *Queue[T]) Add(item T) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.items = append(q.items, item)
+}
+
+// ClaimDue devuelve hasta limit elementos pendientes y vencidos, y como el repositorio real
+// los deja reservados hasta now + lease
+func (q *Queue[T]) ClaimDue(limit int, now time.Time, lease time.Duration) ([]T, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var due []T
+	for i := range q.items {
+		next := q.fields.Next(&q.items[i])
+		if q.fields.Pending(q.items[i]) && !next.After(now) && len(due) < limit {
+			*next = now.Add(lease)
+			due = append(due, q.items[i])
+		}
+	}
+	return due, nil
+}
+
+// SaveAttempt reemplaza el elemento con el mismo ID
+func (q *Queue[T]) SaveAttempt(item *T) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i := range q.items {
+		if q.fields.ID(q.items[i]) == q.fields.ID(*item) {
+			q.items[i] = *item
+		}
+	}
+	return nil
+}
+
+// Get devuelve el elemento con ese ID, o el valor vacio si no esta
+func (q *Queue[T]) Get(id string) T {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, item := range q.items {
+		if q.fields.ID(item) == id {
+			return item
+		}
+	}
+
+	var zero T
+	return zero
+}
+
+func (q *Queue[T]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.items)
+}
@@ -0,0 +1,234 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MartinZitterkopf/gocurse_web/pkg/auth"
+)
+
+type (
+	// Rate define un token bucket: Limit peticiones por Period, con rafagas de hasta Burst
+	Rate struct {
+		Limit  int
+		Period time.Duration
+		Burst  int
+	}
+
+	// KeyFunc obtiene la clave con la que se agrupan las peticiones de un cliente
+	KeyFunc func(r *http.Request) string
+
+	Config struct {
+		Read  Rate
+		Write Rate
+		// Key agrupa las peticiones en Middleware, despues de auth; nil deja solo el limite por IP de PreAuth
+		Key KeyFunc
+		// MaxBuckets es la cantidad de clientes que se siguen a la vez en el store en memoria
+		MaxBuckets int
+	}
+
+	Limiter struct {
+		config Config
+		store  Store
+		now    func() time.Time
+	}
+
+	response struct {
+		Status int    `json:"status"`
+		Err    string `json:"error,omitempty"`
+	}
+)
+
+func New(config Config, store Store) *Limiter {
+	return &Limiter{
+		config: config,
+		store:  store,
+		now:    time.Now,
+	}
+}
+
+// ConfigFromEnv arma la configuracion con las variables RATE_LIMIT_*
+func ConfigFromEnv() (Config, error) {
+	read, err := rateFromEnv("RATE_LIMIT_READ", "RATE_LIMIT_READ_BURST")
+	if err != nil {
+		return Config{}, err
+	}
+
+	write, err := rateFromEnv("RATE_LIMIT_WRITE", "RATE_LIMIT_WRITE_BURST")
+	if err != nil {
+		return Config{}, err
+	}
+
+	key, err := keyFuncFromName(os.Getenv("RATE_LIMIT_KEY"))
+	if err != nil {
+		return Config{}, err
+	}
+
+	maxBuckets := 100000
+	if v := os.Getenv("RATE_LIMIT_MAX_BUCKETS"); v != "" {
+		maxBuckets, err = strconv.Atoi(v)
+		if err != nil || maxBuckets < 1 {
+			return Config{}, fmt.Errorf("invalid RATE_LIMIT_MAX_BUCKETS %q", v)
+		}
+	}
+
+	return Config{Read: read, Write: write, Key: key, MaxBuckets: maxBuckets}, nil
+}
+
+// PreAuth limita por IP y se registra antes de auth.Middleware, asi una api key invalida tambien
+// cuenta y un cliente no puede hacer una consulta a la base por peticion sin que se lo frene
+func (l *Limiter) PreAuth(next http.Handler) http.Handler {
+	return l.limit(next, "ip", KeyByIP)
+}
+
+// Middleware limita por la clave configurada con la identidad que dejo auth.Middleware,
+// con RATE_LIMIT_KEY=ip no hace nada porque ya limito PreAuth
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	if l.config.Key == nil {
+		return next
+	}
+	return l.limit(next, "client", l.config.Key)
+}
+
+// limit usa buckets distintos segun stage, una peticion anonima que pasa por los dos
+// middlewares no descuenta dos veces del mismo bucket
+func (l *Limiter) limit(next http.Handler, stage string, keyFunc KeyFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rate, scope := l.config.Read, "read"
+		if !isRead(r.Method) {
+			rate, scope = l.config.Write, "write"
+		}
+
+		// un limite en 0 desactiva el control para ese tipo de peticion
+		if rate.Limit <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := fmt.Sprintf("%s:%s:%s", stage, scope, keyFunc(r))
+		res, err := l.store.Take(key, rate, l.now())
+		if err != nil {
+			// si falla el store dejo pasar la peticion en lugar de cortar el servicio
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+		w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d;burst=%d", rate.Limit, ceilSeconds(rate.Period), rate.Burst))
+
+		if !res.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(&response{Status: http.StatusTooManyRequests, Err: "too many requests"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// KeyByAPIKey agrupa por la api key ya validada por auth.Middleware, que tiene que estar
+// registrado antes que Middleware; una key que no existe nunca llega hasta aca.
+// Sin key se agrupa por IP
+func KeyByAPIKey(r *http.Request) string {
+	if auth.IsAdmin(r) {
+		return "key:admin"
+	}
+	if id := auth.UserID(r); id != "" {
+		return "key:" + id
+	}
+	return "ip:" + KeyByIP(r)
+}
+
+// KeyByUser agrupa por el usuario autenticado, o por IP si la peticion es anonima
+func KeyByUser(r *http.Request) string {
+	if id := auth.UserID(r); id != "" {
+		return "user:" + id
+	}
+	return "ip:" + KeyByIP(r)
+}
+
+func keyFuncFromName(name string) (KeyFunc, error) {
+	switch name {
+	case "", "ip":
+		return nil, nil
+	case "api_key":
+		return KeyByAPIKey, nil
+	case "user":
+		return KeyByUser, nil
+	}
+	return nil, fmt.Errorf("invalid RATE_LIMIT_KEY %q", name)
+}
+
+// lee valores con el formato "100/1m"; si la variable esta vacia el limite queda desactivado
+func rateFromEnv(name, burstName string) (Rate, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return Rate{}, nil
+	}
+
+	parts := strings.SplitN(value, "/", 2)
+	limit, err := strconv.Atoi(parts[0])
+	if err != nil || limit < 0 {
+		return Rate{}, fmt.Errorf("invalid %s %q", name, value)
+	}
+
+	period := time.Second
+	if len(parts) == 2 {
+		period, err = parsePeriod(parts[1])
+		if err != nil || period <= 0 {
+			return Rate{}, fmt.Errorf("invalid %s %q", name, value)
+		}
+	}
+
+	burst := limit
+	if v := os.Getenv(burstName); v != "" {
+		burst, err = strconv.Atoi(v)
+		if err != nil || burst < 1 {
+			return Rate{}, fmt.Errorf("invalid %s %q", burstName, v)
+		}
+	}
+
+	return Rate{Limit: limit, Period: period, Burst: burst}, nil
+}
+
+func parsePeriod(s string) (time.Duration, error) {
+	switch s {
+	case "s":
+		return time.Second, nil
+	case "m":
+		return time.Minute, nil
+	case "h":
+		return time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func (r Rate) PerSecond() float64 {
+	return float64(r.Limit) / r.Period.Seconds()
+}
+
+func isRead(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
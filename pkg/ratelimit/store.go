@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"container/list"
+	"math"
+	"sync"
+	"time"
+)
+
+type (
+	// Store guarda el estado de los buckets. La implementacion en memoria sirve
+	// para una sola instancia; para varias instancias se puede implementar con
+	// Redis (por ejemplo con un script que haga el mismo calculo de forma atomica).
+	Store interface {
+		Take(key string, rate Rate, now time.Time) (Result, error)
+	}
+
+	Result struct {
+		Allowed   bool
+		Limit     int
+		Remaining int
+		// Reset es el tiempo hasta que el bucket vuelve a estar lleno
+		Reset time.Duration
+		// RetryAfter es el tiempo hasta que haya al menos un token disponible
+		RetryAfter time.Duration
+	}
+
+	bucket struct {
+		key    string
+		tokens float64
+		last   time.Time
+	}
+
+	// memoryStore tiene a lo sumo max buckets; los mas recientes quedan al frente de order
+	memoryStore struct {
+		mu      sync.Mutex
+		buckets map[string]*list.Element
+		order   *list.List
+		ttl     time.Duration
+		max     int
+	}
+)
+
+// NewMemoryStore descarta los buckets sin uso hace mas de ttl y, si se llega a max,
+// el usado hace mas tiempo. max <= 0 no pone limite
+func NewMemoryStore(ttl time.Duration, max int) Store {
+	return &memoryStore{
+		buckets: make(map[string]*list.Element),
+		order:   list.New(),
+		ttl:     ttl,
+		max:     max,
+	}
+}
+
+func (s *memoryStore) Take(key string, rate Rate, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cleanup(now)
+
+	var b *bucket
+	if e, ok := s.buckets[key]; ok {
+		s.order.MoveToFront(e)
+		b = e.Value.(*bucket)
+	} else {
+		if s.max > 0 && len(s.buckets) >= s.max {
+			s.remove(s.order.Back())
+		}
+		b = &bucket{key: key, tokens: float64(rate.Burst), last: now}
+		s.buckets[key] = s.order.PushFront(b)
+	}
+
+	// recargo los tokens segun el tiempo que paso desde la ultima peticion
+	perSecond := rate.PerSecond()
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(rate.Burst), b.tokens+elapsed*perSecond)
+		b.last = now
+	}
+
+	res := Result{Limit: rate.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / perSecond)
+	}
+
+	res.Remaining = int(b.tokens)
+	res.Reset = seconds((float64(rate.Burst) - b.tokens) / perSecond)
+
+	return res, nil
+}
+
+// elimina los buckets que no se usan hace mas de ttl para que el mapa no crezca sin limite.
+// Como order esta ordenada por uso alcanza con recorrerla desde el final
+func (s *memoryStore) cleanup(now time.Time) {
+	if s.ttl <= 0 {
+		return
+	}
+
+	for e := s.order.Back(); e != nil && now.Sub(e.Value.(*bucket).last) > s.ttl; e = s.order.Back() {
+		s.remove(e)
+	}
+}
+
+func (s *memoryStore) remove(e *list.Element) {
+	s.order.Remove(e)
+	delete(s.buckets, e.Value.(*bucket).key)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
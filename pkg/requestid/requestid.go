@@ -0,0 +1,31 @@
+package requestid
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+const Header = "X-Request-ID"
+
+type ctxKey struct{}
+
+// Middleware usa el X-Request-ID que manda el cliente o genera uno nuevo,
+// lo devuelve en la respuesta y lo guarda en el contexto de la peticion
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if id == "" || len(id) > 64 {
+			id = uuid.New().String()
+		}
+
+		w.Header().Set(Header, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKey{}, id)))
+	})
+}
+
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
@@ -0,0 +1,256 @@
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+
+	// maxOccurrences corta la expansion de reglas sin fin
+	maxOccurrences = 5000
+)
+
+var ErrInvalidRule = errors.New("invalid recurrence rule")
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// Rule es el subconjunto de RRULE (RFC 5545) que soportamos:
+// FREQ=DAILY|WEEKLY|MONTHLY, INTERVAL, BYDAY (sin prefijo numerico), BYMONTHDAY, COUNT y UNTIL
+type Rule struct {
+	Freq       string
+	Interval   int
+	ByDay      []time.Weekday
+	ByMonthDay []int
+	Count      int
+	Until      *time.Time
+}
+
+// Parse acepta la regla con o sin el prefijo "RRULE:", por ejemplo "FREQ=WEEKLY;BYDAY=MO,WE"
+func Parse(value string) (Rule, error) {
+	rule := Rule{Interval: 1}
+	value = strings.TrimPrefix(strings.TrimSpace(value), "RRULE:")
+
+	for _, part := range strings.Split(value, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return rule, fmt.Errorf("%w: %q", ErrInvalidRule, part)
+		}
+
+		key, val := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+		switch key {
+		case "FREQ":
+			if val != Daily && val != Weekly && val != Monthly {
+				return rule, fmt.Errorf("%w: FREQ must be DAILY, WEEKLY or MONTHLY", ErrInvalidRule)
+			}
+			rule.Freq = val
+		case "INTERVAL":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return rule, fmt.Errorf("%w: invalid INTERVAL %q", ErrInvalidRule, val)
+			}
+			rule.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return rule, fmt.Errorf("%w: invalid COUNT %q", ErrInvalidRule, val)
+			}
+			rule.Count = n
+		case "UNTIL":
+			until, err := parseUntil(val)
+			if err != nil {
+				return rule, err
+			}
+			rule.Until = &until
+		case "BYDAY":
+			for _, d := range strings.Split(val, ",") {
+				wd, ok := weekdays[d]
+				if !ok {
+					return rule, fmt.Errorf("%w: invalid BYDAY %q", ErrInvalidRule, d)
+				}
+				rule.ByDay = append(rule.ByDay, wd)
+			}
+		case "BYMONTHDAY":
+			for _, d := range strings.Split(val, ",") {
+				n, err := strconv.Atoi(d)
+				if err != nil || n < 1 || n > 31 {
+					return rule, fmt.Errorf("%w: invalid BYMONTHDAY %q", ErrInvalidRule, d)
+				}
+				rule.ByMonthDay = append(rule.ByMonthDay, n)
+			}
+		case "WKST":
+			// las semanas siempre empiezan el lunes
+		default:
+			return rule, fmt.Errorf("%w: %s is not supported", ErrInvalidRule, key)
+		}
+	}
+
+	if rule.Freq == "" {
+		return rule, fmt.Errorf("%w: FREQ is required", ErrInvalidRule)
+	}
+
+	if rule.Count > 0 && rule.Until != nil {
+		return rule, fmt.Errorf("%w: COUNT and UNTIL can't be used together", ErrInvalidRule)
+	}
+
+	return rule, nil
+}
+
+func parseUntil(val string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102"} {
+		if t, err := time.Parse(layout, val); err == nil {
+			if layout == "20060102" {
+				// con solo la fecha se incluye todo ese dia
+				t = t.Add(24*time.Hour - time.Second)
+			}
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("%w: invalid UNTIL %q", ErrInvalidRule, val)
+}
+
+// String devuelve la regla en formato RRULE, sin el prefijo
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+
+	if r.Interval > 1 {
+		parts = append(parts, fmt.Sprintf("INTERVAL=%d", r.Interval))
+	}
+
+	if len(r.ByDay) > 0 {
+		days := make([]string, 0, len(r.ByDay))
+		for _, wd := range r.ByDay {
+			for name, d := range weekdays {
+				if d == wd {
+					days = append(days, name)
+				}
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, 0, len(r.ByMonthDay))
+		for _, d := range r.ByMonthDay {
+			days = append(days, strconv.Itoa(d))
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+
+	if r.Count > 0 {
+		parts = append(parts, fmt.Sprintf("COUNT=%d", r.Count))
+	}
+
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+
+	return strings.Join(parts, ";")
+}
+
+// Between devuelve las ocurrencias que empiezan en [from, to). dtstart es la primera
+// ocurrencia y define la hora y la zona horaria: las fechas se calculan con el reloj
+// local, asi un cambio de horario no mueve la hora de la clase
+func (r Rule) Between(dtstart, from, to time.Time) []time.Time {
+	var occurrences []time.Time
+
+	count := 0
+	for period := 0; count < maxOccurrences; period += r.Interval {
+		candidates := r.period(dtstart, period)
+		if len(candidates) == 0 && r.Freq != Monthly {
+			break
+		}
+
+		for _, t := range candidates {
+			if t.Before(dtstart) {
+				continue
+			}
+
+			if r.Until != nil && t.After(*r.Until) {
+				return occurrences
+			}
+
+			if !t.Before(to) {
+				return occurrences
+			}
+
+			count++
+			if r.Count > 0 && count > r.Count {
+				return occurrences
+			}
+
+			if !t.Before(from) {
+				occurrences = append(occurrences, t)
+			}
+		}
+
+		// un mes sin dias validos (por ejemplo BYMONTHDAY=31) no corta la regla,
+		// pero si no hay tope por fecha se evita iterar para siempre
+		if period > maxOccurrences*r.Interval {
+			break
+		}
+	}
+
+	return occurrences
+}
+
+// period devuelve las ocurrencias candidatas del periodo n contado desde dtstart, ordenadas
+func (r Rule) period(dtstart time.Time, n int) []time.Time {
+	y, m, d := dtstart.Date()
+	h, min, s := dtstart.Clock()
+	loc := dtstart.Location()
+
+	var out []time.Time
+	switch r.Freq {
+	case Daily:
+		out = append(out, time.Date(y, m, d+n, h, min, s, 0, loc))
+	case Weekly:
+		days := r.ByDay
+		if len(days) == 0 {
+			days = []time.Weekday{dtstart.Weekday()}
+		}
+
+		// lunes de la semana de dtstart
+		monday := d - (int(dtstart.Weekday())+6)%7
+		for _, wd := range days {
+			offset := (int(wd) + 6) % 7
+			out = append(out, time.Date(y, m, monday+7*n+offset, h, min, s, 0, loc))
+		}
+	case Monthly:
+		days := r.ByMonthDay
+		if len(days) == 0 {
+			days = []int{d}
+		}
+
+		first := time.Date(y, m+time.Month(n), 1, h, min, s, 0, loc)
+		for _, day := range days {
+			t := time.Date(first.Year(), first.Month(), day, h, min, s, 0, loc)
+			// se saltea el 31 en los meses de 30 dias, como indica la RFC
+			if t.Month() == first.Month() {
+				out = append(out, t)
+			}
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Before(out[j])
+	})
+
+	return out
+}
@@ -0,0 +1,193 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// Schedule calcula la proxima ejecucion posterior a t
+	Schedule interface {
+		Next(t time.Time) time.Time
+	}
+
+	// cronSchedule guarda cada campo como un conjunto de bits con los valores permitidos
+	cronSchedule struct {
+		minute, hour, dom, month, dow uint64
+		// si dia del mes y dia de la semana estan restringidos alcanza con que coincida uno (como en cron)
+		domAny, dowAny bool
+	}
+
+	everySchedule struct {
+		every time.Duration
+	}
+
+	field struct {
+		name     string
+		min, max int
+	}
+)
+
+var (
+	fields = []field{
+		{"minute", 0, 59},
+		{"hour", 0, 23},
+		{"day of month", 1, 31},
+		{"month", 1, 12},
+		{"day of week", 0, 6},
+	}
+
+	aliases = map[string]string{
+		"@yearly":  "0 0 1 1 *",
+		"@monthly": "0 0 1 * *",
+		"@weekly":  "0 0 * * 0",
+		"@daily":   "0 0 * * *",
+		"@hourly":  "0 * * * *",
+	}
+)
+
+// Parse acepta expresiones cron de 5 campos (minuto hora dia-del-mes mes dia-de-la-semana)
+// con *, listas, rangos y pasos (*/15, 1-5, 0,30), los alias @daily, @hourly, etc.
+// y "@every <duracion>"
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	if strings.HasPrefix(spec, "@every ") {
+		every, err := time.ParseDuration(strings.TrimSpace(spec[len("@every "):]))
+		if err != nil || every < time.Second {
+			return nil, fmt.Errorf("invalid schedule %q", spec)
+		}
+		return everySchedule{every: every}, nil
+	}
+
+	if alias, ok := aliases[spec]; ok {
+		spec = alias
+	}
+
+	parts := strings.Fields(spec)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("invalid schedule %q, must have 5 fields", spec)
+	}
+
+	var bits [5]uint64
+	for i, part := range parts {
+		b, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+		bits[i] = b
+	}
+
+	return &cronSchedule{
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		domAny: parts[2] == "*",
+		dowAny: parts[4] == "*",
+	}, nil
+}
+
+func parseField(value string, f field) (uint64, error) {
+	var bits uint64
+
+	for _, item := range strings.Split(value, ",") {
+		rng, step := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			s, err := strconv.Atoi(item[i+1:])
+			if err != nil || s < 1 {
+				return 0, fmt.Errorf("invalid step in %s %q", f.name, item)
+			}
+			rng, step = item[:i], s
+		}
+
+		from, to := f.min, f.max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+
+			var err error
+			if from, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid %s %q", f.name, item)
+			}
+
+			to = from
+			if len(bounds) == 2 {
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid %s %q", f.name, item)
+				}
+			} else if step > 1 {
+				// "5/15" equivale a "5-max/15"
+				to = f.max
+			}
+		}
+
+		// el domingo tambien se puede escribir como 7
+		if f.name == "day of week" && to == 7 {
+			if from == 7 {
+				from, to = 0, 0
+			} else {
+				to = 6
+				bits |= 1
+			}
+		}
+
+		if from < f.min || to > f.max || from > to {
+			return 0, fmt.Errorf("%s %q out of range %d-%d", f.name, item, f.min, f.max)
+		}
+
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// si en cinco años no hay coincidencia la expresion no se cumple nunca (por ejemplo 30 de febrero)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func (s everySchedule) Next(t time.Time) time.Time {
+	return t.Truncate(time.Second).Add(s.every)
+}
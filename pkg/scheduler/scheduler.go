@@ -0,0 +1,249 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const lockName = "scheduler"
+
+var ErrJobNotFound = errors.New("job not found")
+
+type (
+	// Run es lo que recibe cada ejecucion; Last es cero la primera vez que corre el job.
+	// Los jobs procesan lo ocurrido entre Last y Now, asi un reinicio no repite trabajo
+	Run struct {
+		Name      string
+		Last      time.Time
+		Now       time.Time
+		Triggered bool
+	}
+
+	JobFunc func(ctx context.Context, run Run) error
+
+	Config struct {
+		// Interval es cada cuanto se revisa si hay jobs para ejecutar
+		Interval time.Duration
+		// LockTTL tiene que ser mayor a Interval, si el lider se cae otra instancia toma el lock al vencer
+		LockTTL time.Duration
+	}
+
+	Job struct {
+		Name     string
+		Spec     string
+		schedule Schedule
+		fn       JobFunc
+	}
+
+	// JobInfo junta la definicion del job con su estado guardado
+	JobInfo struct {
+		Name  string    `json:"name"`
+		Spec  string    `json:"spec"`
+		State *JobState `json:"state"`
+	}
+
+	Scheduler struct {
+		log    *log.Logger
+		store  Store
+		config Config
+		holder string
+		now    func() time.Time
+
+		mu   sync.Mutex
+		jobs map[string]*Job
+	}
+)
+
+func New(l *log.Logger, store Store, config Config) *Scheduler {
+	host, _ := os.Hostname()
+
+	return &Scheduler{
+		log:    l,
+		store:  store,
+		config: config,
+		holder: fmt.Sprintf("%s-%s", host, uuid.New().String()[:8]),
+		now:    time.Now,
+		jobs:   make(map[string]*Job),
+	}
+}
+
+// ConfigFromEnv lee SCHEDULER_INTERVAL, por defecto 30s; el lock dura cuatro intervalos
+func ConfigFromEnv() (Config, error) {
+	config := Config{Interval: 30 * time.Second}
+
+	if v := os.Getenv("SCHEDULER_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval <= 0 {
+			return config, fmt.Errorf("invalid SCHEDULER_INTERVAL %q", v)
+		}
+		config.Interval = interval
+	}
+
+	config.LockTTL = 4 * config.Interval
+	return config, nil
+}
+
+// Register agrega un job con una expresion cron, ver Parse
+func (s *Scheduler) Register(name, spec string, fn JobFunc) error {
+	schedule, err := Parse(spec)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[name]; ok {
+		return fmt.Errorf("job %q already registered", name)
+	}
+
+	s.jobs[name] = &Job{Name: name, Spec: spec, schedule: schedule, fn: fn}
+	return nil
+}
+
+func (s *Scheduler) Jobs() ([]JobInfo, error) {
+	var jobs []JobInfo
+	for _, job := range s.registered() {
+		state, err := s.store.GetState(job.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, JobInfo{Name: job.Name, Spec: job.Spec, State: state})
+	}
+
+	return jobs, nil
+}
+
+// Trigger pide que el job corra en el proximo ciclo de la instancia lider
+func (s *Scheduler) Trigger(name string) error {
+	s.mu.Lock()
+	_, ok := s.jobs[name]
+	s.mu.Unlock()
+
+	if !ok {
+		return ErrJobNotFound
+	}
+
+	return s.store.Trigger(name, s.now())
+}
+
+// Run revisa los jobs cada Interval hasta que se cancele ctx
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.RunOnce(ctx); err != nil {
+			s.log.Printf("scheduler error: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce ejecuta los jobs vencidos si esta instancia es la lider
+func (s *Scheduler) RunOnce(ctx context.Context) error {
+	leader, err := s.store.AcquireLock(lockName, s.holder, s.now(), s.config.LockTTL)
+	if err != nil || !leader {
+		return err
+	}
+
+	for _, job := range s.registered() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err := s.runDue(ctx, job); err != nil {
+			s.log.Printf("scheduler error: job %s: %v", job.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Scheduler) runDue(ctx context.Context, job *Job) error {
+	now := s.now()
+
+	state, err := s.store.GetState(job.Name)
+	if err != nil {
+		return err
+	}
+
+	// la primera vez solo se calcula la proxima ejecucion, no se corre al arrancar
+	if state == nil {
+		return s.store.SaveState(&JobState{Name: job.Name, NextRunAt: job.schedule.Next(now)})
+	}
+
+	triggered := state.TriggeredAt != nil && (state.LastAttemptAt == nil || state.TriggeredAt.After(*state.LastAttemptAt))
+	if !triggered && (state.NextRunAt.IsZero() || state.NextRunAt.After(now)) {
+		return nil
+	}
+
+	run := Run{Name: job.Name, Now: now, Triggered: triggered}
+	if state.LastRunAt != nil {
+		run.Last = *state.LastRunAt
+	}
+
+	err = s.safeRun(ctx, job, run)
+
+	// si falla, LastRunAt no avanza y la proxima ejecucion vuelve a cubrir la misma ventana
+	state.LastAttemptAt = &now
+	state.NextRunAt = job.schedule.Next(now)
+	state.LastDuration = s.now().Sub(now).Milliseconds()
+	state.Runs++
+	state.LastError = ""
+	if err != nil {
+		state.LastError = truncate(err.Error(), 255)
+	} else {
+		state.LastRunAt = &now
+	}
+
+	return s.store.SaveState(state)
+}
+
+// safeRun evita que un panic en un job tire abajo el scheduler
+func (s *Scheduler) safeRun(ctx context.Context, job *Job, run Run) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return job.fn(ctx, run)
+}
+
+func (s *Scheduler) registered() []*Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Name < jobs[j].Name
+	})
+
+	return jobs
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
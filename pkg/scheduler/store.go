@@ -0,0 +1,171 @@
+package scheduler
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type (
+	// JobState se guarda en la base para que al reiniciar no se repitan ejecuciones
+	JobState struct {
+		Name string `json:"name" gorm:"type:varchar(100);primary_key"`
+		// LastRunAt es la ultima ejecucion sin error, desde ahi arranca la ventana de la siguiente
+		LastRunAt *time.Time `json:"last_run_at"`
+		// LastAttemptAt es la ultima ejecucion, haya fallado o no
+		LastAttemptAt *time.Time `json:"last_attempt_at"`
+		NextRunAt     time.Time  `json:"next_run_at"`
+		LastError     string     `json:"last_error" gorm:"type:varchar(255)"`
+		LastDuration  int64      `json:"last_duration_ms"`
+		Runs          int        `json:"runs" gorm:"not null"`
+		// TriggeredAt se completa cuando un administrador pide ejecutarlo ya
+		TriggeredAt *time.Time `json:"triggered_at"`
+	}
+
+	// Lock es el lock de lider, lo tiene una sola instancia hasta que vence
+	Lock struct {
+		Name      string    `gorm:"type:varchar(100);primary_key"`
+		Holder    string    `gorm:"type:varchar(100);not null"`
+		ExpiresAt time.Time `gorm:"not null"`
+	}
+
+	Store interface {
+		// AcquireLock toma o renueva el lock, devuelve false si lo tiene otra instancia
+		AcquireLock(name, holder string, now time.Time, ttl time.Duration) (bool, error)
+		// GetState devuelve nil si el job nunca se guardo
+		GetState(name string) (*JobState, error)
+		SaveState(state *JobState) error
+		Trigger(name string, now time.Time) error
+	}
+
+	dbStore struct {
+		db *gorm.DB
+	}
+
+	memoryStore struct {
+		mu     sync.Mutex
+		locks  map[string]Lock
+		states map[string]JobState
+	}
+)
+
+func (JobState) TableName() string {
+	return "scheduler_jobs"
+}
+
+func (Lock) TableName() string {
+	return "scheduler_locks"
+}
+
+func NewDBStore(db *gorm.DB) Store {
+	return &dbStore{db: db}
+}
+
+func (s *dbStore) AcquireLock(name, holder string, now time.Time, ttl time.Duration) (bool, error) {
+	lock := &Lock{Name: name, Holder: holder, ExpiresAt: now.Add(ttl)}
+
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(lock)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	if result.RowsAffected == 1 {
+		return true, nil
+	}
+
+	// el update es atomico: lo renueva quien ya lo tiene o lo toma otro si vencio
+	result = s.db.Model(&Lock{}).Where("name = ? AND (holder = ? OR expires_at < ?)", name, holder, now).
+		Updates(map[string]interface{}{"holder": holder, "expires_at": lock.ExpiresAt})
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+func (s *dbStore) GetState(name string) (*JobState, error) {
+	var state JobState
+
+	if err := s.db.Where("name = ?", name).First(&state).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// SaveState no pisa triggered_at para no perder un pedido que llego mientras el job corria
+func (s *dbStore) SaveState(state *JobState) error {
+	return s.db.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"last_run_at", "last_attempt_at", "next_run_at", "last_error", "last_duration", "runs"}),
+	}).Create(state).Error
+}
+
+func (s *dbStore) Trigger(name string, now time.Time) error {
+	return s.db.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"triggered_at"}),
+	}).Create(&JobState{Name: name, NextRunAt: now, TriggeredAt: &now}).Error
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{
+		locks:  make(map[string]Lock),
+		states: make(map[string]JobState),
+	}
+}
+
+func (s *memoryStore) AcquireLock(name, holder string, now time.Time, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if lock, ok := s.locks[name]; ok && lock.Holder != holder && !lock.ExpiresAt.Before(now) {
+		return false, nil
+	}
+
+	s.locks[name] = Lock{Name: name, Holder: holder, ExpiresAt: now.Add(ttl)}
+	return true, nil
+}
+
+func (s *memoryStore) GetState(name string) (*JobState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.states[name]
+	if !ok {
+		return nil, nil
+	}
+
+	return &state, nil
+}
+
+func (s *memoryStore) SaveState(state *JobState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := *state
+	if old, ok := s.states[state.Name]; ok {
+		saved.TriggeredAt = old.TriggeredAt
+	}
+
+	s.states[state.Name] = saved
+	return nil
+}
+
+func (s *memoryStore) Trigger(name string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.states[name]
+	if !ok {
+		state = JobState{Name: name, NextRunAt: now}
+	}
+
+	state.TriggeredAt = &now
+	s.states[name] = state
+	return nil
+}
@@ -0,0 +1,83 @@
+package sorting
+
+import (
+	"fmt"
+	"strings"
+)
+
+type (
+	Field struct {
+		Column string
+		Desc   bool
+	}
+
+	// Sort representa el parametro ?sort=last_name,-created_at, donde el "-" indica orden descendente
+	Sort []Field
+)
+
+// Parse valida cada campo contra la lista de columnas que permite el recurso
+func Parse(value string, allowed []string) (Sort, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	var sort Sort
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+
+		field := Field{Column: part}
+		if strings.HasPrefix(part, "-") {
+			field = Field{Column: part[1:], Desc: true}
+		}
+
+		if !contains(allowed, field.Column) {
+			return nil, fmt.Errorf("invalid sort field %q, allowed fields: %s", field.Column, strings.Join(allowed, ", "))
+		}
+
+		if seen[field.Column] {
+			return nil, fmt.Errorf("sort field %q is repeated", field.Column)
+		}
+		seen[field.Column] = true
+
+		sort = append(sort, field)
+	}
+
+	return sort, nil
+}
+
+// OrderBy arma la clausula de orden; si no se pidio ningun orden usa el de por defecto.
+// Siempre agrega el id al final para que los empates tengan un orden determinista.
+func (s Sort) OrderBy(defaultOrder string) string {
+	if len(s) == 0 {
+		return defaultOrder
+	}
+
+	parts := make([]string, 0, len(s)+1)
+	for _, f := range s {
+		parts = append(parts, f.clause())
+	}
+
+	last := s[len(s)-1]
+	if last.Column != "id" {
+		parts = append(parts, Field{Column: "id", Desc: last.Desc}.clause())
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func (f Field) clause() string {
+	if f.Desc {
+		return f.Column + " desc"
+	}
+	return f.Column + " asc"
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}